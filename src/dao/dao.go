@@ -8,7 +8,7 @@
 package dao
 
 import (
-	"flag"
+	"context"
 	"time"
 
 	"gopkg.in/mgo.v2"
@@ -16,68 +16,92 @@ import (
 
 // 定义MongoDB的配置信息
 type MongoDB struct {
-	Name         string // 数据库名称
-	Adds         addrs  // 数据库地址
-	Username     string // 数据库账号
-	Password     string // 数据库密码
-	EnableAuth   bool   // 是否启用数据库验证
-	RepSetName   string // 副本集(Replica set)名称
-	EnableRepSet bool   // 是否启用Replica Set集群模式
-}
-
-// DBConfig 表示一个MongoDB的全局配置对象
-var DBCfg = &MongoDB{}
+	Name           string        `yaml:"name"`            // 数据库名称
+	Adds           addrs         `yaml:"addrs"`           // 数据库地址
+	SRV            bool          `yaml:"srv"`             // 是否通过DNS SRV记录解析数据库地址(mongodb+srv://)
+	Username       string        `yaml:"username"`        // 数据库账号
+	Password       string        `yaml:"password"`        // 数据库密码
+	EnableAuth     bool          `yaml:"enable_auth"`     // 是否启用数据库验证
+	AuthMechanism  string        `yaml:"auth_mechanism"`  // 认证机制: SCRAM-SHA-1, MONGODB-CR, MONGODB-X509(X509), 为空时由服务器协商
+	AuthSource     string        `yaml:"auth_source"`     // 验证数据库, 为空时使用 Name
+	RepSetName     string        `yaml:"rs_name"`         // 副本集(Replica set)名称
+	EnableRepSet   bool          `yaml:"enable_rs"`       // 是否启用Replica Set集群模式
+	ReadPreference string        `yaml:"read_preference"` // 读偏好: primary, primaryPreferred, secondary, secondaryPreferred, nearest
+	Mode           string        `yaml:"mode"`            // 一致性模式: strong, monotonic, eventual 或读偏好取值, 优先于 ReadPreference, 缺省为 monotonic
+	WriteConcern   WriteConcern  `yaml:"write_concern"`   // 写关注, 缺省为由主节点确认写入
+	ConnectTimeout time.Duration `yaml:"connect_timeout"` // 建立连接超时时间
+	SocketTimeout  time.Duration `yaml:"socket_timeout"`  // socket读写超时时间, 0 表示使用mgo默认值
+	MaxPoolSize    int           `yaml:"max_pool_size"`   // 每个服务器的最大连接数, 0 表示使用mgo默认值
+	Retry          RetryPolicy   `yaml:"retry"`           // 连接失败时的重试策略
+	TLS            TLSConfig     `yaml:"tls"`             // TLS连接配置
 
-// 初始化MongoDB配置信息
-func initMongoConfig() {
-	flag.Var(&DBCfg.Adds, "db_addr", "database cluster server address")
-	flag.BoolVar(&DBCfg.EnableAuth, "db_auth", false, "enable database authorization")
-	flag.BoolVar(&DBCfg.EnableRepSet, "db_rs", false, "enable replica set")
-	flag.StringVar(&DBCfg.Name, "db_name", "mongo", "database name for your app")
-	flag.StringVar(&DBCfg.Username, "username", "mongo", "database username")
-	flag.StringVar(&DBCfg.Password, "password", "mongo", "database password ")
-	flag.StringVar(&DBCfg.RepSetName, "rs", "rs", "replica set name")
-	flag.Parse()
+	Transaction TransactionConfig `yaml:"transaction"` // 事务配置, 见 Dao.WithTransaction
 }
 
-func init() {
-	initMongoConfig()
-}
-
-// InitMongo 根据命令行参数初始化数据库连接，失败则引发panic, 成功返回mgo连接池(session)
-func InitMongo() *mgo.Session {
-	var err error
-	var session *mgo.Session
+// DBConfig 表示一个MongoDB的全局配置对象, 默认值见 DefaultConfig, 可由 LoadConfig 加载后替换
+var DBCfg = DefaultConfig()
 
+// DialInfo 根据配置生成 mgo.DialInfo
+func (m *MongoDB) DialInfo() (*mgo.DialInfo, error) {
 	info := &mgo.DialInfo{}
 
 	// Dial with sever timeout
-	info.Timeout = 30 * time.Second
+	info.Timeout = m.ConnectTimeout
+	if info.Timeout <= 0 {
+		info.Timeout = 30 * time.Second
+	}
 
 	// Init database cluster server address
-	info.Database = DBCfg.Name
-	if len(DBCfg.Adds) == 0 {
-		DBCfg.Adds = append(DBCfg.Adds, "127.0.0.1:27017")
+	info.Database = m.Name
+	info.Addrs = m.Adds
+	if m.SRV {
+		hosts, opts, err := lookupSRV(m.Adds)
+		if err != nil {
+			return nil, err
+		}
+		info.Addrs = hosts
+		// TXT记录中的选项优先级低于显式配置
+		if m.AuthSource == "" {
+			info.Source = opts.Get("authSource")
+		}
+		if !m.EnableRepSet && opts.Get("replicaSet") != "" {
+			info.ReplicaSetName = opts.Get("replicaSet")
+		}
+	}
+	if len(info.Addrs) == 0 {
+		info.Addrs = []string{"127.0.0.1:27017"}
 	}
-	info.Addrs = DBCfg.Adds
 
 	// Enable database authorization
-	if DBCfg.EnableAuth {
-		info.Username = DBCfg.Username
-		info.Password = DBCfg.Password
+	if m.EnableAuth {
+		info.Username = m.Username
+		info.Password = m.Password
+		if m.AuthSource != "" {
+			info.Source = m.AuthSource
+		}
+		info.Mechanism = normalizeAuthMechanism(m.AuthMechanism)
 	}
 
 	// Enable replica set
-	if DBCfg.EnableRepSet {
-		info.ReplicaSetName = DBCfg.RepSetName
+	if m.EnableRepSet {
+		info.ReplicaSetName = m.RepSetName
 	}
 
-	session, err = mgo.DialWithInfo(info)
+	info.PoolLimit = m.MaxPoolSize
+
+	// Enable TLS & x.509 authentication
+	if err := m.setupTLS(info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// InitMongo 根据全局配置 DBCfg 初始化数据库连接，失败则引发panic, 成功返回mgo连接池(session)
+// 需要处理连接错误(而不是panic)时请使用 Connect
+func InitMongo() *mgo.Session {
+	session, err := Connect(context.Background(), DBCfg)
 	if err != nil {
 		panic(err)
 	}
-	// Optional. Switch the session to a monotonic(单调的) behavior(行为).
-	session.SetMode(mgo.Monotonic, true)
-
 	return session
 }
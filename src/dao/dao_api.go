@@ -9,11 +9,10 @@ package dao
 
 import (
 	"bytes"
-	"errors"
+	"context"
 	"fmt"
 	"io"
 	"reflect"
-	"sort"
 	"strconv"
 	"strings"
 
@@ -27,6 +26,11 @@ type Dao struct {
 	Name     string       // 数据库名称
 	Session  *mgo.Session // 数据库连接池
 	PrefixFS string       // GridFS前缀
+
+	opts     sessionOptions      // 会话选项(一致性模式、写关注等), 见 WithMode, WithSafe
+	policies *collectionPolicies // 按集合启用的策略, 见 SetSoftDelete、SetVersioned
+	deleted  DeletedMode         // 读取时如何处理已删除的文档, 见 WithDeleted
+	txn      TransactionConfig   // 事务配置, 见 WithTransaction
 }
 
 // NewDao 初始化Dao对象
@@ -35,12 +39,15 @@ func NewDao(session *mgo.Session) *Dao {
 		Session:  session,
 		Name:     DBCfg.Name,
 		PrefixFS: fmt.Sprintf("fs"),
+		txn:      DBCfg.Transaction,
 	}
 }
 
-// SessionCopy 从源Session完成拷贝(该拷贝保留原有Session信息)
+// SessionCopy 从源Session完成拷贝(该拷贝保留原有Session信息), 并应用 Dao 的会话选项
 func (d *Dao) SessionCopy() *mgo.Session {
-	return d.Session.Copy()
+	session := d.Session.Copy()
+	d.opts.apply(session)
+	return session
 }
 
 // GetDB 获取mgo.Database对象
@@ -53,6 +60,14 @@ func (d *Dao) DropDB() error {
 	return d.Session.DB(d.Name).DropDatabase()
 }
 
+// DropDBCtx 同 DropDB, ctx 结束时中止操作
+func (d *Dao) DropDBCtx(ctx context.Context) error {
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		return session.DB(d.Name).DropDatabase()
+	})
+	return opError("DropDB", "", err)
+}
+
 // GetCollection 获取mgo.Collection对象
 func (d *Dao) GetCollection(name string, session *mgo.Session) *mgo.Collection {
 	if name == "" {
@@ -61,11 +76,6 @@ func (d *Dao) GetCollection(name string, session *mgo.Session) *mgo.Collection {
 	return d.GetDB(session).C(name)
 }
 
-var (
-	errNull          = errors.New("the interface is nil")
-	errUnSupportType = errors.New("unsupported type(only support bson.ObjectId or bson.M)")
-)
-
 /*
  * 封装 mgo 相关函数
  */
@@ -74,30 +84,39 @@ var (
 type ResultWithMap map[string]interface{}
 
 // CreateDoc 插入文档
-// name 集合名；docs 要插入的文档；keys 索引字段
+// name 集合名；docs 要插入的文档(结构体、bson.M 或它们的切片)；keys 索引字段
+// 自动写入 create_at、modify_at、is_delete(见 stampInsert)
 //
-// TODO: [20180423]数据库有关时间的字段应该存储为：时间戳，然后在代码中封装时间格式转换函数
+// Deprecated: keys 只为兼容保留, 指定时在插入前按 keys 创建唯一的稀疏索引; 索引应在模型的 index 标签中声明, 启动时由 EnsureIndexes 创建
 func (d *Dao) CreateDoc(collection string, docs interface{}, keys ...string) error {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(collection)
-
-	if len(keys) == 0 {
-		keys = append(keys, "-create_at")
-		// Warn: "-create_at["2006-01-02 15:04:05"]" maybe caused duplicated index keys
-	}
-	index := mgo.Index{
-		Key:        keys, // 索引键
-		Unique:     true, // 创建唯一索引
-		DropDups:   true, // 删除重复索引
-		Background: true, // 在后台创建
-		Sparse:     true, // 不存在字段不启用索引
-	}
-	if err := co.EnsureIndex(index); err != nil {
-		return err
-	}
+	return d.CreateDocCtx(context.Background(), collection, docs, keys...)
+}
+
+// CreateDocCtx 同 CreateDoc, ctx 结束时中止操作; ctx 中有操作人(见 WithActor)时写入 created_by、modified_by
+func (d *Dao) CreateDocCtx(ctx context.Context, collection string, docs interface{}, keys ...string) error {
+	stamped, err := d.prepareInserts(ctx, collection, docs)
+	if err != nil {
+		return opError("CreateDoc", collection, err)
+	}
+	err = d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		co := session.DB(d.Name).C(collection)
+
+		if len(keys) > 0 {
+			index := mgo.Index{
+				Key:        keys, // 索引键
+				Unique:     true, // 创建唯一索引
+				DropDups:   true, // 删除重复索引
+				Background: true, // 在后台创建
+				Sparse:     true, // 不存在字段不启用索引
+			}
+			if err := co.EnsureIndex(index); err != nil {
+				return err
+			}
+		}
 
-	return co.Insert(docs)
+		return co.Insert(stamped...)
+	})
+	return opError("CreateDoc", collection, err)
 }
 
 // UpsertDoc 插入 & 更新文档
@@ -108,112 +127,141 @@ func (d *Dao) CreateDoc(collection string, docs interface{}, keys ...string) err
 // 2：调用 session.DB(name).C(collection).Find(selector).Apply() 方法
 //    Apply()方法底层实际运行了`findAndModify`命令：
 func (d *Dao) UpsertDoc(name string, selector interface{}, update interface{}) (*mgo.ChangeInfo, error) {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(name)
+	return d.UpsertDocCtx(context.Background(), name, selector, update)
+}
 
-	if selector == nil {
-		return nil, errNull
-	}
-	if m, ok := selector.(bson.M); ok { // selector 为 bson.M
-		if change, ok := update.(mgo.Change); ok {
-			// 支持 mgo.Change
-			// $setOnInsert 设置只在文档创建时需要添加的字段
-			// change := mgo.Change{
-			// 		Update: bson.M{
-			// 			"$set":         update,
-			// 			"$setOnInsert": bson.M{"create_at": Now(), "is_delete": false, "delete_at": ""},
-			// 		},
-			// 		Upsert:    true,
-			// 		ReturnNew: true,
-			// 	}
-			var i interface{}
-			return co.Find(m).Apply(change, &i)
+// UpsertDocCtx 同 UpsertDoc, ctx 结束时中止操作
+// update(或 mgo.Change 的 Update)规则同 UpdateDoc, 插入时还会写入 create_at、is_delete 及 created_by($setOnInsert)
+func (d *Dao) UpsertDocCtx(ctx context.Context, name string, selector interface{}, update interface{}) (*mgo.ChangeInfo, error) {
+	if selector == nil || update == nil {
+		return nil, opError("UpsertDoc", name, errNull)
+	}
+	if change, ok := update.(mgo.Change); ok {
+		if !change.Remove {
+			stamped, err := d.prepareUpdate(ctx, name, change.Update, change.Upsert)
+			if err != nil {
+				return nil, opError("UpsertDoc", name, err)
+			}
+			change.Update = stamped
 		}
-		return co.Upsert(m, update)
-	}
-	if id, ok := selector.(bson.ObjectId); ok { // selector 为 bson.ObjectId
-		if change, ok := update.(mgo.Change); ok {
-			var i interface{}
-			return co.FindId(id).Apply(change, &i)
+		update = change
+	} else {
+		stamped, err := d.prepareUpdate(ctx, name, update, true)
+		if err != nil {
+			return nil, opError("UpsertDoc", name, err)
 		}
-		return co.UpsertId(id, update)
+		update = stamped
+	}
+
+	var info *mgo.ChangeInfo
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) (err error) {
+		co := session.DB(d.Name).C(name)
+
+		if m, ok := selector.(bson.M); ok { // selector 为 bson.M
+			if change, ok := update.(mgo.Change); ok {
+				// 支持 mgo.Change
+				// $setOnInsert 设置只在文档创建时需要添加的字段
+				// change := mgo.Change{
+				// 		Update: bson.M{
+				// 			"$set":         update,
+				// 			"$setOnInsert": bson.M{"create_at": Now(), "is_delete": false, "delete_at": nil},
+				// 		},
+				// 		Upsert:    true,
+				// 		ReturnNew: true,
+				// 	}
+				var i interface{}
+				info, err = co.Find(m).Apply(change, &i)
+				return err
+			}
+			info, err = co.Upsert(m, update)
+			return err
+		}
+		if id, ok := selector.(bson.ObjectId); ok { // selector 为 bson.ObjectId
+			if change, ok := update.(mgo.Change); ok {
+				var i interface{}
+				info, err = co.FindId(id).Apply(change, &i)
+				return err
+			}
+			info, err = co.UpsertId(id, update)
+			return err
+		}
+		return errUnSupportType
+	})
+	if err != nil {
+		return nil, opError("UpsertDoc", name, err)
 	}
-	return nil, errUnSupportType
+	return info, nil
 }
 
 // RemoveDoc 删除文档，物理删除
 // name 集合名；selector 选择条件(selector 存储 bson.ObjectId or bson.M 类型)
 func (d *Dao) RemoveDoc(name string, selector interface{}) error {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(name)
+	return d.RemoveDocCtx(context.Background(), name, selector)
+}
 
+// RemoveDocCtx 同 RemoveDoc, ctx 结束时中止操作
+func (d *Dao) RemoveDocCtx(ctx context.Context, name string, selector interface{}) error {
 	if selector == nil {
-		return errNull
-	}
-	if m, ok := selector.(bson.M); ok {
-		return co.Remove(m)
+		return opError("RemoveDoc", name, errNull)
 	}
-	if id, ok := selector.(bson.ObjectId); ok {
-		return co.RemoveId(id)
-	}
-	return errUnSupportType
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		co := session.DB(d.Name).C(name)
+
+		if m, ok := selector.(bson.M); ok {
+			return co.Remove(m)
+		}
+		if id, ok := selector.(bson.ObjectId); ok {
+			return co.RemoveId(id)
+		}
+		return errUnSupportType
+	})
+	return opError("RemoveDoc", name, err)
 }
 
 // RemoveDocByMark 软删除文档
 // name 集合名；selector 选择条件(selector 存储 bson.ObjectId or bson.M 类型)
+// 集合启用了软删除(见 SetSoftDelete)时只匹配未删除的文档, 并级联软删除策略中 Cascade 字段的内嵌文档
 func (d *Dao) RemoveDocByMark(name string, selector interface{}) error {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(name)
-
-	if selector == nil {
-		return errNull
-	}
+	return d.RemoveDocByMarkCtx(context.Background(), name, selector)
+}
 
-	update := bson.M{}
-	update["modify_at"] = Now()
-	update["delete_at"] = Now()
-	update["is_delete"] = true
-	if m, ok := selector.(bson.M); ok {
-		return co.Update(m, bson.M{"$set": update})
+// RemoveDocByMarkCtx 同 RemoveDocByMark, ctx 结束时中止操作
+func (d *Dao) RemoveDocByMarkCtx(ctx context.Context, name string, selector interface{}) error {
+	sel, err := idSelector(selector)
+	if err != nil {
+		return opError("RemoveDocByMark", name, err)
 	}
-	if id, ok := selector.(bson.ObjectId); ok {
-		return co.UpdateId(id, bson.M{"$set": update})
+	now := Now()
+	update, err := d.prepareUpdate(ctx, name, bson.M{"$set": bson.M{FieldDeleteAt: now, FieldIsDelete: true}}, false)
+	if err != nil {
+		return opError("RemoveDocByMark", name, err)
 	}
-	return errUnSupportType
+	policy, soft := d.SoftDeletePolicy(name)
+	err = d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		co := session.DB(d.Name).C(name)
+
+		if soft {
+			return softRemove(ctx, co, sel, update, now, policy)
+		}
+		return co.Update(sel, update)
+	})
+	return opError("RemoveDocByMark", name, err)
 }
 
 // UpdateDoc 更新文档
-// name 集合名；selector 选择条件(selector 存储 bson.ObjectId or bson.M 类型); update 更新内容
+// name 集合名；selector 选择条件(selector 存储 bson.ObjectId or bson.M 类型); update 更新内容, 规则同 Update
+//
+// Deprecated: 请使用 Update、UpdateId 或 UpdateMany, 可获得匹配及修改的文档数量
 func (d *Dao) UpdateDoc(name string, selector interface{}, update interface{}) error {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(name)
-
-	if selector == nil || update == nil {
-		return errNull
-	}
-
-	docs, ok := update.(bson.M)
-	if ok {
-		if _, ok := docs["_id"]; ok {
-			delete(docs, "_id")
-		}
-		if _, ok := docs["create_at"]; ok {
-			delete(docs, "create_at")
-		}
-		update = docs
-	}
+	return d.UpdateDocCtx(context.Background(), name, selector, update)
+}
 
-	if m, ok := selector.(bson.M); ok {
-		return co.Update(m, bson.M{"$set": update})
-	}
-	if id, ok := selector.(bson.ObjectId); ok {
-		return co.UpdateId(id, bson.M{"$set": update})
-	}
-	return errUnSupportType
+// UpdateDocCtx 同 UpdateDoc, ctx 结束时中止操作; ctx 中有操作人(见 WithActor)时写入 modified_by
+//
+// Deprecated: 请使用 UpdateCtx、UpdateIdCtx 或 UpdateManyCtx
+func (d *Dao) UpdateDocCtx(ctx context.Context, name string, selector interface{}, update interface{}) error {
+	_, err := d.update(ctx, "UpdateDoc", name, selector, update, false)
+	return err
 }
 
 // Page 定义分页查询参数存储对象
@@ -251,217 +299,268 @@ func (p *Page) checkValid(offset, limit string) {
 
 // FindWithQuery 查询文档，其结果存入mgo.Query返回
 // name集合名称; query查询条件；page分页条件；sortKeys排序字段。该方法将返回按条件过滤后的 *mgo.Query 结构
+// query 可以是 *Operator(见 ParseOperator), 此时忽略 q.count, 需要时调用返回值的 Count 方法
+//
+// Deprecated: 返回的查询直接使用源Session(不应用 Dao 的会话选项, 也无法关闭), 请使用 Query 返回的 QueryHandle
 func (d *Dao) FindWithQuery(name string, query interface{}, page Page, sortKeys ...string) (*mgo.Query, error) {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(name)
+	return d.FindWithQueryCtx(context.Background(), name, query, page, sortKeys...)
+}
 
+// FindWithQueryCtx 同 FindWithQuery, ctx 带有截止时间时为查询设置 maxTimeMS
+//
+// Deprecated: 请使用 Query
+func (d *Dao) FindWithQueryCtx(ctx context.Context, name string, query interface{}, page Page, sortKeys ...string) (*mgo.Query, error) {
 	if query == nil {
-		return nil, errNull
+		return nil, opError("FindWithQuery", name, errNull)
 	}
-	q := co.Find(query)
-
-	if len(sortKeys) == 0 {
-		sortKeys = append(sortKeys, "-create_at")
+	if err := ctx.Err(); err != nil {
+		return nil, opError("FindWithQuery", name, err)
 	}
-	q = q.Sort(sortKeys...)
+	// 拷贝的Session会在返回前关闭, 因此这里使用源Session, 其生命周期与 Dao 相同
+	return d.findQuery(ctx, d.Session, name, query, page, sortKeys...), nil
+}
 
-	if page.Valid {
-		q = q.Skip(page.Offset).Limit(page.Limit)
-	}
-	return q, nil
+// findQuery 按条件、分页及排序字段生成查询, ctx 带有截止时间时为查询设置 maxTimeMS
+// query 为 *Operator 时按 OperatorOrder 应用其中的操作符, q.count 由调用方处理; 按软删除策略排除已删除的文档(见 scope)
+func (d *Dao) findQuery(ctx context.Context, session *mgo.Session, name string, query interface{}, page Page, sortKeys ...string) *mgo.Query {
+	co := session.DB(d.Name).C(name)
+	query = d.scope(name, query)
+	op, _ := query.(*Operator)
+	q := co.Find(query)
+	return withMaxTime(ctx, op.apply(q, page, sortKeys...))
 }
 
 // FindDoc 查找文档, 其结果存入[]interface返回
 // name集合名称; query查询条件; page指定分页参数; sortKeys指定排序字段
+// query 为 *Operator(见 ParseOperator) 且指定了 q.count 时, 返回匹配的文档数量(int)
 func (d *Dao) FindDoc(name string, query interface{}, page Page, sortKeys ...string) (interface{}, error) {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(name)
+	return d.FindDocCtx(context.Background(), name, query, page, sortKeys...)
+}
 
+// FindDocCtx 同 FindDoc, ctx 结束时中止查询及结果遍历
+func (d *Dao) FindDocCtx(ctx context.Context, name string, query interface{}, page Page, sortKeys ...string) (interface{}, error) {
 	if query == nil {
-		return nil, errNull
+		return nil, opError("FindDoc", name, errNull)
 	}
-	q := co.Find(query)
 
-	if len(sortKeys) == 0 {
-		sortKeys = append(sortKeys, "-create_at")
+	if op, ok := query.(*Operator); ok && op.Count {
+		var n int
+		err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+			var err error
+			n, err = d.findQuery(ctx, session, name, query, page, sortKeys...).Count()
+			return err
+		})
+		if err != nil {
+			return nil, opError("FindDoc", name, err)
+		}
+		return n, nil
 	}
-	q = q.Sort(sortKeys...)
 
-	var err error
 	var results []bson.M
-	if page.Valid {
-		q = q.Skip(page.Offset).Limit(page.Limit)
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		q := d.findQuery(ctx, session, name, query, page, sortKeys...)
+		return allCtx(ctx, q.Iter(), &results)
+	})
+	if err != nil {
+		return nil, opError("FindDoc", name, err)
 	}
-	err = q.All(&results)
-
-	return results, err
+	return results, nil
 }
 
 // FindDocToResults 查找文档，其结果写入result(结构体对象的指针的切片)，并返回一个error
 // name集合名称; query查询条件; page指定分页参数; sortKeys指定排序字段
 func (d *Dao) FindDocToResults(name string, results, query interface{}, page Page, sortKeys ...string) error {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(name)
+	return d.FindDocToResultsCtx(context.Background(), name, results, query, page, sortKeys...)
+}
 
+// FindDocToResultsCtx 同 FindDocToResults, ctx 结束时中止查询及结果遍历, 此时不会写入 results
+func (d *Dao) FindDocToResultsCtx(ctx context.Context, name string, results, query interface{}, page Page, sortKeys ...string) error {
 	if reflect.TypeOf(results).Kind() != reflect.Ptr {
 		return fmt.Errorf("results must be a pointer")
 	}
 
 	if query == nil {
-		return errNull
+		return opError("FindDocToResults", name, errNull)
 	}
-	q := co.Find(query)
-
-	if len(sortKeys) == 0 {
-		sortKeys = append(sortKeys, "-create_at")
+	if err := noCount(query); err != nil {
+		return opError("FindDocToResults", name, err)
 	}
-	q = q.Sort(sortKeys...)
 
-	if page.Valid {
-		q = q.Skip(page.Offset).Limit(page.Limit)
-	}
-	return q.All(results)
+	err := d.decodeCtx(ctx, results, func(session *mgo.Session, out interface{}) error {
+		q := d.findQuery(ctx, session, name, query, page, sortKeys...)
+		return allCtx(ctx, q.Iter(), out)
+	})
+	return opError("FindDocToResults", name, err)
 }
 
 // FindOneDoc 查找某个文档, interface{}存储的结果为bson.M格式
 // name集合名称; query指定查询条件(contains _id or an unique_main_key)
 func (d *Dao) FindOneDoc(name string, query interface{}) (interface{}, error) {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(name)
-
-	if query == nil {
-		return nil, errNull
-	}
-
-	var err error
-	var q *mgo.Query
-	if m, ok := query.(bson.M); ok {
-		q = co.Find(m)
-		cnt, err := q.Count()
-		if err != nil {
-			return nil, err
-		}
-		if cnt > 1 {
-			return nil, mgo.ErrNotFound
-		}
-	}
+	return d.FindOneDocCtx(context.Background(), name, query)
+}
 
+// FindOneDocCtx 同 FindOneDoc, ctx 结束时中止查询
+func (d *Dao) FindOneDocCtx(ctx context.Context, name string, query interface{}) (interface{}, error) {
 	var result bson.M
-	if id, ok := query.(bson.ObjectId); ok {
-		q = co.FindId(id)
+	if err := d.FindOneDocToResultCtx(ctx, name, &result, query); err != nil {
+		return nil, opError("FindOneDoc", name, err)
 	}
-	err = q.One(&result)
-
-	return result, err
+	return result, nil
 }
 
 // FindOneDocToResult 查找某个文档, 其结果写入result(结构体对象的指针)，并返回一个error
 // name集合名称; query指定查询条件(contains _id or an unique_main_key)
 func (d *Dao) FindOneDocToResult(name string, result, query interface{}) error {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(name)
+	return d.FindOneDocToResultCtx(context.Background(), name, result, query)
+}
 
+// FindOneDocToResultCtx 同 FindOneDocToResult, ctx 结束时中止查询, 此时不会写入 result
+func (d *Dao) FindOneDocToResultCtx(ctx context.Context, name string, result, query interface{}) error {
 	if reflect.TypeOf(result).Kind() != reflect.Ptr {
 		return fmt.Errorf("results must be a pointer type")
 	}
 
 	if query == nil {
-		return errNull
+		return opError("FindOneDocToResult", name, errNull)
 	}
+	query = d.scope(name, query)
 
-	var q *mgo.Query
-	if m, ok := query.(bson.M); ok {
-		q = co.Find(m)
-		cnt, err := q.Count()
-		if err != nil {
-			return err
+	err := d.decodeCtx(ctx, result, func(session *mgo.Session, out interface{}) error {
+		co := session.DB(d.Name).C(name)
+
+		if m, ok := query.(bson.M); ok {
+			return findUnique(withMaxTime(ctx, co.Find(m)), out)
 		}
-		if cnt > 1 {
-			return mgo.ErrNotFound
+		if id, ok := query.(bson.ObjectId); ok {
+			return withMaxTime(ctx, co.FindId(id)).One(out)
 		}
-	}
+		return errUnSupportType
+	})
+	return opError("FindOneDocToResult", name, err)
+}
 
-	if id, ok := query.(bson.ObjectId); ok {
-		q = co.FindId(id)
+// findUnique 读取唯一匹配的文档写入 out, 未找到时返回 mgo.ErrNotFound, 匹配到多个文档时返回 ErrAmbiguousMatch 且不写入 out
+// 只需读取前两个文档即可判断是否唯一, 不必先统计匹配的数量
+func findUnique(q *mgo.Query, out interface{}) error {
+	iter := q.Limit(2).Iter()
+	var first, next bson.Raw
+	if !iter.Next(&first) {
+		if err := iter.Close(); err != nil {
+			return err
+		}
+		return mgo.ErrNotFound
 	}
-	return q.One(result)
+	first.Data = append([]byte(nil), first.Data...)
+	if iter.Next(&next) {
+		iter.Close()
+		return fmt.Errorf("%w: more than one document matched", ErrAmbiguousMatch)
+	}
+	if err := iter.Close(); err != nil {
+		return err
+	}
+	return first.Unmarshal(out)
 }
 
 // PipeDoc 聚合管道
 // name集合名称; pipes指定管道操作条件
 func (d *Dao) PipeDoc(name string, pipes []bson.M) (interface{}, error) {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(name)
+	return d.PipeDocCtx(context.Background(), name, pipes)
+}
 
-	var err error
+// PipeDocCtx 同 PipeDoc, ctx 结束时中止聚合及结果遍历
+func (d *Dao) PipeDocCtx(ctx context.Context, name string, pipes []bson.M) (interface{}, error) {
 	var results []bson.M
-
-	err = co.Pipe(pipes).All(&results)
-	return results, err
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		co := session.DB(d.Name).C(name)
+		return allCtx(ctx, co.Pipe(pipes).Iter(), &results)
+	})
+	if err != nil {
+		return nil, opError("PipeDoc", name, err)
+	}
+	return results, nil
 }
 
 // PipeOneDocToResult 聚合管道, 其结果写入result(结构体对象的指针)，并返回一个error
 // name集合名称; pipes指定管道操作条件
 func (d *Dao) PipeOneDocToResult(name string, pipes []bson.M, result interface{}) error {
-	session := d.SessionCopy()
-	defer session.Close()
-	co := session.DB(d.Name).C(name)
+	return d.PipeOneDocToResultCtx(context.Background(), name, pipes, result)
+}
 
+// PipeOneDocToResultCtx 同 PipeOneDocToResult, ctx 结束时中止聚合, 此时不会写入 result
+func (d *Dao) PipeOneDocToResultCtx(ctx context.Context, name string, pipes []bson.M, result interface{}) error {
 	if reflect.TypeOf(result).Kind() != reflect.Ptr {
 		return fmt.Errorf("results must be a pointer type")
 	}
-	return co.Pipe(pipes).One(result)
+	err := d.decodeCtx(ctx, result, func(session *mgo.Session, out interface{}) error {
+		co := session.DB(d.Name).C(name)
+		return co.Pipe(pipes).One(out)
+	})
+	return opError("PipeOneDocToResult", name, err)
 }
 
 // CreateGridFs 存储文件 GridFS
 // name 文件名; writer o.ReadWriter接口; 返回文档 Id 和 error
 func (d *Dao) CreateGridFs(name string, data []byte) (bson.ObjectId, error) {
-	session := d.SessionCopy()
-	defer session.Close()
-	gfs := session.DB(d.Name).GridFS(d.PrefixFS)
+	return d.CreateGridFsCtx(context.Background(), name, data)
+}
 
+// CreateGridFsCtx 同 CreateGridFs, ctx 结束时中止写入
+func (d *Dao) CreateGridFsCtx(ctx context.Context, name string, data []byte) (bson.ObjectId, error) {
 	id := bson.NewObjectId()
-	fs, err := gfs.Create(name)
-	if err != nil {
-		return id, err
-	}
-	fs.SetId(id)
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		gfs := session.DB(d.Name).GridFS(d.PrefixFS)
 
-	_, err = fs.Write(data)
+		fs, err := gfs.Create(name)
+		if err != nil {
+			return err
+		}
+		fs.SetId(id)
+
+		_, err = io.Copy(fs, &ctxReader{ctx: ctx, r: bytes.NewReader(data)})
+		if err != nil {
+			fs.Abort()
+			fs.Close()
+			return err
+		}
+		return fs.Close()
+	})
 	if err != nil {
-		return id, err
-	}
-	if err := fs.Close(); err != nil {
-		return "", err
+		return "", opError("CreateGridFs", "", err)
 	}
 	return id, nil
 }
 
 // FindGridFs 查找文件，文档id
 func (d *Dao) FindGridFs(id interface{}) ([]byte, error) {
-	session := d.SessionCopy()
-	defer session.Close()
-	gfs := session.DB(d.Name).GridFS(d.PrefixFS)
+	return d.FindGridFsCtx(context.Background(), id)
+}
 
-	fs, err := gfs.OpenId(id)
-	if err != nil {
-		return nil, err
-	}
+// FindGridFsCtx 同 FindGridFs, ctx 结束时中止读取
+func (d *Dao) FindGridFsCtx(ctx context.Context, id interface{}) ([]byte, error) {
+	var data []byte
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		gfs := session.DB(d.Name).GridFS(d.PrefixFS)
 
-	buf := bytes.NewBuffer(nil)
-	if _, err = io.Copy(buf, fs); err != nil {
-		return nil, err
-	}
-	if err := fs.Close(); err != nil {
-		return nil, err
+		fs, err := gfs.OpenId(id)
+		if err != nil {
+			return err
+		}
+
+		buf := bytes.NewBuffer(nil)
+		if _, err = io.Copy(buf, &ctxReader{ctx: ctx, r: fs}); err != nil {
+			fs.Close()
+			return err
+		}
+		if err := fs.Close(); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+		return nil
+	})
+	if err != nil {
+		return nil, opError("FindGridFs", "", err)
 	}
-	return buf.Bytes(), nil
+	return data, nil
 }
 
 // DBRef 解析mgo.DBRef，其结果写入 m(map[string]interface{})
@@ -508,16 +607,3 @@ func DBRefId(field string, m map[string]interface{}) error {
 	}
 	return nil
 }
-
-/*
- * 封装 mgo 操作符
- */
-
-type Operator struct {
-	ops sort.StringSlice
-}
-
-func NewOperator(ops ...string) {
-	operators := sort.StringSlice{}
-	operators = append(operators, ops...)
-}
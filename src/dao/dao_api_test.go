@@ -8,9 +8,12 @@
 package dao
 
 import (
+	"context"
+	"errors"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -231,3 +234,455 @@ func TestDao_UpdateDoc(t *testing.T) {
 		})
 	}
 }
+
+// seedDocs 清空集合 name 后插入 n 个文档 {"_id": i, "i": i}, i 从 0 开始
+func seedDocs(t *testing.T, d *Dao, name string, n int) {
+	t.Helper()
+	if err := d.Session.DB(d.Name).C(name).DropCollection(); err != nil && err.Error() != "ns not found" {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		return
+	}
+	docs := make([]interface{}, n)
+	for i := range docs {
+		docs[i] = bson.M{"_id": i, "i": i}
+	}
+	if err := d.CreateDoc(name, docs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDao_FindCursor(t *testing.T) {
+	session := InitMongo()
+	defer session.Close()
+	d := &Dao{Name: "mongo", Session: session}
+	seedDocs(t, d, "cursors", 10)
+
+	mgo.SetStats(true)
+	defer mgo.SetStats(false)
+	inUse := mgo.GetStats().SocketsInUse
+
+	cur, err := d.FindCursor(context.Background(), "cursors", bson.M{}, Page{}, CursorOptions{Batch: 3}, "i")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for cur.Next() {
+		var doc struct {
+			I int `bson:"i"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		if got = append(got, doc.I); len(got) == 5 {
+			break // 提前结束, 游标中还有未读取的批次
+		}
+	}
+	if err := cur.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+	if n := mgo.GetStats().SocketsInUse; n <= inUse {
+		t.Errorf("SocketsInUse before Close = %d, want > %d", n, inUse)
+	}
+	if err := cur.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if n := mgo.GetStats().SocketsInUse; n != inUse {
+		t.Errorf("SocketsInUse after Close = %d, want %d", n, inUse)
+	}
+	if !reflect.DeepEqual(got, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("FindCursor() docs = %v, want [0 1 2 3 4]", got)
+	}
+	if cur.Next() {
+		t.Error("Next() after Close = true")
+	}
+}
+
+func TestCursor_Each(t *testing.T) {
+	session := InitMongo()
+	defer session.Close()
+	d := &Dao{Name: "mongo", Session: session}
+	seedDocs(t, d, "cursors", 10)
+
+	mgo.SetStats(true)
+	defer mgo.SetStats(false)
+	inUse := mgo.GetStats().SocketsInUse
+
+	tests := []struct {
+		name    string
+		stopAt  int
+		stopErr error
+		wantN   int
+		wantErr error
+	}{
+		{name: "all", stopAt: -1, wantN: 10},
+		{name: "stop iteration", stopAt: 3, stopErr: ErrStopIteration, wantN: 4},
+		{name: "fn error", stopAt: 0, stopErr: errNull, wantN: 1, wantErr: errNull},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cur, err := d.FindCursor(context.Background(), "cursors", bson.M{}, Page{}, CursorOptions{Batch: 2}, "i")
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := 0
+			err = cur.Each(func(c *Cursor) error {
+				var doc bson.M
+				if err := c.Decode(&doc); err != nil || doc["i"] != n {
+					t.Errorf("Decode() = %v, %v, want i = %d", doc, err, n)
+				}
+				n++
+				if doc["i"] == tt.stopAt {
+					return tt.stopErr
+				}
+				return nil
+			})
+			if err != tt.wantErr || n != tt.wantN {
+				t.Errorf("Each() = %v after %d docs, want %v after %d", err, n, tt.wantErr, tt.wantN)
+			}
+			// Each 结束后游标已关闭, Session 已释放
+			if got := mgo.GetStats().SocketsInUse; got != inUse {
+				t.Errorf("SocketsInUse after Each = %d, want %d", got, inUse)
+			}
+		})
+	}
+}
+
+func TestDao_PipeCursor(t *testing.T) {
+	session := InitMongo()
+	defer session.Close()
+	d := &Dao{Name: "mongo", Session: session}
+	seedDocs(t, d, "cursors", 10)
+
+	pipes := []bson.M{
+		{"$match": bson.M{"i": bson.M{"$gte": 4}}},
+		{"$sort": bson.M{"i": -1}},
+		{"$project": bson.M{"_id": 0, "i": 1}},
+	}
+	cur, err := d.PipeCursor(context.Background(), "cursors", pipes, CursorOptions{Batch: 2, AllowDiskUse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cur.Close()
+
+	var got []int
+	for cur.Next() {
+		var doc struct {
+			I int `bson:"i"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, doc.I)
+	}
+	if err := cur.Err(); err != nil || !reflect.DeepEqual(got, []int{9, 8, 7, 6, 5, 4}) {
+		t.Errorf("PipeCursor() docs = %v, %v, want [9 8 7 6 5 4]", got, err)
+	}
+
+	// ctx 结束后 Next 返回 false, Err 返回 ctx.Err()
+	ctx, cancel := context.WithCancel(context.Background())
+	cur, err = d.PipeCursor(ctx, "cursors", pipes, CursorOptions{Batch: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cur.Close()
+	if !cur.Next() {
+		t.Fatalf("Next() = false, Err() = %v", cur.Err())
+	}
+	cancel()
+	if cur.Next() || !errors.Is(cur.Err(), context.Canceled) {
+		t.Errorf("Next() after cancel Err() = %v, want context.Canceled", cur.Err())
+	}
+}
+
+func TestDao_Ctx(t *testing.T) {
+	session := InitMongo()
+	defer session.Close()
+	d := &Dao{Name: "mongo", Session: session}
+	seedDocs(t, d, "ctxs", 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := d.CreateDocCtx(ctx, "ctxs", bson.M{"_id": 3, "i": 3}); err != nil {
+		t.Fatalf("CreateDocCtx() error = %v", err)
+	}
+	if err := d.UpdateDocCtx(ctx, "ctxs", bson.M{"_id": 3}, bson.M{"i": 30}); err != nil {
+		t.Errorf("UpdateDocCtx() error = %v", err)
+	}
+	var docs []bson.M
+	if err := d.FindDocToResultsCtx(ctx, "ctxs", &docs, bson.M{"i": bson.M{"$gte": 2}}, Page{}, "i"); err != nil ||
+		len(docs) != 2 || docs[0]["i"] != 2 || docs[1]["i"] != 30 {
+		t.Errorf("FindDocToResultsCtx() = %v, %v, want i = [2 30]", docs, err)
+	}
+	if err := d.RemoveDocCtx(ctx, "ctxs", bson.M{"_id": 3}); err != nil {
+		t.Errorf("RemoveDocCtx() error = %v", err)
+	}
+	res, err := d.PipeDocCtx(ctx, "ctxs", []bson.M{{"$group": bson.M{"_id": nil, "n": bson.M{"$sum": 1}}}})
+	if rows, _ := res.([]bson.M); err != nil || len(rows) != 1 || rows[0]["n"] != 3 {
+		t.Errorf("PipeDocCtx() = %v, %v, want n = 3", res, err)
+	}
+
+	// ctx 已结束时不执行写操作
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.CreateDocCtx(canceled, "ctxs", bson.M{"_id": 4}); !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateDocCtx(canceled) error = %v, want context.Canceled", err)
+	}
+	if n, err := session.DB("mongo").C("ctxs").Count(); err != nil || n != 3 {
+		t.Errorf("Count() after canceled CreateDocCtx = %d, %v, want 3", n, err)
+	}
+
+	// 查询超过截止时间时中止, 错误同时包装 context.DeadlineExceeded
+	short, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = d.FindDocCtx(short, "ctxs", bson.M{"$where": "sleep(200) || true"}, Page{})
+	var e *Error
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.As(err, &e) || e.Op != "FindDoc" {
+		t.Errorf("FindDocCtx(slow) error = %v, want FindDoc context.DeadlineExceeded", err)
+	}
+}
+
+func TestRepository(t *testing.T) {
+	session := InitMongo()
+	defer session.Close()
+	d := &Dao{Name: "mongo", Session: session}
+	d.SetSoftDelete("people", &SoftDeletePolicy{})
+	people := NewRepository[person](d)
+	seedDocs(t, d, "people", 0)
+
+	ctx := context.Background()
+	a, b := person{Id: bson.NewObjectId(), Name: "a"}, person{Id: bson.NewObjectId(), Name: "b"}
+	if err := people.Insert(ctx, a, b); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+	if got, err := people.Get(ctx, a.Id); err != nil || got.Name != "a" {
+		t.Errorf("Get() = %+v, %v, want a", got, err)
+	}
+	if got, err := people.Update(ctx, a.Id, bson.M{"name": "aa"}); err != nil || got.Id != a.Id || got.Name != "aa" {
+		t.Errorf("Update() = %+v, %v, want aa", got, err)
+	}
+	if got, err := people.Find(ctx, bson.M{}, Page{}, "name"); err != nil || len(got) != 2 || got[0].Name != "aa" || got[1].Name != "b" {
+		t.Errorf("Find() = %+v, %v, want [aa b]", got, err)
+	}
+	if _, err := people.FindOne(ctx, bson.M{}); !errors.Is(err, ErrAmbiguousMatch) {
+		t.Errorf("FindOne(all) error = %v, want ErrAmbiguousMatch", err)
+	}
+
+	var names []string
+	err := people.Iterate(ctx, bson.M{}, Page{}, func(p person) error {
+		names = append(names, p.Name)
+		return ErrStopIteration
+	}, "name")
+	if err != nil || !reflect.DeepEqual(names, []string{"aa"}) {
+		t.Errorf("Iterate() = %v, %v, want [aa]", names, err)
+	}
+
+	// 软删除后默认读取不到, Count 同样排除已删除的文档
+	if err := people.SoftDelete(ctx, bson.M{"_id": b.Id}); err != nil {
+		t.Fatalf("SoftDelete() error = %v", err)
+	}
+	if n, err := people.Count(ctx, bson.M{}); err != nil || n != 1 {
+		t.Errorf("Count() = %d, %v, want 1", n, err)
+	}
+	_, err = people.FindOne(ctx, bson.M{"name": "b"})
+	var e *Error
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &e) || e.Op != "FindOne" || e.Collection != "people" {
+		t.Errorf("FindOne(deleted) error = %#v, want *Error{Op: \"FindOne\", Collection: \"people\"} wrapping ErrNotFound", err)
+	}
+	if got, err := NewRepository[person](d.WithDeleted(IncludeDeleted)).Get(ctx, b.Id); err != nil || got.Name != "b" {
+		t.Errorf("Get(IncludeDeleted) = %+v, %v, want b", got, err)
+	}
+}
+
+func TestDao_Query(t *testing.T) {
+	session := InitMongo()
+	defer session.Close()
+	d := &Dao{Name: "mongo", Session: session}
+	seedDocs(t, d, "queries", 10)
+
+	h, err := d.Query(context.Background(), "queries", bson.M{"i": bson.M{"$gte": 2}}, Page{Valid: true, Offset: 1, Limit: 5}, "i")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// Count 受 Skip、Limit 影响
+	if n, err := h.Count(); err != nil || n != 5 {
+		t.Errorf("Count() = %d, %v, want 5", n, err)
+	}
+
+	var docs []bson.M
+	if err := h.Select(bson.M{"_id": 0, "i": 1}).Sort("-i").All(&docs); err != nil {
+		t.Fatalf("All() error = %v", err)
+	}
+	var got []int
+	for _, doc := range docs {
+		if _, ok := doc["_id"]; ok {
+			t.Errorf("All() doc = %v, want _id excluded by Select", doc)
+		}
+		got = append(got, doc["i"].(int))
+	}
+	if !reflect.DeepEqual(got, []int{8, 7, 6, 5, 4}) {
+		t.Errorf("All() = %v, want [8 7 6 5 4]", got)
+	}
+
+	var first bson.M
+	if err := h.One(&first); err != nil || first["i"] != 8 {
+		t.Errorf("One() = %v, %v, want i = 8", first, err)
+	}
+
+	cur, err := h.Batch(2).Iter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = got[:0]
+	for cur.Next() {
+		var doc struct {
+			I int `bson:"i"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, doc.I)
+	}
+	if err := cur.Close(); err != nil || !reflect.DeepEqual(got, []int{8, 7, 6, 5, 4}) {
+		t.Errorf("Iter() = %v, %v, want [8 7 6 5 4]", got, err)
+	}
+
+	var plan bson.M
+	if err := h.Hint("_id").Explain(&plan); err != nil || len(plan) == 0 {
+		t.Errorf("Explain() = %v, %v", plan, err)
+	}
+
+	h.Close()
+	if err := h.One(&first); !errors.Is(err, ErrQueryClosed) {
+		t.Errorf("One() after Close error = %v, want ErrQueryClosed", err)
+	}
+}
+
+func TestDao_Update(t *testing.T) {
+	session := InitMongo()
+	defer session.Close()
+	d := &Dao{Name: "mongo", Session: session}
+	seedDocs(t, d, "updates", 5)
+
+	tests := []struct {
+		name    string
+		call    func() (*mgo.ChangeInfo, error)
+		want    *mgo.ChangeInfo
+		wantErr error
+	}{
+		{"update fields", func() (*mgo.ChangeInfo, error) { return d.Update("updates", bson.M{"_id": 0}, bson.M{"tag": "x"}) },
+			&mgo.ChangeInfo{Matched: 1, Updated: 1}, nil},
+		{"update first", func() (*mgo.ChangeInfo, error) {
+			return d.Update("updates", bson.M{"i": bson.M{"$gte": 3}}, bson.M{"$set": bson.M{"first": true}})
+		}, &mgo.ChangeInfo{Matched: 1, Updated: 1}, nil},
+		{"update operators", func() (*mgo.ChangeInfo, error) {
+			return d.UpdateId("updates", 1, bson.M{"$inc": bson.M{"i": 10}, "$push": bson.M{"tags": "a"}})
+		}, &mgo.ChangeInfo{Matched: 1, Updated: 1}, nil},
+		{"update not found", func() (*mgo.ChangeInfo, error) { return d.Update("updates", bson.M{"i": -1}, bson.M{"tag": "x"}) },
+			nil, ErrNotFound},
+		{"update id not found", func() (*mgo.ChangeInfo, error) { return d.UpdateId("updates", 99, bson.M{"tag": "x"}) },
+			nil, ErrNotFound},
+		{"update many", func() (*mgo.ChangeInfo, error) {
+			return d.UpdateMany("updates", bson.M{"i": bson.M{"$gte": 2, "$lt": 5}}, bson.M{"$push": bson.M{"tags": "b"}})
+		}, &mgo.ChangeInfo{Matched: 3, Updated: 3}, nil},
+		{"update many none", func() (*mgo.ChangeInfo, error) { return d.UpdateMany("updates", bson.M{"i": -1}, bson.M{"tag": "x"}) },
+			&mgo.ChangeInfo{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.call()
+			if !errors.Is(err, tt.wantErr) || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, %v, want %+v, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+
+	// 字段文档按 $set 更新, 操作符文档原样使用, 不会替换或包装为 $set
+	var docs []struct {
+		Id       int        `bson:"_id"`
+		I        int        `bson:"i"`
+		Tag      string     `bson:"tag"`
+		Tags     []string   `bson:"tags"`
+		ModifyAt *time.Time `bson:"modify_at"`
+	}
+	if err := session.DB("mongo").C("updates").Find(nil).Sort("_id").All(&docs); err != nil {
+		t.Fatal(err)
+	}
+	if docs[0].I != 0 || docs[0].Tag != "x" || docs[0].ModifyAt == nil {
+		t.Errorf("fields doc = %+v, want i = 0, tag = x, modify_at set", docs[0])
+	}
+	if docs[1].I != 11 || !reflect.DeepEqual(docs[1].Tags, []string{"a"}) {
+		t.Errorf("operators doc = %+v, want i = 11, tags = [a]", docs[1])
+	}
+	for _, doc := range docs[2:] {
+		if !reflect.DeepEqual(doc.Tags, []string{"b"}) {
+			t.Errorf("update many doc = %+v, want tags = [b]", doc)
+		}
+	}
+}
+
+func TestConvertTimestamps(t *testing.T) {
+	session := InitMongo()
+	defer session.Close()
+	d := &Dao{Name: "mongo", Session: session}
+	d.SetSoftDelete("timestamps", &SoftDeletePolicy{})
+	seedDocs(t, d, "timestamps", 0)
+
+	co := session.DB("mongo").C("timestamps")
+	created := "2018-01-30 13:47:00"
+	if err := co.Insert(bson.M{"_id": 1, "create_at": created, "is_delete": false},
+		bson.M{"_id": 2, "create_at": created, "is_delete": true, "delete_at": created}); err != nil {
+		t.Fatal(err)
+	}
+	if err := convertTimestamps(context.Background(), d, "timestamps", true); err != nil {
+		t.Fatalf("convertTimestamps() error = %v", err)
+	}
+
+	// 已软删除的文档同样需要转换
+	var docs []bson.M
+	if err := co.Find(nil).Sort("_id").All(&docs); err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range docs {
+		if _, ok := doc["create_at"].(time.Time); !ok {
+			t.Errorf("document %v create_at = %#v, want date", doc["_id"], doc["create_at"])
+		}
+	}
+	if _, ok := docs[1]["delete_at"].(time.Time); !ok {
+		t.Errorf("deleted document delete_at = %#v, want date", docs[1]["delete_at"])
+	}
+}
+
+func TestDao_FindOneDocToResult(t *testing.T) {
+	session := InitMongo()
+	defer session.Close()
+	d := &Dao{Name: "mongo", Session: session}
+	seedDocs(t, d, "finds", 5)
+
+	tests := []struct {
+		name    string
+		query   interface{}
+		want    int
+		wantErr error
+	}{
+		{"unique", bson.M{"i": 3}, 3, nil},
+		{"not found", bson.M{"i": -1}, -1, ErrNotFound},
+		{"ambiguous", bson.M{"i": bson.M{"$gte": 1}}, -1, ErrAmbiguousMatch},
+		{"unsupported", "3", -1, ErrInvalidSelector},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := struct {
+				I int `bson:"i"`
+			}{I: -1}
+			err := d.FindOneDocToResult("finds", &result, tt.query)
+			// 出错时不写入 result
+			if !errors.Is(err, tt.wantErr) || result.I != tt.want {
+				t.Errorf("FindOneDocToResult() = %d, %v, want %d, %v", result.I, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
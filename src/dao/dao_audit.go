@@ -0,0 +1,214 @@
+/*
+ * 说明：审计字段
+ * 作者：agent
+ * 时间：2026-10-18 08:34
+ * 更新：插入、更新时自动写入 create_at、modify_at 及 ctx 中的操作人, 调用方不再需要手动设置
+ */
+
+package dao
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 审计字段
+const (
+	FieldCreateAt   = "create_at"   // 创建时间, 只在插入时写入
+	FieldModifyAt   = "modify_at"   // 修改时间, 每次写入时更新
+	FieldCreatedBy  = "created_by"  // 创建人, ctx 中有操作人时写入
+	FieldModifiedBy = "modified_by" // 修改人, ctx 中有操作人时写入
+	FieldIsDelete   = "is_delete"   // 软删除标记, 插入时默认为 false
+	FieldDeleteAt   = "delete_at"   // 软删除时间, 见 RemoveDocByMark
+)
+
+type actorKey struct{}
+
+// WithActor 返回携带操作人的 ctx, 使用该 ctx 写入时记录 created_by、modified_by, 例如:
+//
+//	ctx = dao.WithActor(r.Context(), session.UserId)
+//	err = d.CreateDocCtx(ctx, "users", user)
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// Actor 返回 ctx 中的操作人
+func Actor(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok && actor != ""
+}
+
+// stampInsert 为插入的文档写入审计字段: create_at(已有值时保留)、modify_at、is_delete(未指定时为 false)及操作人
+// doc 可以是结构体、bson.M、map、bson.D 或它们的指针, 转换为 bson.M 后返回, 不修改 doc
+func stampInsert(ctx context.Context, doc interface{}) (bson.M, error) {
+	m, err := toBsonM(doc)
+	if err != nil {
+		return nil, err
+	}
+	now := Now()
+	if m[FieldCreateAt] == nil {
+		m[FieldCreateAt] = now
+	}
+	m[FieldModifyAt] = now
+	if _, ok := m[FieldIsDelete]; !ok {
+		m[FieldIsDelete] = false
+	}
+	if actor, ok := Actor(ctx); ok {
+		if m[FieldCreatedBy] == nil {
+			m[FieldCreatedBy] = actor
+		}
+		m[FieldModifiedBy] = actor
+	}
+	return m, nil
+}
+
+// stampInserts 为插入的文档写入审计字段, docs 为切片时逐个处理
+func stampInserts(ctx context.Context, docs interface{}) ([]interface{}, error) {
+	v := reflect.ValueOf(docs)
+	if v.Kind() != reflect.Slice || v.Type() == reflect.TypeOf(bson.D{}) {
+		doc, err := stampInsert(ctx, docs)
+		return []interface{}{doc}, err
+	}
+	out := make([]interface{}, v.Len())
+	for i := range out {
+		doc, err := stampInsert(ctx, v.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("docs[%d]: %w", i, err)
+		}
+		out[i] = doc
+	}
+	return out, nil
+}
+
+// stampUpdate 生成更新内容(规则同 updateDocument)并写入审计字段:
+// $set 中加入 modify_at 及 modified_by, 移除 create_at、created_by; upsert 时 $setOnInsert 中加入 create_at、is_delete 及 created_by
+// 更新内容中的其它操作符已修改某个审计字段(如 $currentDate: {modify_at: true})时不再写入该字段; 不修改 update
+func stampUpdate(ctx context.Context, update interface{}, upsert bool) (bson.M, error) {
+	u, err := updateDocument(update)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(bson.M, len(u.(bson.M))+2)
+	for op, v := range u.(bson.M) {
+		doc[op] = v
+	}
+	set, err := operatorFields(doc, "$set")
+	if err != nil {
+		return nil, err
+	}
+	delete(set, FieldCreateAt)
+	delete(set, FieldCreatedBy)
+	// 结构体中零值的时间字段为 null, 视为未指定
+	for _, f := range []string{FieldModifyAt, FieldModifiedBy} {
+		if v, ok := set[f]; ok && v == nil {
+			delete(set, f)
+		}
+	}
+	doc["$set"] = set
+
+	actor, hasActor := Actor(ctx)
+	stamp := func(m bson.M, field string, v interface{}) {
+		if !touches(doc, field) {
+			m[field] = v
+		}
+	}
+	now := Now()
+	stamp(set, FieldModifyAt, now)
+	if hasActor {
+		stamp(set, FieldModifiedBy, actor)
+	}
+	if len(set) > 0 {
+		doc["$set"] = set
+	} else {
+		delete(doc, "$set")
+	}
+
+	if upsert {
+		onInsert, err := operatorFields(doc, "$setOnInsert")
+		if err != nil {
+			return nil, err
+		}
+		stamp(onInsert, FieldCreateAt, now)
+		stamp(onInsert, FieldIsDelete, false)
+		if hasActor {
+			stamp(onInsert, FieldCreatedBy, actor)
+		}
+		if len(onInsert) > 0 {
+			doc["$setOnInsert"] = onInsert
+		}
+	}
+	return doc, nil
+}
+
+// operatorFields 返回操作符对应字段文档的副本, 不存在时返回空的 bson.M
+func operatorFields(doc bson.M, op string) (bson.M, error) {
+	v, ok := doc[op]
+	if !ok {
+		return bson.M{}, nil
+	}
+	m, err := toBsonM(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return m, nil
+}
+
+// touches 更新内容中是否有操作符修改了 field(或其父、子字段)
+func touches(doc bson.M, field string) bool {
+	for _, v := range doc {
+		fields, err := toBsonM(v)
+		if err != nil {
+			continue
+		}
+		for k := range fields {
+			if k == field || strings.HasPrefix(k, field+".") || strings.HasPrefix(field, k+".") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// toBsonM 将文档转换为 bson.M; bson.M、map 返回浅拷贝, 结构体按 bson 标签转换
+func toBsonM(doc interface{}) (bson.M, error) {
+	switch d := doc.(type) {
+	case bson.M:
+		return copyM(d), nil
+	case map[string]interface{}:
+		return copyM(d), nil
+	case bson.D:
+		return d.Map(), nil
+	case *bson.M:
+		if d != nil {
+			return copyM(*d), nil
+		}
+	}
+	v := reflect.ValueOf(doc)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: unsupported document type %T", ErrInvalidSelector, doc)
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	m := bson.M{}
+	if err := bson.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func copyM(m map[string]interface{}) bson.M {
+	out := make(bson.M, len(m)+4)
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
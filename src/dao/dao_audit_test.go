@@ -0,0 +1,129 @@
+/*
+ * 说明：审计字段单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:34
+ * 更新：
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+	"mongodb.golang.com/src/model"
+)
+
+func TestStampInsert(t *testing.T) {
+	ctx := WithActor(context.Background(), "admin")
+	at := time.Date(2018, 1, 17, 0, 0, 0, 0, time.UTC)
+
+	got, err := stampInserts(ctx, []interface{}{
+		model.User{Account: "mongo_0"},
+		bson.M{"account": "mongo_1", "create_at": at, "is_delete": true},
+	})
+	if err != nil {
+		t.Fatalf("stampInserts() error = %v", err)
+	}
+	user, imported := got[0].(bson.M), got[1].(bson.M)
+	if _, ok := user[FieldCreateAt].(time.Time); !ok || user[FieldModifyAt] != user[FieldCreateAt] {
+		t.Errorf("create_at = %v, modify_at = %v, want now", user[FieldCreateAt], user[FieldModifyAt])
+	}
+	if user[FieldIsDelete] != false || user[FieldCreatedBy] != "admin" || user[FieldModifiedBy] != "admin" {
+		t.Errorf("stampInsert(struct) = %v", user)
+	}
+	// 已指定的 create_at、is_delete 保留
+	if imported[FieldCreateAt] != at || imported[FieldIsDelete] != true {
+		t.Errorf("stampInsert(bson.M) = %v", imported)
+	}
+
+	if got, _ := stampInserts(context.Background(), bson.M{"a": 1}); len(got) != 1 || got[0].(bson.M)[FieldCreatedBy] != nil {
+		t.Errorf("stampInserts(no actor) = %v", got)
+	}
+	if _, err := stampInserts(ctx, []interface{}{1}); !errors.Is(err, ErrInvalidSelector) {
+		t.Errorf("stampInserts(int) error = %v, want ErrInvalidSelector", err)
+	}
+}
+
+func TestStampUpdate(t *testing.T) {
+	ctx := WithActor(context.Background(), "admin")
+	// keys 返回各操作符中的字段, 忽略值
+	keys := func(doc bson.M) map[string][]string {
+		out := map[string][]string{}
+		for op, v := range doc {
+			m, _ := toBsonM(v)
+			for _, k := range sortedKeys(m) {
+				out[op] = append(out[op], k)
+			}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		update interface{}
+		upsert bool
+		want   map[string][]string
+	}{
+		{
+			name:   "fields",
+			ctx:    context.Background(),
+			update: bson.M{"_id": 1, "name": "zhe", "create_at": 1},
+			want:   map[string][]string{"$set": {"modify_at", "name"}},
+		},
+		{
+			name:   "push is not wrapped in $set",
+			ctx:    ctx,
+			update: bson.M{"$push": bson.M{"comments": bson.M{"content": "hi"}}},
+			want:   map[string][]string{"$push": {"comments"}, "$set": {"modified_by", "modify_at"}},
+		},
+		{
+			name:   "struct upsert",
+			ctx:    ctx,
+			update: model.User{Name: "zhe"},
+			upsert: true,
+			want: map[string][]string{
+				"$set":         {"account", "address", "age", "comments", "delete_at", "email", "friends", "is_delete", "modified_by", "modify_at", "name", "password", "version"},
+				"$setOnInsert": {"create_at", "created_by"},
+			},
+		},
+		{
+			name:   "explicit operators win",
+			ctx:    ctx,
+			update: bson.M{"$set": bson.M{"create_at": 1, "name": "zhe"}, "$currentDate": bson.M{"modify_at": true}, "$setOnInsert": bson.M{"created_by": "root"}},
+			upsert: true,
+			want: map[string][]string{
+				"$set":         {"modified_by", "name"},
+				"$currentDate": {"modify_at"},
+				"$setOnInsert": {"create_at", "created_by", "is_delete"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stampUpdate(tt.ctx, tt.update, tt.upsert)
+			if err != nil {
+				t.Fatalf("stampUpdate() error = %v", err)
+			}
+			if !reflect.DeepEqual(keys(got), tt.want) {
+				t.Errorf("stampUpdate() = %v, want keys %v", got, tt.want)
+			}
+		})
+	}
+
+	// 不修改调用方的更新内容
+	set := bson.M{"name": "zhe", "create_at": 1}
+	update := bson.M{"$set": set}
+	if _, err := stampUpdate(ctx, update, true); err != nil || len(update) != 1 || len(set) != 2 {
+		t.Errorf("stampUpdate() modified its input: %v, %v", update, err)
+	}
+	got, _ := stampUpdate(ctx, bson.M{"$setOnInsert": bson.M{"created_by": "root"}}, true)
+	if got["$setOnInsert"].(bson.M)[FieldCreatedBy] != "root" {
+		t.Errorf("stampUpdate() overwrote created_by: %v", got)
+	}
+}
@@ -0,0 +1,380 @@
+/*
+ * 说明：更新内容构建器
+ * 作者：agent
+ * 时间：2026-10-18 08:58
+ * 更新：UpdateBuilder 以链式方法生成 $set、$inc、$push 等更新内容, 检查字段路径冲突, 可按模型校验字段路径
+ */
+
+package dao
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Pop 删除的元素位置
+const (
+	PopFirst = -1 // 删除第一个元素
+	PopLast  = 1  // 删除最后一个元素
+)
+
+// arrayIdentifier arrayFilters 标识符: 小写字母开头, 只包含字母和数字
+var arrayIdentifier = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+
+// UpdateError 更新内容构建错误, errors.Is(err, ErrInvalidSelector) 为 true
+type UpdateError struct {
+	Op     string // 操作符, 如 $inc
+	Path   string // 字段路径
+	Reason string // 错误原因
+}
+
+func (e *UpdateError) Error() string {
+	return fmt.Sprintf("update %s %s: %s", e.Op, e.Path, e.Reason)
+}
+
+func (e *UpdateError) Unwrap() error {
+	return ErrInvalidSelector
+}
+
+// PushOptions PushEach 的修饰操作, 为 nil 的字段不使用
+type PushOptions struct {
+	Slice    *int        // $slice: 插入后保留的元素数量, 负数保留最后的元素
+	Sort     interface{} // $sort: 1、-1 或 bson.M{"field": 1}
+	Position *int        // $position: 插入的位置, 负数从末尾计算
+}
+
+// Positional 返回 $ 位置操作符的字段路径, 如 Positional("comments", "stars") => comments.$.stars
+// $ 代表 selector 匹配到的第一个数组元素, 因此 selector 中必须包含该数组字段的条件
+func Positional(array string, fields ...string) string {
+	return strings.Join(append([]string{array, "$"}, fields...), ".")
+}
+
+// Filtered 返回 $[identifier] 的字段路径, 如 Filtered("comments", "c", "stars") => comments.$[c].stars
+// 更新满足 ArrayFilter(identifier, ...) 的全部元素; identifier 为空时为 $[], 更新全部元素
+func Filtered(array, identifier string, fields ...string) string {
+	return strings.Join(append([]string{array, "$[" + identifier + "]"}, fields...), ".")
+}
+
+// UpdateBuilder 更新内容构建器, 可直接作为 Update、UpdateId、UpdateMany 等方法的 update 参数, 用法:
+//
+//	last := -5
+//	u := NewUpdateFor[model.User]().
+//		Set("address.city", "hangzhou").
+//		Inc("age", 1).
+//		PushEach("friends", []string{"A", "B"}, &PushOptions{Slice: &last})
+//	_, err := d.Update("users", bson.M{"account": "mongo_a"}, u)
+//
+// 同一个字段路径(或其父子路径)只能出现一次, 否则 MongoDB 会拒绝更新;
+// 链式方法出错时记录第一个错误并忽略后续调用, 由 Build(或使用它的 Update 等方法)返回
+// 使用了 ArrayFilter 时只能用于 Update、UpdateId、UpdateMany
+type UpdateBuilder struct {
+	policy  *FilterPolicy     // 模型的字段路径, nil 时不校验
+	doc     bson.M            // 操作符 => 字段路径 => 值
+	paths   map[string]string // 已使用的字段路径 => 操作符
+	filters map[string]bson.M // arrayFilters 标识符 => 条件
+	err     error
+}
+
+// NewUpdate 创建不校验字段路径的更新内容构建器
+func NewUpdate() *UpdateBuilder {
+	return &UpdateBuilder{doc: bson.M{}, paths: map[string]string{}, filters: map[string]bson.M{}}
+}
+
+// NewUpdateFor 创建按模型 T 的 bson 标签校验字段路径的更新内容构建器
+// 字段必须存在; Inc 的字段必须为数字, Push、AddToSet、Pull、Pop 的字段必须为数组, CurrentDate 的字段必须为时间
+func NewUpdateFor[T any]() *UpdateBuilder {
+	b := NewUpdate()
+	b.policy = newFieldPolicy(reflect.TypeOf((*T)(nil)).Elem(), true)
+	return b
+}
+
+// Set 设置字段的值($set)
+func (b *UpdateBuilder) Set(path string, value interface{}) *UpdateBuilder {
+	return b.add("$set", path, value, nil)
+}
+
+// Unset 删除字段($unset)
+func (b *UpdateBuilder) Unset(path string) *UpdateBuilder {
+	return b.add("$unset", path, "", nil)
+}
+
+// Inc 字段加上 n($inc), n 为数字, 负数为减
+func (b *UpdateBuilder) Inc(path string, n interface{}) *UpdateBuilder {
+	if !isNumber(reflect.TypeOf(n)) {
+		return b.fail("$inc", path, fmt.Sprintf("increment must be a number, got %T", n))
+	}
+	return b.add("$inc", path, n, isNumber)
+}
+
+// Rename 重命名字段($rename), from、to 都不能包含位置操作符
+func (b *UpdateBuilder) Rename(from, to string) *UpdateBuilder {
+	for _, p := range []string{from, to} {
+		if strings.Contains(p, "$") {
+			return b.fail("$rename", p, "positional operators are not allowed")
+		}
+	}
+	if from == to {
+		return b.fail("$rename", from, "source and target are the same")
+	}
+	if b.add("$rename", from, to, nil); b.err == nil {
+		b.claim("$rename", to, nil)
+	}
+	return b
+}
+
+// Push 向数组追加一个元素($push)
+func (b *UpdateBuilder) Push(path string, value interface{}) *UpdateBuilder {
+	return b.add("$push", path, value, isSlice)
+}
+
+// PushEach 向数组追加多个元素($push + $each), values 为切片; opts 为 nil 时不使用修饰操作
+func (b *UpdateBuilder) PushEach(path string, values interface{}, opts *PushOptions) *UpdateBuilder {
+	if values == nil || !isSlice(reflect.TypeOf(values)) {
+		return b.fail("$push", path, fmt.Sprintf("$each must be a slice, got %T", values))
+	}
+	each := bson.M{"$each": values}
+	if opts != nil {
+		if opts.Slice != nil {
+			each["$slice"] = *opts.Slice
+		}
+		if opts.Sort != nil {
+			each["$sort"] = opts.Sort
+		}
+		if opts.Position != nil {
+			each["$position"] = *opts.Position
+		}
+	}
+	return b.add("$push", path, each, isSlice)
+}
+
+// AddToSet 向数组添加不存在的元素($addToSet), 多个元素时使用 $each
+// 注: $addToSet 不支持 $slice、$sort、$position
+func (b *UpdateBuilder) AddToSet(path string, values ...interface{}) *UpdateBuilder {
+	switch len(values) {
+	case 0:
+		return b.fail("$addToSet", path, "no values")
+	case 1:
+		return b.add("$addToSet", path, values[0], isSlice)
+	}
+	return b.add("$addToSet", path, bson.M{"$each": values}, isSlice)
+}
+
+// Pull 删除数组中等于 cond 或满足 cond 条件(如 bson.M{"$gte": 6})的元素($pull)
+func (b *UpdateBuilder) Pull(path string, cond interface{}) *UpdateBuilder {
+	return b.add("$pull", path, cond, isSlice)
+}
+
+// Pop 删除数组的第一个(PopFirst)或最后一个(PopLast)元素($pop)
+func (b *UpdateBuilder) Pop(path string, end int) *UpdateBuilder {
+	if end != PopFirst && end != PopLast {
+		return b.fail("$pop", path, fmt.Sprintf("end must be PopFirst or PopLast, got %d", end))
+	}
+	return b.add("$pop", path, end, isSlice)
+}
+
+// CurrentDate 将字段设置为服务器的当前时间($currentDate)
+func (b *UpdateBuilder) CurrentDate(path string) *UpdateBuilder {
+	return b.add("$currentDate", path, true, func(t reflect.Type) bool { return isTime(indirectType(t)) })
+}
+
+// SetOnInsert 只在 upsert 插入新文档时设置字段的值($setOnInsert)
+func (b *UpdateBuilder) SetOnInsert(path string, value interface{}) *UpdateBuilder {
+	return b.add("$setOnInsert", path, value, nil)
+}
+
+// ArrayFilter 声明 $[identifier] 匹配的数组元素(arrayFilters), 字段路径见 Filtered
+// cond 为字段条件时相对于数组元素, 如 bson.M{"content": "x"} => {"c.content": "x"};
+// 为操作符文档(如 bson.M{"$gte": 6})或其它值时作用于元素本身
+func (b *UpdateBuilder) ArrayFilter(identifier string, cond interface{}) *UpdateBuilder {
+	if b.err != nil {
+		return b
+	}
+	if !arrayIdentifier.MatchString(identifier) {
+		return b.fail("arrayFilters", identifier, "identifier must start with a lowercase letter and contain only letters and digits")
+	}
+	if _, ok := b.filters[identifier]; ok {
+		return b.fail("arrayFilters", identifier, "identifier already defined")
+	}
+
+	filter := bson.M{identifier: cond}
+	if m, ok := cond.(bson.M); ok && len(m) > 0 {
+		var ops, plain int
+		for k := range m {
+			if strings.HasPrefix(k, "$") {
+				ops++
+			} else {
+				plain++
+			}
+		}
+		if ops > 0 && plain > 0 {
+			return b.fail("arrayFilters", identifier, "cannot mix operators and fields")
+		}
+		if plain > 0 {
+			filter = make(bson.M, len(m))
+			for k, v := range m {
+				filter[identifier+"."+k] = v
+			}
+		}
+	}
+	b.filters[identifier] = filter
+	return b
+}
+
+// Build 返回更新内容, 构建过程中出错、未使用任何操作符或 arrayFilters 与字段路径不对应时返回错误
+func (b *UpdateBuilder) Build() (bson.M, error) {
+	if b == nil {
+		return nil, errNull
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.doc) == 0 {
+		return nil, fmt.Errorf("%w: empty update document", ErrInvalidSelector)
+	}
+
+	used := map[string]bool{}
+	for _, path := range b.sortedPaths() {
+		for _, seg := range strings.Split(path, ".") {
+			if !strings.HasPrefix(seg, "$[") || seg == "$[]" {
+				continue
+			}
+			id := seg[2 : len(seg)-1]
+			if _, ok := b.filters[id]; !ok {
+				return nil, &UpdateError{Op: b.paths[path], Path: path, Reason: fmt.Sprintf("no array filter for identifier %s", id)}
+			}
+			used[id] = true
+		}
+	}
+	for id := range b.filters {
+		if !used[id] {
+			return nil, &UpdateError{Op: "arrayFilters", Path: id, Reason: "identifier is not used in any field path"}
+		}
+	}
+
+	doc := make(bson.M, len(b.doc))
+	for op, fields := range b.doc {
+		doc[op] = copyM(fields.(bson.M))
+	}
+	return doc, nil
+}
+
+// ArrayFilters 返回 ArrayFilter 声明的条件, 按标识符排序
+func (b *UpdateBuilder) ArrayFilters() []bson.M {
+	if b == nil || len(b.filters) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(b.filters))
+	for id := range b.filters {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	filters := make([]bson.M, len(ids))
+	for i, id := range ids {
+		filters[i] = copyM(b.filters[id])
+	}
+	return filters
+}
+
+// add 校验字段路径后加入 {op: {path: value}}; want 不为 nil 时按模型校验字段类型
+func (b *UpdateBuilder) add(op, path string, value interface{}, want func(reflect.Type) bool) *UpdateBuilder {
+	if b.claim(op, path, want); b.err != nil {
+		return b
+	}
+	fields, _ := b.doc[op].(bson.M)
+	if fields == nil {
+		fields = bson.M{}
+		b.doc[op] = fields
+	}
+	fields[path] = value
+	return b
+}
+
+// claim 校验并占用字段路径
+func (b *UpdateBuilder) claim(op, path string, want func(reflect.Type) bool) {
+	if b.err != nil {
+		return
+	}
+	if err := b.check(op, path, want); err != nil {
+		b.err = err
+		return
+	}
+	b.paths[path] = op
+}
+
+// check 校验字段路径的格式、是否与已使用的路径冲突, 以及是否为模型的字段
+func (b *UpdateBuilder) check(op, path string, want func(reflect.Type) bool) error {
+	segs := strings.Split(path, ".")
+	for i, seg := range segs {
+		if seg == "" || strings.HasPrefix(seg, "$") && (i == 0 || !isPositional(seg)) {
+			return &UpdateError{Op: op, Path: path, Reason: "invalid field path"}
+		}
+	}
+	if segs[0] == "_id" && op != "$setOnInsert" {
+		return &UpdateError{Op: op, Path: path, Reason: "_id is immutable"}
+	}
+	for _, p := range b.sortedPaths() {
+		if p == path || strings.HasPrefix(p, path+".") || strings.HasPrefix(path, p+".") {
+			return &UpdateError{Op: op, Path: path, Reason: fmt.Sprintf("conflicts with %s %s", b.paths[p], p)}
+		}
+	}
+
+	if b.policy == nil {
+		return nil
+	}
+	// 位置操作符按数组下标查找元素类型
+	for i, seg := range segs {
+		if isPositional(seg) {
+			segs[i] = "0"
+		}
+	}
+	t, ok := b.policy.lookup(strings.Join(segs, "."))
+	if !ok {
+		return &UpdateError{Op: op, Path: path, Reason: "unknown field"}
+	}
+	if want != nil && !want(t) {
+		return &UpdateError{Op: op, Path: path, Reason: fmt.Sprintf("field type %s is not supported", typeName(t))}
+	}
+	return nil
+}
+
+func (b *UpdateBuilder) fail(op, path, reason string) *UpdateBuilder {
+	if b.err == nil {
+		b.err = &UpdateError{Op: op, Path: path, Reason: reason}
+	}
+	return b
+}
+
+func (b *UpdateBuilder) sortedPaths() []string {
+	paths := make([]string, 0, len(b.paths))
+	for p := range b.paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// isPositional 是否为位置操作符: $、$[]、$[identifier]
+func isPositional(seg string) bool {
+	if seg == "$" || seg == "$[]" {
+		return true
+	}
+	return strings.HasPrefix(seg, "$[") && strings.HasSuffix(seg, "]") && arrayIdentifier.MatchString(seg[2:len(seg)-1])
+}
+
+func isNumber(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	switch indirectType(t).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,138 @@
+/*
+ * 说明：更新内容构建器单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:58
+ * 更新：
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+	"mongodb.golang.com/src/model"
+)
+
+func TestUpdateBuilder(t *testing.T) {
+	last, first := -5, 0
+	tests := []struct {
+		name string
+		b    *UpdateBuilder
+		want bson.M
+	}{
+		{"set inc", NewUpdateFor[model.User]().Set("name", "mongo").Inc("age", 6),
+			bson.M{"$set": bson.M{"name": "mongo"}, "$inc": bson.M{"age": 6}}},
+		{"unset rename", NewUpdate().Unset("password").Rename("book", "movies"),
+			bson.M{"$unset": bson.M{"password": ""}, "$rename": bson.M{"book": "movies"}}},
+		{"push each", NewUpdateFor[model.User]().PushEach("friends", []string{"A", "B"}, &PushOptions{Slice: &last, Sort: 1, Position: &first}),
+			bson.M{"$push": bson.M{"friends": bson.M{"$each": []string{"A", "B"}, "$slice": -5, "$sort": 1, "$position": 0}}}},
+		{"add to set", NewUpdateFor[model.User]().AddToSet("friends", "A", "B").Pop("comments", PopFirst),
+			bson.M{"$addToSet": bson.M{"friends": bson.M{"$each": []interface{}{"A", "B"}}}, "$pop": bson.M{"comments": -1}}},
+		{"positional", NewUpdateFor[model.User]().Set(Positional("comments", "content"), "x").CurrentDate(Positional("comments", "modify_at")),
+			bson.M{"$set": bson.M{"comments.$.content": "x"}, "$currentDate": bson.M{"comments.$.modify_at": true}}},
+		{"set on insert", NewUpdateFor[model.User]().SetOnInsert("_id", "x").Pull("friends", bson.M{"$in": []string{"A"}}),
+			bson.M{"$setOnInsert": bson.M{"_id": "x"}, "$pull": bson.M{"friends": bson.M{"$in": []string{"A"}}}}},
+		{"hidden field", NewUpdateFor[model.User]().Set("is_delete", false),
+			bson.M{"$set": bson.M{"is_delete": false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.b.Build()
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Build() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateBuilderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		b    *UpdateBuilder
+	}{
+		{"empty", NewUpdate()},
+		{"same path", NewUpdate().Set("age", 1).Inc("age", 1)},
+		{"parent path", NewUpdate().Set("address", bson.M{}).Set("address.city", "hangzhou")},
+		{"rename target", NewUpdate().Rename("name", "nick").Set("nick", "x")},
+		{"positional rename", NewUpdate().Rename("comments.$.content", "text")},
+		{"invalid path", NewUpdate().Set("a..b", 1)},
+		{"operator path", NewUpdate().Set("$set", 1)},
+		{"immutable _id", NewUpdate().Set("_id", bson.NewObjectId())},
+		{"unknown field", NewUpdateFor[model.User]().Set("book", "golang")},
+		{"inc not number", NewUpdateFor[model.User]().Inc("name", 1)},
+		{"inc value", NewUpdate().Inc("age", "1")},
+		{"push not array", NewUpdateFor[model.User]().Push("address", "x")},
+		{"each not slice", NewUpdate().PushEach("friends", "A", nil)},
+		{"pop end", NewUpdate().Pop("friends", 2)},
+		{"add to set empty", NewUpdate().AddToSet("friends")},
+		{"current date", NewUpdateFor[model.User]().CurrentDate("age")},
+		{"missing filter", NewUpdate().Set(Filtered("comments", "c", "stars"), 6)},
+		{"unused filter", NewUpdate().Set("age", 1).ArrayFilter("c", bson.M{"stars": 6})},
+		{"bad identifier", NewUpdate().Set(Filtered("comments", "C", "stars"), 6)},
+		{"duplicate filter", NewUpdate().ArrayFilter("c", 1).ArrayFilter("c", 2)},
+		{"first error kept", NewUpdate().Inc("age", nil).Set("name", "x")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.b.Build(); !errors.Is(err, ErrInvalidSelector) {
+				t.Errorf("Build() = %v, %v, want ErrInvalidSelector", got, err)
+			}
+		})
+	}
+
+	var ue *UpdateError
+	if _, err := NewUpdate().Set("age", 1).Unset("age").Build(); !errors.As(err, &ue) || ue.Op != "$unset" || ue.Path != "age" {
+		t.Errorf("Build() error = %v, want UpdateError for $unset age", err)
+	}
+}
+
+func TestUpdateBuilderArrayFilters(t *testing.T) {
+	b := NewUpdateFor[model.User]().
+		Set(Filtered("comments", "c", "content"), "x").
+		Set(Filtered("friends", "f"), "Y").
+		ArrayFilter("f", bson.M{"$ne": "You"}).
+		ArrayFilter("c", bson.M{"content": "This is a comment"})
+	doc, err := b.Build()
+	if err != nil || !reflect.DeepEqual(doc, bson.M{"$set": bson.M{"comments.$[c].content": "x", "friends.$[f]": "Y"}}) {
+		t.Errorf("Build() = %v, %v", doc, err)
+	}
+	want := []bson.M{{"c.content": "This is a comment"}, {"f": bson.M{"$ne": "You"}}}
+	if got := b.ArrayFilters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ArrayFilters() = %v, want %v", got, want)
+	}
+
+	// 只有 Update 等方法支持 arrayFilters
+	if _, err := updateDocument(b); !errors.Is(err, ErrInvalidSelector) {
+		t.Errorf("updateDocument(arrayFilters) error = %v, want ErrInvalidSelector", err)
+	}
+	if got, err := updateDocument(NewUpdate().Set(Filtered("friends", ""), "Y")); err != nil ||
+		!reflect.DeepEqual(got, bson.M{"$set": bson.M{"friends.$[]": "Y"}}) {
+		t.Errorf("updateDocument($[]) = %v, %v", got, err)
+	}
+}
+
+func TestUpdateBuilderUpdate(t *testing.T) {
+	d := &Dao{}
+	id := bson.NewObjectId()
+	// 构建错误在访问数据库之前返回
+	if _, err := d.UpdateId("users", id, NewUpdate().Inc("age", "1")); !errors.Is(err, ErrInvalidSelector) {
+		t.Errorf("UpdateId(invalid builder) error = %v, want ErrInvalidSelector", err)
+	}
+	if _, err := d.Update("users", "id", NewUpdate().Set("age", 1)); !errors.Is(err, errUnSupportType) {
+		t.Errorf("Update(bad selector) error = %v, want errUnSupportType", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	b := NewUpdate().Set(Filtered("comments", "c", "stars"), 6).ArrayFilter("c", bson.M{"stars": 5})
+	if _, err := d.UpdateManyCtx(ctx, "users", bson.M{}, b); !errors.Is(err, context.Canceled) {
+		t.Errorf("UpdateManyCtx(arrayFilters) error = %v, want context.Canceled", err)
+	}
+	if _, err := d.UpsertDoc("users", id, b); !errors.Is(err, ErrInvalidSelector) {
+		t.Errorf("UpsertDoc(arrayFilters) error = %v, want ErrInvalidSelector", err)
+	}
+}
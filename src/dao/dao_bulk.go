@@ -0,0 +1,484 @@
+/*
+ * 说明：批量写入
+ * 作者：agent
+ * 时间：2026-10-18 08:43
+ * 更新：基于 mgo.Bulk 批量插入、更新、删除, 按 1000 个操作/16MB 自动分批, 返回每个操作的执行结果
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 每批最多的操作数量及字节数(MongoDB 的限制为 1000 个写操作、16MB, 留出命令本身的空间)
+const (
+	DefaultBulkMaxOps   = 1000
+	DefaultBulkMaxBytes = 16*1024*1024 - 16*1024
+)
+
+// ErrBulkSkipped 有序执行时, 之前的操作失败导致未执行的操作
+var ErrBulkSkipped = errors.New("skipped after an earlier failure")
+
+// BulkOp 批量写入的操作类型
+type BulkOp int
+
+const (
+	BulkInsert    BulkOp = iota // 插入文档
+	BulkUpdate                  // 更新匹配到的第一个文档
+	BulkUpdateAll               // 更新匹配到的全部文档
+	BulkUpsert                  // 更新匹配到的第一个文档, 不存在时插入
+	BulkRemove                  // 删除匹配到的第一个文档
+	BulkRemoveAll               // 删除匹配到的全部文档
+)
+
+var bulkOpNames = [...]string{"insert", "update", "updateAll", "upsert", "remove", "removeAll"}
+
+// String 实现 fmt.Stringer
+func (op BulkOp) String() string {
+	if op >= 0 && int(op) < len(bulkOpNames) {
+		return bulkOpNames[op]
+	}
+	return fmt.Sprintf("BulkOp(%d)", int(op))
+}
+
+// Bulk 批量写入, 由 Dao.Bulk 创建; 依次加入操作后调用 Run 执行, 例如:
+//
+//	report, err := d.Bulk("users").Unordered().
+//		Insert(u1, u2).
+//		Update(bson.M{"account": "mongo_1"}, bson.M{"$inc": bson.M{"age": 1}}).
+//		Remove(bson.M{"account": "mongo_2"}).
+//		Run(ctx)
+//
+// 插入、更新时自动写入审计字段(同 CreateDoc、Update、UpsertDoc); 删除为物理删除
+type Bulk struct {
+	MaxOps   int // 每批最多的操作数量, 默认为 DefaultBulkMaxOps
+	MaxBytes int // 每批最多的字节数, 默认为 DefaultBulkMaxBytes
+
+	dao     *Dao
+	name    string
+	ordered bool
+	entries []bulkEntry
+}
+
+type bulkEntry struct {
+	op       BulkOp
+	doc      interface{} // 插入的文档
+	selector interface{} // bson.M 或 bson.ObjectId
+	update   interface{}
+}
+
+// Bulk 创建集合 name 的批量写入, 默认有序执行: 某个操作失败后不再执行之后的操作
+func (d *Dao) Bulk(name string) *Bulk {
+	return &Bulk{dao: d, name: name, ordered: true}
+}
+
+// Unordered 改为无序执行: 某个操作失败时继续执行其它操作, 同类操作合并发送, 适合导入数据
+func (b *Bulk) Unordered() *Bulk {
+	b.ordered = false
+	return b
+}
+
+// Insert 加入插入操作, docs 为结构体或 bson.M; 未指定 _id 时自动生成
+func (b *Bulk) Insert(docs ...interface{}) *Bulk {
+	for _, doc := range docs {
+		b.entries = append(b.entries, bulkEntry{op: BulkInsert, doc: doc})
+	}
+	return b
+}
+
+// Update 加入更新操作, 更新匹配到的第一个文档; update 规则同 Dao.Update
+func (b *Bulk) Update(selector, update interface{}) *Bulk {
+	return b.add(BulkUpdate, selector, update)
+}
+
+// UpdateAll 加入更新操作, 更新匹配到的全部文档; update 规则同 Dao.Update
+func (b *Bulk) UpdateAll(selector, update interface{}) *Bulk {
+	return b.add(BulkUpdateAll, selector, update)
+}
+
+// Upsert 加入更新操作, 不存在匹配的文档时插入; update 规则同 UpsertDoc
+func (b *Bulk) Upsert(selector, update interface{}) *Bulk {
+	return b.add(BulkUpsert, selector, update)
+}
+
+// Remove 加入删除操作, 删除匹配到的第一个文档
+func (b *Bulk) Remove(selector interface{}) *Bulk {
+	return b.add(BulkRemove, selector, nil)
+}
+
+// RemoveAll 加入删除操作, 删除匹配到的全部文档
+func (b *Bulk) RemoveAll(selector interface{}) *Bulk {
+	return b.add(BulkRemoveAll, selector, nil)
+}
+
+func (b *Bulk) add(op BulkOp, selector, update interface{}) *Bulk {
+	b.entries = append(b.entries, bulkEntry{op: op, selector: selector, update: update})
+	return b
+}
+
+// Len 返回已加入的操作数量
+func (b *Bulk) Len() int {
+	return len(b.entries)
+}
+
+// BulkResult 单个操作的执行结果
+type BulkResult struct {
+	Index int         // 操作的序号(按加入的顺序, 从 0 开始)
+	Op    BulkOp      // 操作类型
+	Id    interface{} // 插入文档的 _id; Upsert 未在条件中指定 _id 且插入了新文档时为新文档的 _id
+	Err   error       // 失败的原因(*Error, 可用 errors.Is 判断, 如 ErrDuplicateKey); 未执行时为 ErrBulkSkipped
+}
+
+// BulkReport 批量写入的执行结果
+type BulkReport struct {
+	Inserted int // 插入的文档数量
+	Matched  int // 更新操作匹配到的文档数量(不含 Upserted)
+	Modified int // 更新操作实际修改的文档数量
+	Upserted int // Upsert 插入的文档数量
+	Removed  int // 删除的文档数量
+
+	// Incomplete 有批次执行失败, mgo 不返回该批次的 Matched、Modified、Removed, 上面的数量不包含该批次
+	Incomplete bool
+
+	Results []BulkResult // 按加入的顺序, 每个操作一项
+}
+
+// Failed 返回执行失败的操作, 不含未执行(ErrBulkSkipped)的操作
+func (r *BulkReport) Failed() []BulkResult {
+	var failed []BulkResult
+	for _, res := range r.Results {
+		if res.Err != nil && !errors.Is(res.Err, ErrBulkSkipped) {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+// Run 分批执行已加入的操作, 返回每个操作的结果
+// 有操作失败时同时返回 error(包装第一个失败的原因), 此时 report 仍然有效; ctx 结束时不再执行之后的批次
+func (b *Bulk) Run(ctx context.Context) (*BulkReport, error) {
+	report := &BulkReport{Results: make([]BulkResult, len(b.entries))}
+	ops := make([]*bulkPrepared, len(b.entries))
+	for i, e := range b.entries {
+		ops[i] = prepareBulk(ctx, b.dao, b.name, e, b.maxBytes())
+		report.Results[i] = BulkResult{Index: i, Op: e.op, Id: ops[i].id}
+		if ops[i].err != nil {
+			report.Results[i].Err = opError("Bulk", b.name, ops[i].err)
+		}
+	}
+
+	var stopped bool // 有序执行时有操作失败, 或 ctx 已结束
+	var ctxErr error
+	for _, chunk := range planBulk(ops, b.ordered, b.maxOps(), b.maxBytes()) {
+		if chunk[0].err != nil { // 无效的操作单独为一批, 不发送
+			stopped = stopped || b.ordered
+			continue
+		}
+		if !stopped {
+			if ctxErr = ctx.Err(); ctxErr != nil {
+				stopped = true
+			}
+		}
+		if stopped {
+			for _, p := range chunk {
+				report.Results[p.index].Err = ErrBulkSkipped
+			}
+			continue
+		}
+		if !b.runChunk(ctx, chunk, report) && b.ordered {
+			stopped = true
+		}
+	}
+
+	var first error
+	failed := 0
+	for _, res := range report.Results {
+		if res.Err != nil && !errors.Is(res.Err, ErrBulkSkipped) {
+			if first == nil {
+				first = res.Err
+			}
+			failed++
+		}
+	}
+	if failed > 0 {
+		return report, opError("Bulk", b.name, fmt.Errorf("%d of %d operations failed: %w", failed, len(ops), first))
+	}
+	if ctxErr != nil {
+		return report, opError("Bulk", b.name, ctxErr)
+	}
+	return report, nil
+}
+
+func (b *Bulk) maxOps() int {
+	if b.MaxOps > 0 && b.MaxOps < DefaultBulkMaxOps {
+		return b.MaxOps
+	}
+	return DefaultBulkMaxOps
+}
+
+func (b *Bulk) maxBytes() int {
+	if b.MaxBytes > 0 && b.MaxBytes < DefaultBulkMaxBytes {
+		return b.MaxBytes
+	}
+	return DefaultBulkMaxBytes
+}
+
+// bulkPrepared 写入审计字段、转换选择条件后的操作
+type bulkPrepared struct {
+	index     int
+	op        BulkOp
+	doc       bson.M // 插入的文档
+	selector  bson.M
+	update    bson.M
+	id        interface{}
+	generated bool // upsert 的 _id 由 $setOnInsert 指定, 据此判断是否插入了新文档
+	size      int
+	err       error
+}
+
+// prepareBulk 转换操作并计算大小, 单个操作超过 maxBytes 时记录错误
+func prepareBulk(ctx context.Context, d *Dao, name string, e bulkEntry, maxBytes int) *bulkPrepared {
+	p := &bulkPrepared{op: e.op}
+	var err error
+	switch e.op {
+	case BulkInsert:
+		if p.doc, err = d.prepareInsert(ctx, name, e.doc); err == nil {
+			if p.doc["_id"] == nil {
+				p.doc["_id"] = bson.NewObjectId()
+			}
+			p.id = p.doc["_id"]
+			p.size, err = bsonSize(p.doc)
+		}
+	case BulkRemove, BulkRemoveAll:
+		if p.selector, err = idSelector(e.selector); err == nil {
+			p.size, err = bsonSize(p.selector)
+		}
+	default:
+		if e.update == nil {
+			err = errNull
+			break
+		}
+		if p.selector, err = idSelector(e.selector); err != nil {
+			break
+		}
+		upsert := e.op == BulkUpsert
+		if p.update, err = d.prepareUpdate(ctx, name, e.update, upsert); err != nil {
+			break
+		}
+		if upsert {
+			err = p.generateId()
+		}
+		if err == nil {
+			var n, m int
+			if n, err = bsonSize(p.selector); err == nil {
+				m, err = bsonSize(p.update)
+				p.size = n + m
+			}
+		}
+	}
+	if err == nil && p.size > maxBytes {
+		err = fmt.Errorf("%w: %s operation is %d bytes, exceeds %d", ErrInvalidSelector, e.op, p.size, maxBytes)
+	}
+	p.err = err
+	return p
+}
+
+// generateId 条件及 $setOnInsert 均未指定 _id 时, 在 $setOnInsert 中指定新的 _id
+func (p *bulkPrepared) generateId() error {
+	if _, ok := p.selector["_id"]; ok {
+		return nil
+	}
+	onInsert, err := operatorFields(p.update, "$setOnInsert")
+	if err != nil {
+		return err
+	}
+	if _, ok := onInsert["_id"]; ok {
+		return nil
+	}
+	p.id = bson.NewObjectId()
+	p.generated = true
+	onInsert["_id"] = p.id
+	p.update["$setOnInsert"] = onInsert
+	return nil
+}
+
+func bsonSize(doc interface{}) (int, error) {
+	data, err := bson.Marshal(doc)
+	return len(data), err
+}
+
+// planBulk 将操作分批: 每批为同一类型的连续操作, 不超过 maxOps 个、maxBytes 字节; 无效的操作单独为一批
+// 无序执行时先按类型(稳定)排序, 以减少批次
+func planBulk(ops []*bulkPrepared, ordered bool, maxOps, maxBytes int) [][]*bulkPrepared {
+	sorted := make([]*bulkPrepared, len(ops))
+	for i, p := range ops {
+		p.index = i
+		sorted[i] = p
+	}
+	if !ordered {
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return sorted[i].op < sorted[j].op
+		})
+	}
+
+	var steps [][]*bulkPrepared
+	var chunk []*bulkPrepared
+	size := 0
+	flush := func() {
+		if len(chunk) > 0 {
+			steps = append(steps, chunk)
+			chunk, size = nil, 0
+		}
+	}
+	for _, p := range sorted {
+		if p.err != nil {
+			flush()
+			steps = append(steps, []*bulkPrepared{p})
+			continue
+		}
+		if len(chunk) > 0 && (chunk[0].op != p.op || len(chunk) == maxOps || size+p.size > maxBytes) {
+			flush()
+		}
+		chunk = append(chunk, p)
+		size += p.size
+	}
+	flush()
+	return steps
+}
+
+// bulkOutcome 一批操作的执行结果
+type bulkOutcome struct {
+	res      *mgo.BulkResult
+	err      error
+	upserted map[interface{}]bool // 插入了新文档的 upsert 的 _id
+}
+
+// runChunk 执行一批操作并写入 report, 有操作失败时返回 false
+func (b *Bulk) runChunk(ctx context.Context, chunk []*bulkPrepared, report *BulkReport) bool {
+	out := make(chan bulkOutcome, 1)
+	err := b.dao.withSessionCtx(ctx, func(session *mgo.Session) error {
+		co := session.DB(b.dao.Name).C(b.name)
+		bulk := co.Bulk()
+		if !b.ordered {
+			bulk.Unordered()
+		}
+		var ids []interface{}
+		for _, p := range chunk {
+			switch p.op {
+			case BulkInsert:
+				bulk.Insert(p.doc)
+			case BulkUpdate:
+				bulk.Update(p.selector, p.update)
+			case BulkUpdateAll:
+				bulk.UpdateAll(p.selector, p.update)
+			case BulkUpsert:
+				bulk.Upsert(p.selector, p.update)
+				if p.generated {
+					ids = append(ids, p.id)
+				}
+			case BulkRemove:
+				bulk.Remove(p.selector)
+			case BulkRemoveAll:
+				bulk.RemoveAll(p.selector)
+			}
+		}
+		o := bulkOutcome{}
+		o.res, o.err = bulk.Run()
+		if len(ids) > 0 {
+			// 生成的 _id 是新的, 存在即说明插入了新文档
+			var docs []struct {
+				Id interface{} `bson:"_id"`
+			}
+			if err := co.Find(bson.M{"_id": bson.M{"$in": ids}}).Select(bson.M{"_id": 1}).All(&docs); err == nil {
+				o.upserted = make(map[interface{}]bool, len(docs))
+				for _, doc := range docs {
+					o.upserted[doc.Id] = true
+				}
+			}
+		}
+		out <- o
+		return o.err
+	})
+
+	var o bulkOutcome
+	select {
+	case o = <-out:
+	default: // ctx 结束时未等待执行完成, 结果未知
+		report.Incomplete = true
+		for _, p := range chunk {
+			report.Results[p.index].Err = opError("Bulk", b.name, err)
+		}
+		return false
+	}
+
+	failed := chunkErrors(o.err, len(chunk), b.ordered)
+	for i, p := range chunk {
+		res := &report.Results[p.index]
+		if e, ok := failed[i]; ok {
+			if e != ErrBulkSkipped {
+				e = opError("Bulk", b.name, e)
+			}
+			res.Err = e
+		}
+		if p.op == BulkUpsert && p.generated && !o.upserted[p.id] {
+			res.Id = nil
+		}
+	}
+
+	upserted := len(o.upserted)
+	report.Upserted += upserted
+	switch op := chunk[0].op; {
+	case op == BulkInsert:
+		report.Inserted += len(chunk) - len(failed)
+	case o.res == nil:
+		report.Incomplete = true
+	case op == BulkRemove || op == BulkRemoveAll:
+		report.Removed += o.res.Matched
+	default:
+		report.Matched += max(o.res.Matched-upserted, 0)
+		report.Modified += o.res.Modified
+	}
+	return len(failed) == 0
+}
+
+// chunkErrors 返回一批操作中失败的操作(批内序号)及原因
+// 有序执行时第一个失败之后的操作未执行(ErrBulkSkipped); 无法对应到操作的错误(如网络错误)视为全部失败
+func chunkErrors(err error, n int, ordered bool) map[int]error {
+	failed := map[int]error{}
+	if err == nil {
+		return failed
+	}
+	var berr *mgo.BulkError
+	if !errors.As(err, &berr) {
+		for i := 0; i < n; i++ {
+			failed[i] = err
+		}
+		return failed
+	}
+	first := n
+	for _, c := range berr.Cases() {
+		if c.Index < 0 || c.Index >= n {
+			for i := 0; i < n; i++ {
+				failed[i] = c.Err
+			}
+			return failed
+		}
+		failed[c.Index] = c.Err
+		first = min(first, c.Index)
+	}
+	if ordered {
+		for i := first + 1; i < n; i++ {
+			if _, ok := failed[i]; !ok {
+				failed[i] = ErrBulkSkipped
+			}
+		}
+	}
+	return failed
+}
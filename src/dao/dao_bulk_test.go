@@ -0,0 +1,141 @@
+/*
+ * 说明：批量写入单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:43
+ * 更新：
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+	"mongodb.golang.com/src/model"
+)
+
+func TestPrepareBulk(t *testing.T) {
+	ctx := WithActor(context.Background(), "admin")
+	id := bson.NewObjectId()
+	d := &Dao{}
+
+	ins := prepareBulk(ctx, d, "users", bulkEntry{op: BulkInsert, doc: model.User{Account: "mongo_0"}}, DefaultBulkMaxBytes)
+	if ins.err != nil || ins.id == nil || ins.doc["_id"] != ins.id || ins.doc[FieldCreatedBy] != "admin" || ins.size == 0 {
+		t.Errorf("prepareBulk(insert) = %+v", ins)
+	}
+
+	up := prepareBulk(ctx, d, "users", bulkEntry{op: BulkUpsert, selector: bson.M{"account": "mongo_1"}, update: bson.M{"age": 18}}, DefaultBulkMaxBytes)
+	onInsert, _ := up.update["$setOnInsert"].(bson.M)
+	if up.err != nil || !up.generated || onInsert["_id"] != up.id || onInsert[FieldCreateAt] == nil {
+		t.Errorf("prepareBulk(upsert) = %+v", up)
+	}
+	// 条件中指定了 _id 时不生成
+	if p := prepareBulk(ctx, d, "users", bulkEntry{op: BulkUpsert, selector: id, update: bson.M{"age": 18}}, DefaultBulkMaxBytes); p.err != nil || p.generated || p.id != nil {
+		t.Errorf("prepareBulk(upsert by id) = %+v", p)
+	}
+
+	rm := prepareBulk(ctx, d, "users", bulkEntry{op: BulkRemove, selector: id}, DefaultBulkMaxBytes)
+	if rm.err != nil || !reflect.DeepEqual(rm.selector, bson.M{"_id": id}) {
+		t.Errorf("prepareBulk(remove) = %+v", rm)
+	}
+
+	errTests := []struct {
+		name string
+		e    bulkEntry
+		want error
+	}{
+		{"nil update", bulkEntry{op: BulkUpdate, selector: id}, errNull},
+		{"bad selector", bulkEntry{op: BulkRemoveAll, selector: "id"}, errUnSupportType},
+		{"mixed update", bulkEntry{op: BulkUpdate, selector: id, update: bson.M{"$inc": bson.M{"age": 1}, "name": "zhe"}}, ErrInvalidSelector},
+		{"bad doc", bulkEntry{op: BulkInsert, doc: 1}, ErrInvalidSelector},
+		{"too large", bulkEntry{op: BulkInsert, doc: bson.M{"name": strings.Repeat("x", 200)}}, ErrInvalidSelector},
+	}
+	for _, tt := range errTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if p := prepareBulk(ctx, d, "users", tt.e, 128); !errors.Is(p.err, tt.want) {
+				t.Errorf("prepareBulk() error = %v, want %v", p.err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanBulk(t *testing.T) {
+	op := func(kind BulkOp, size int) *bulkPrepared {
+		return &bulkPrepared{op: kind, size: size}
+	}
+	invalid := &bulkPrepared{op: BulkUpdate, err: errNull}
+	tests := []struct {
+		name     string
+		ops      []*bulkPrepared
+		ordered  bool
+		maxOps   int
+		maxBytes int
+		want     [][]int
+	}{
+		{"split by kind", []*bulkPrepared{op(BulkInsert, 1), op(BulkInsert, 1), op(BulkUpdate, 1), op(BulkInsert, 1)},
+			true, 1000, 1000, [][]int{{0, 1}, {2}, {3}}},
+		{"unordered groups kinds", []*bulkPrepared{op(BulkRemove, 1), op(BulkInsert, 1), op(BulkUpdate, 1), op(BulkInsert, 1)},
+			false, 1000, 1000, [][]int{{1, 3}, {2}, {0}}},
+		{"max ops", []*bulkPrepared{op(BulkInsert, 1), op(BulkInsert, 1), op(BulkInsert, 1)},
+			true, 2, 1000, [][]int{{0, 1}, {2}}},
+		{"max bytes", []*bulkPrepared{op(BulkInsert, 60), op(BulkInsert, 60), op(BulkInsert, 30)},
+			true, 1000, 100, [][]int{{0}, {1, 2}}},
+		{"invalid alone", []*bulkPrepared{op(BulkUpdate, 1), invalid, op(BulkUpdate, 1)},
+			true, 1000, 1000, [][]int{{0}, {1}, {2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]int
+			for _, chunk := range planBulk(tt.ops, tt.ordered, tt.maxOps, tt.maxBytes) {
+				var idx []int
+				for _, p := range chunk {
+					idx = append(idx, p.index)
+				}
+				got = append(got, idx)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planBulk() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChunkErrors(t *testing.T) {
+	if got := chunkErrors(nil, 3, true); len(got) != 0 {
+		t.Errorf("chunkErrors(nil) = %v", got)
+	}
+	// 无法对应到操作的错误视为全部失败
+	err := errors.New("connection reset")
+	if got := chunkErrors(err, 2, false); len(got) != 2 || got[0] != err || got[1] != err {
+		t.Errorf("chunkErrors(network) = %v", got)
+	}
+}
+
+func TestBulkRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err := (&Dao{}).Bulk("users").
+		Insert(bson.M{"account": "mongo_0"}).
+		Update(bson.NewObjectId(), nil).
+		Remove(bson.M{"account": "mongo_1"}).
+		Run(ctx)
+	if !errors.Is(err, errNull) {
+		t.Errorf("Run() error = %v, want errNull", err)
+	}
+	if len(report.Results) != 3 || report.Results[0].Id == nil {
+		t.Fatalf("Run() report = %+v", report)
+	}
+	for i, want := range []error{ErrBulkSkipped, errNull, ErrBulkSkipped} {
+		if got := report.Results[i].Err; !errors.Is(got, want) {
+			t.Errorf("Results[%d].Err = %v, want %v", i, got, want)
+		}
+	}
+	if failed := report.Failed(); len(failed) != 1 || failed[0].Index != 1 || failed[0].Op != BulkUpdate {
+		t.Errorf("Failed() = %+v", failed)
+	}
+}
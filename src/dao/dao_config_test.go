@@ -0,0 +1,182 @@
+/*
+ * 说明：数据库配置加载单元测试
+ * 作者：agent
+ * 时间：2026-10-18 07:57
+ * 更新：
+ */
+
+package dao
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testYaml = `
+default:
+  name: mongo
+  addrs: [127.0.0.1:27017]
+test:
+  name: mongo_test
+prod:
+  addrs: [db1:27017, db2:27017]
+  enable_rs: true
+  rs_name: rs0
+  mode: strong
+  write_concern:
+    w: 2
+    j: true
+    wtimeout: 3s
+`
+
+func writeTestYaml(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "dao_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "db.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeTestYaml(t, testYaml)
+
+	type args struct {
+		profile string
+		env     map[string]string
+		flags   []string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    *MongoDB
+		wantErr bool
+	}{
+		{
+			name: "default profile",
+			args: args{},
+			want: DefaultConfig(),
+		},
+		{
+			name: "test profile",
+			args: args{profile: "test"},
+			want: func() *MongoDB { m := DefaultConfig(); m.Name = "mongo_test"; return m }(),
+		},
+		{
+			name: "prod profile",
+			args: args{profile: "prod"},
+			want: func() *MongoDB {
+				m := DefaultConfig()
+				m.Adds = addrs{"db1:27017", "db2:27017"}
+				m.EnableRepSet, m.RepSetName = true, "rs0"
+				m.Mode = "strong"
+				m.WriteConcern = WriteConcern{W: "2", J: true, WTimeout: 3 * time.Second}
+				return m
+			}(),
+		},
+		{
+			name: "profile from env",
+			args: args{env: map[string]string{EnvProfile: "test"}},
+			want: func() *MongoDB { m := DefaultConfig(); m.Name = "mongo_test"; return m }(),
+		},
+		{
+			name: "env overrides yaml",
+			args: args{profile: "test", env: map[string]string{EnvName: "from_env", EnvAddrs: "a:1, b:2"}},
+			want: func() *MongoDB { m := DefaultConfig(); m.Name, m.Adds = "from_env", addrs{"a:1", "b:2"}; return m }(),
+		},
+		{
+			name: "flags override env",
+			args: args{
+				env:   map[string]string{EnvName: "from_env"},
+				flags: []string{"-db_name", "from_flag", "-db_addr", "x:1", "-db_addr", "y:2"},
+			},
+			want: func() *MongoDB { m := DefaultConfig(); m.Name, m.Adds = "from_flag", addrs{"x:1", "y:2"}; return m }(),
+		},
+		{
+			name: "unset flags keep yaml",
+			args: args{profile: "test", flags: []string{"-db_auth"}},
+			want: func() *MongoDB { m := DefaultConfig(); m.Name, m.EnableAuth = "mongo_test", true; return m }(),
+		},
+		{
+			name: "env uri then env fields",
+			args: args{env: map[string]string{EnvURI: "mongodb://u:p@h1:1,h2:2/uridb", EnvName: "from_env"}},
+			want: func() *MongoDB {
+				m := DefaultConfig()
+				m.Name, m.Adds = "from_env", addrs{"h1:1", "h2:2"}
+				m.Username, m.Password, m.EnableAuth = "u", "p", true
+				return m
+			}(),
+		},
+		{
+			name:    "unknown profile",
+			args:    args{profile: "staging"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid env bool",
+			args:    args{env: map[string]string{EnvEnableAuth: "maybe"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Unsetenv(EnvProfile)
+			for k, v := range tt.args.env {
+				t.Setenv(k, v)
+			}
+
+			fs := flag.NewFlagSet(tt.name, flag.ContinueOnError)
+			RegisterFlags(fs)
+			if err := fs.Parse(tt.args.flags); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := LoadConfig(path, tt.args.profile, fs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMongoDB_Validate(t *testing.T) {
+	cfg := &MongoDB{
+		Name:         "my.db",
+		Adds:         addrs{"127.0.0.1", "host:99999"},
+		EnableAuth:   true,
+		EnableRepSet: true,
+		Transaction:  TransactionConfig{Fallback: "2pc"},
+	}
+	err := cfg.Validate()
+	errs, ok := err.(ConfigError)
+	if !ok {
+		t.Fatalf("Validate() error = %v, want ConfigError", err)
+	}
+
+	var fields []string
+	for _, fe := range errs {
+		fields = append(fields, fe.Field)
+	}
+	want := []string{"name", "addrs[0]", "addrs[1]", "username", "rs_name", "transaction.fallback"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("Validate() fields = %v, want %v", fields, want)
+	}
+
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Errorf("DefaultConfig().Validate() error = %v", err)
+	}
+}
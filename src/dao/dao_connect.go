@@ -0,0 +1,176 @@
+/*
+ * 说明：数据库连接
+ * 作者：agent
+ * 时间：2026-10-18 08:02
+ * 更新：连接失败时按指数退避重试, 不再直接panic
+ */
+
+package dao
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// Logger 日志接口, *log.Logger 即满足该接口
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Log dao包使用的日志对象, 可替换为业务自己的实现
+var Log Logger = log.New(os.Stderr, "[dao] ", log.LstdFlags)
+
+// RetryPolicy 连接重试策略(指数退避 + 随机抖动)
+// 第n次重试前等待 min(InitialInterval * Multiplier^(n-1), MaxInterval), 并在其上下浮动 Jitter 比例
+type RetryPolicy struct {
+	MaxAttempts     int           `yaml:"max_attempts"`     // 最多尝试次数(含第一次), <=1 表示不重试
+	InitialInterval time.Duration `yaml:"initial_interval"` // 第一次重试前的等待时间
+	MaxInterval     time.Duration `yaml:"max_interval"`     // 两次重试之间的最长等待时间
+	Multiplier      float64       `yaml:"multiplier"`       // 等待时间的增长倍数
+	Jitter          float64       `yaml:"jitter"`           // 随机抖动比例, 取值[0, 1]
+}
+
+// DefaultRetryPolicy 返回默认的重试策略
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:     5,
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+	}
+}
+
+// Backoff 返回第 attempt 次(从1开始)失败后、下一次尝试前需要等待的时间
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 || p.InitialInterval <= 0 {
+		return 0
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialInterval)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if p.MaxInterval > 0 && delay >= float64(p.MaxInterval) {
+			break
+		}
+	}
+	if p.MaxInterval > 0 && delay > float64(p.MaxInterval) {
+		delay = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// Connect 根据配置建立数据库连接, 失败时按 cfg.Retry 重试, 每次尝试都会记录日志
+// ctx 被取消或超时时立即返回; 全部尝试失败后返回最后一次的错误, 不会引发panic
+func Connect(ctx context.Context, cfg *MongoDB) (*mgo.Session, error) {
+	info, err := cfg.DialInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := cfg.Retry.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		session, err := dialContext(ctx, info)
+		if err == nil {
+			if attempt > 1 {
+				Log.Printf("connect %s: succeeded on attempt %d/%d", cfg, attempt, attempts)
+			}
+			cfg.setupSession(session)
+			return session, nil
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("connect %s: %w", cfg, ctx.Err())
+		}
+		if attempt >= attempts {
+			return nil, fmt.Errorf("connect %s: giving up after %d attempt(s): %w", cfg, attempt, err)
+		}
+
+		delay := cfg.Retry.Backoff(attempt)
+		Log.Printf("connect %s: attempt %d/%d failed: %v; retrying in %v", cfg, attempt, attempts, err, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("connect %s: %w (last error: %v)", cfg, ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// dialContext 调用 mgo.DialWithInfo, 单次连接超时时间不超过 ctx 剩余时间
+// mgo 本身不支持 context, ctx 结束时先行返回, 之后建立成功的连接会被关闭
+func dialContext(ctx context.Context, info *mgo.DialInfo) (*mgo.Session, error) {
+	dial := *info
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < dial.Timeout || dial.Timeout <= 0 {
+			dial.Timeout = left
+		}
+	}
+	if dial.Timeout <= 0 {
+		return nil, context.DeadlineExceeded
+	}
+
+	type result struct {
+		session *mgo.Session
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		session, err := mgo.DialWithInfo(&dial)
+		done <- result{session, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.session, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.session != nil {
+				r.session.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// setupSession 按配置设置连接池(session)的默认行为
+// 一致性模式优先使用 Mode, 其次 ReadPreference, 都未设置时为 Monotonic
+func (m *MongoDB) setupSession(session *mgo.Session) {
+	if mode, err := ParseMode(m.Mode); err == nil {
+		session.SetMode(mode, true)
+	} else if mode, ok := readPreferenceModes[m.ReadPreference]; ok {
+		session.SetMode(mode, true)
+	} else {
+		// Optional. Switch the session to a monotonic(单调的) behavior(行为).
+		session.SetMode(mgo.Monotonic, true)
+	}
+	if !m.WriteConcern.IsZero() {
+		if safe, err := m.WriteConcern.Safe(); err == nil {
+			session.SetSafe(safe)
+		}
+	}
+	if m.SocketTimeout > 0 {
+		session.SetSocketTimeout(m.SocketTimeout)
+	}
+	if m.MaxPoolSize > 0 {
+		session.SetPoolLimit(m.MaxPoolSize)
+	}
+}
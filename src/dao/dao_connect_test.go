@@ -0,0 +1,85 @@
+/*
+ * 说明：数据库连接单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:02
+ * 更新：
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{
+		MaxAttempts:     10,
+		InitialInterval: 100 * time.Millisecond,
+		MaxInterval:     time.Second,
+		Multiplier:      2,
+	}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: 0},
+		{attempt: 1, want: 100 * time.Millisecond},
+		{attempt: 2, want: 200 * time.Millisecond},
+		{attempt: 4, want: 800 * time.Millisecond},
+		{attempt: 5, want: time.Second},
+		{attempt: 50, want: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.attempt), func(t *testing.T) {
+			if got := p.Backoff(tt.attempt); got != tt.want {
+				t.Errorf("Backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Backoff(2); got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("Backoff(2) with jitter = %v, want within [100ms, 300ms]", got)
+		}
+	}
+}
+
+type countLogger struct{ lines int }
+
+func (l *countLogger) Printf(format string, v ...interface{}) { l.lines++ }
+
+func TestConnect_Unreachable(t *testing.T) {
+	logger := &countLogger{}
+	defer func(old Logger) { Log = old }(Log)
+	Log = logger
+
+	cfg := DefaultConfig()
+	cfg.Adds = addrs{"127.0.0.1:1"}
+	cfg.ConnectTimeout = 100 * time.Millisecond
+	cfg.Retry = RetryPolicy{MaxAttempts: 3, InitialInterval: 10 * time.Millisecond, Multiplier: 2}
+
+	session, err := Connect(context.Background(), cfg)
+	if err == nil {
+		session.Close()
+		t.Fatal("Connect() error = nil, want error")
+	}
+	if logger.lines != 2 {
+		t.Errorf("Connect() logged %d retries, want 2", logger.lines)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	cfg.ConnectTimeout = time.Minute
+	start := time.Now()
+	if _, err := Connect(ctx, cfg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Connect() error = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Connect() took %v after context deadline", elapsed)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+ * 说明：context 支持
+ * 作者：agent
+ * 时间：2026-10-18 08:07
+ * 更新：mgo 不支持 context, 通过 socket 超时、maxTimeMS 及遍历结果时检查 ctx 实现取消和超时
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// withSessionCtx 使用拷贝的Session执行 fn, ctx 结束时提前返回 ctx.Err()
+// mgo 本身不支持 context: Session 由执行 fn 的 goroutine 负责关闭, 提前返回后 fn 仍会继续执行,
+// 因此当 ctx 带有截止时间时, 将 socket 超时时间设置为剩余时间, 使未完成的操作随之结束
+//
+// ctx 结束后 fn 返回的错误会同时包装 ctx.Err(), 可使用 errors.Is(err, context.DeadlineExceeded) 判断
+func (d *Dao) withSessionCtx(ctx context.Context, fn func(session *mgo.Session) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	session := d.SessionCopy()
+	if deadline, ok := ctx.Deadline(); ok {
+		session.SetSocketTimeout(time.Until(deadline))
+	}
+	if ctx.Done() == nil { // context.Background() 等永远不会结束的 ctx
+		defer session.Close()
+		return fn(session)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer session.Close()
+		done <- fn(session)
+	}()
+
+	select {
+	case err := <-done:
+		return ctxError(ctx, err)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ctxError ctx 已结束时, 将 ctx.Err() 包装进 err(例如 socket 超时、maxTimeMS 超时)
+func ctxError(ctx context.Context, err error) error {
+	cerr := ctx.Err()
+	if err == nil || cerr == nil || errors.Is(err, cerr) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", cerr, err)
+}
+
+// withMaxTime ctx 带有截止时间时, 为查询设置 maxTimeMS, 由服务器端中止超时的查询
+func withMaxTime(ctx context.Context, q *mgo.Query) *mgo.Query {
+	if deadline, ok := ctx.Deadline(); ok {
+		q.SetMaxTime(time.Until(deadline))
+	}
+	return q
+}
+
+// decodeCtx 执行 fn 并将结果写入 result(指针)
+// ctx 可能提前结束时, fn 先写入临时对象, 成功后再复制到 result, 避免提前返回后 fn 继续修改调用方的对象
+func (d *Dao) decodeCtx(ctx context.Context, result interface{}, fn func(session *mgo.Session, out interface{}) error) error {
+	if ctx.Done() == nil {
+		return d.withSessionCtx(ctx, func(session *mgo.Session) error {
+			return fn(session, result)
+		})
+	}
+
+	out := reflect.New(reflect.TypeOf(result).Elem())
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		return fn(session, out.Interface())
+	})
+	if err != nil {
+		return err
+	}
+	reflect.ValueOf(result).Elem().Set(out.Elem())
+	return nil
+}
+
+// allCtx 与 mgo.Iter.All 相同, 将结果写入 result(切片的指针), 但每读取一个文档都会检查 ctx
+// ctx 结束时关闭游标并返回 ctx.Err()
+func allCtx(ctx context.Context, iter *mgo.Iter, result interface{}) error {
+	resultv := reflect.ValueOf(result)
+	if resultv.Kind() != reflect.Ptr || resultv.Elem().Kind() != reflect.Slice {
+		iter.Close()
+		return errors.New("result argument must be a slice address")
+	}
+
+	slicev := resultv.Elem()
+	slicev = slicev.Slice(0, slicev.Cap())
+	elemt := slicev.Type().Elem()
+	i := 0
+	for ; ; i++ {
+		if err := ctx.Err(); err != nil {
+			iter.Close()
+			return err
+		}
+		if slicev.Len() == i {
+			elemp := reflect.New(elemt)
+			if !iter.Next(elemp.Interface()) {
+				break
+			}
+			slicev = reflect.Append(slicev, elemp.Elem())
+			slicev = slicev.Slice(0, slicev.Cap())
+		} else {
+			if !iter.Next(slicev.Index(i).Addr().Interface()) {
+				break
+			}
+		}
+	}
+	resultv.Elem().Set(slicev.Slice(0, i))
+	return ctxError(ctx, iter.Close())
+}
+
+// ctxReader 每次读取前检查 ctx, 用于中止 GridFS 文件的读写
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
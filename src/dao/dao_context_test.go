@@ -0,0 +1,52 @@
+/*
+ * 说明：context 支持单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:07
+ * 更新：
+ */
+
+package dao
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCtxError(t *testing.T) {
+	driverErr := errors.New("read tcp: i/o timeout")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := ctxError(ctx, driverErr); err != driverErr {
+		t.Errorf("ctxError() before cancel = %v, want driver error", err)
+	}
+	cancel()
+
+	err := ctxError(ctx, driverErr)
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, driverErr) {
+		t.Errorf("ctxError() = %v, want to wrap both context.Canceled and driver error", err)
+	}
+	if err := ctxError(ctx, nil); err != nil {
+		t.Errorf("ctxError(nil) = %v, want nil", err)
+	}
+	if err := ctxError(ctx, context.Canceled); err != context.Canceled {
+		t.Errorf("ctxError(ctx.Err()) = %v, want context.Canceled", err)
+	}
+}
+
+func TestCtxReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &ctxReader{ctx: ctx, r: bytes.NewReader(make([]byte, 64<<10))}
+
+	buf := make([]byte, 1024)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	cancel()
+	if _, err := ioutil.ReadAll(r); err != context.Canceled {
+		t.Errorf("Read() after cancel error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * 说明：游标
+ * 作者：agent
+ * 时间：2026-10-18 08:21
+ * 更新：逐批读取查询、聚合结果, 不再一次性载入内存; 游标持有自己的 Session, 直到 Close
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ErrStopIteration Each 的回调函数返回该错误时提前结束遍历, Each 返回 nil
+var ErrStopIteration = errors.New("stop iteration")
+
+// CursorOptions 游标选项
+type CursorOptions struct {
+	Batch        int  // 每批从服务器读取的文档数量, 0 使用服务器默认值
+	AllowDiskUse bool // 聚合时允许使用磁盘临时文件, 只对 PipeCursor 有效
+}
+
+// Cursor 查询、聚合结果的游标, 用法:
+//
+//	cur, err := d.FindCursor(ctx, "users", bson.M{}, Page{}, CursorOptions{Batch: 500})
+//	if err != nil {
+//		return err
+//	}
+//	defer cur.Close()
+//	for cur.Next() {
+//		var user model.User
+//		if err := cur.Decode(&user); err != nil {
+//			return err
+//		}
+//	}
+//	return cur.Err()
+//
+// Cursor 不能在多个 goroutine 中同时使用
+type Cursor struct {
+	op      string
+	name    string
+	ctx     context.Context
+	session *mgo.Session // 游标持有的 Session, QueryHandle.Iter 返回的游标为 nil(由句柄持有)
+	iter    *mgo.Iter
+	doc     bson.Raw
+	err     error
+	closed  bool
+}
+
+// FindCursor 查找文档并返回游标, 参数同 FindDoc; 使用完毕后必须调用 Close 释放 Session
+// ctx 带有截止时间时为查询设置 maxTimeMS 及 socket 超时, ctx 结束后 Next 返回 false, Err 返回 ctx.Err()
+func (d *Dao) FindCursor(ctx context.Context, name string, query interface{}, page Page, opts CursorOptions, sortKeys ...string) (*Cursor, error) {
+	if query == nil {
+		return nil, opError("FindCursor", name, errNull)
+	}
+	if err := noCount(query); err != nil {
+		return nil, opError("FindCursor", name, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, opError("FindCursor", name, err)
+	}
+
+	session := d.cursorSession(ctx)
+	q := d.findQuery(ctx, session, name, query, page, sortKeys...)
+	if opts.Batch > 0 {
+		q = q.Batch(opts.Batch)
+	}
+	return &Cursor{op: "FindCursor", name: name, ctx: ctx, session: session, iter: q.Iter()}, nil
+}
+
+// PipeCursor 执行聚合管道并返回游标; 使用完毕后必须调用 Close 释放 Session
+func (d *Dao) PipeCursor(ctx context.Context, name string, pipes []bson.M, opts CursorOptions) (*Cursor, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, opError("PipeCursor", name, err)
+	}
+
+	session := d.cursorSession(ctx)
+	pipe := session.DB(d.Name).C(name).Pipe(pipes)
+	if opts.Batch > 0 {
+		pipe = pipe.Batch(opts.Batch)
+	}
+	if opts.AllowDiskUse {
+		pipe = pipe.AllowDiskUse()
+	}
+	return &Cursor{op: "PipeCursor", name: name, ctx: ctx, session: session, iter: pipe.Iter()}, nil
+}
+
+// cursorSession 拷贝游标使用的 Session, ctx 带有截止时间时将 socket 超时时间设置为剩余时间
+func (d *Dao) cursorSession(ctx context.Context) *mgo.Session {
+	session := d.SessionCopy()
+	if deadline, ok := ctx.Deadline(); ok {
+		session.SetSocketTimeout(time.Until(deadline))
+	}
+	return session
+}
+
+// Next 读取下一个文档, 没有更多文档、出错或 ctx 结束时返回 false, 此时应检查 Err
+func (c *Cursor) Next() bool {
+	if c.closed || c.err != nil {
+		return false
+	}
+	if err := c.ctx.Err(); err != nil {
+		c.err = err
+		return false
+	}
+	var raw bson.Raw
+	if !c.iter.Next(&raw) {
+		c.err = ctxError(c.ctx, c.iter.Err())
+		return false
+	}
+	// 复制一份, 避免当前文档与游标内部的缓冲区共享内存
+	c.doc = bson.Raw{Kind: raw.Kind, Data: append([]byte(nil), raw.Data...)}
+	return true
+}
+
+// Decode 将当前文档写入 v(结构体或 map 的指针)
+func (c *Cursor) Decode(v interface{}) error {
+	if c.closed {
+		return opError(c.op, c.name, errors.New("cursor is closed"))
+	}
+	if c.doc.Data == nil {
+		return opError(c.op, c.name, errors.New("Decode called without a successful Next"))
+	}
+	return opError(c.op, c.name, c.doc.Unmarshal(v))
+}
+
+// Raw 返回当前文档的原始 bson 数据
+func (c *Cursor) Raw() bson.Raw {
+	return c.doc
+}
+
+// Err 返回遍历过程中遇到的错误, 正常遍历完所有文档时返回 nil
+func (c *Cursor) Err() error {
+	return opError(c.op, c.name, c.err)
+}
+
+// Close 关闭游标及其持有的 Session, 可以重复调用
+func (c *Cursor) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.doc = bson.Raw{}
+	err := c.iter.Close()
+	if c.session != nil {
+		c.session.Close()
+	}
+	if c.err == nil {
+		c.err = err
+	}
+	return opError(c.op, c.name, err)
+}
+
+// Each 遍历剩余的文档, 每个文档调用一次 fn, 在 fn 中通过 c.Decode 读取文档; 结束后关闭游标
+// fn 返回 ErrStopIteration 时提前结束并返回 nil, 返回其它错误时提前结束并原样返回该错误
+func (c *Cursor) Each(fn func(c *Cursor) error) error {
+	defer c.Close()
+	for c.Next() {
+		if err := fn(c); err != nil {
+			if err == ErrStopIteration {
+				return nil
+			}
+			return err
+		}
+	}
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return c.Close()
+}
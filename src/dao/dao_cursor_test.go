@@ -0,0 +1,72 @@
+/*
+ * 说明：游标单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:21
+ * 更新：
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestDao_CursorCtxCanceled(t *testing.T) {
+	d := &Dao{Name: "mongo"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := d.FindCursor(ctx, "users", bson.M{}, Page{}, CursorOptions{Batch: 10}); !errors.Is(err, context.Canceled) {
+		t.Errorf("FindCursor() error = %v, want context.Canceled", err)
+	}
+	if _, err := d.PipeCursor(ctx, "users", []bson.M{}, CursorOptions{AllowDiskUse: true}); !errors.Is(err, context.Canceled) {
+		t.Errorf("PipeCursor() error = %v, want context.Canceled", err)
+	}
+	if _, err := d.FindCursor(context.Background(), "users", nil, Page{}, CursorOptions{}); !errors.Is(err, ErrInvalidSelector) {
+		t.Errorf("FindCursor(nil) error = %v, want ErrInvalidSelector", err)
+	}
+}
+
+func TestCursor_Closed(t *testing.T) {
+	c := &Cursor{op: "FindCursor", name: "users", ctx: context.Background(), closed: true}
+
+	if c.Next() {
+		t.Error("Next() on closed cursor = true")
+	}
+	var m bson.M
+	if err := c.Decode(&m); err == nil {
+		t.Error("Decode() on closed cursor error = nil")
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close() twice error = %v", err)
+	}
+	if err := c.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil", err)
+	}
+}
+
+func TestCursor_Decode(t *testing.T) {
+	data, err := bson.Marshal(bson.M{"name": "zhe", "age": 18})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Cursor{op: "FindCursor", name: "users", ctx: context.Background()}
+
+	var m bson.M
+	if err := c.Decode(&m); err == nil {
+		t.Error("Decode() before Next error = nil")
+	}
+
+	c.doc = bson.Raw{Kind: 3, Data: data}
+	var user struct {
+		Name string `bson:"name"`
+		Age  int    `bson:"age"`
+	}
+	if err := c.Decode(&user); err != nil || user.Name != "zhe" || user.Age != 18 {
+		t.Errorf("Decode() = %+v, %v", user, err)
+	}
+}
@@ -0,0 +1,205 @@
+/*
+ * 说明：数据库错误分类
+ * 作者：agent
+ * 时间：2026-10-18 08:10
+ * 更新：将mgo返回的错误归类为可通过 errors.Is/As 判断的错误
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+)
+
+// 错误类别, 使用 errors.Is(err, dao.ErrNotFound) 判断
+var (
+	ErrNotFound           = errors.New("not found")                  // 未匹配到文档
+	ErrDuplicateKey       = errors.New("duplicate key")              // 违反唯一索引, 详见 DuplicateKeyError
+	ErrValidationFailed   = errors.New("document validation failed") // 文档未通过集合的校验规则
+	ErrInvalidSelector    = errors.New("invalid selector")           // 查询条件/更新内容为空、类型不支持或包含非法操作符
+	ErrAmbiguousMatch     = errors.New("ambiguous match")            // 期望唯一匹配的查询匹配到多个文档
+	ErrTimeout            = errors.New("timeout")                    // 操作超时(ctx截止、maxTimeMS、socket超时)
+	ErrNetworkUnavailable = errors.New("network unavailable")        // 无法连接到数据库
+	ErrConflict           = errors.New("version conflict")           // 乐观锁版本号不一致, 详见 ConflictError
+)
+
+var (
+	errNull          = fmt.Errorf("%w: the interface is nil", ErrInvalidSelector)
+	errUnSupportType = fmt.Errorf("%w: unsupported type(only support bson.ObjectId or bson.M)", ErrInvalidSelector)
+)
+
+// MongoDB 错误码
+const (
+	codeBadValue           = 2
+	codeFailedToParse      = 9
+	codeMaxTimeMSExpired   = 50
+	codeDocumentValidation = 121
+	codeExceededTimeLimit  = 262
+)
+
+// Error Dao 方法返回的错误, 包含操作、集合及错误类别, 原始错误可通过 errors.Unwrap/As 获取
+type Error struct {
+	Op         string // 操作名称, 如 FindOneDoc
+	Collection string // 集合名称
+	Kind       error  // 错误类别, 如 ErrNotFound; 无法归类时为 nil
+	Err        error  // 原始错误
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString("dao: ")
+	b.WriteString(e.Op)
+	if e.Collection != "" {
+		b.WriteString(" ")
+		b.WriteString(e.Collection)
+	}
+	b.WriteString(": ")
+	if e.Kind != nil && (e.Err == nil || !strings.Contains(e.Err.Error(), e.Kind.Error())) {
+		b.WriteString(e.Kind.Error())
+		if e.Err != nil {
+			b.WriteString(": ")
+		}
+	}
+	if e.Err != nil {
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+// Unwrap 同时返回错误类别和原始错误, 使 errors.Is 对二者均可匹配
+func (e *Error) Unwrap() []error {
+	errs := make([]error, 0, 2)
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	return errs
+}
+
+// DuplicateKeyError 违反唯一索引的错误详情
+type DuplicateKeyError struct {
+	Index string // 冲突的索引名称, 如 account_1
+	Key   string // 冲突的键值, 如 { account: "mongo_0" }
+	Err   error  // 原始错误
+}
+
+func (e *DuplicateKeyError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("duplicate key: index %s, key %s", e.Index, e.Key)
+}
+
+// Unwrap 返回 ErrDuplicateKey 和原始错误
+func (e *DuplicateKeyError) Unwrap() []error {
+	return []error{ErrDuplicateKey, e.Err}
+}
+
+// dupKeyPattern 匹配 E11000 错误信息中的索引名称和键值, 例如:
+// E11000 duplicate key error collection: mongo.users index: account_1 dup key: { account: "mongo_0" }
+// E11000 duplicate key error index: mongo.users.$account_1 dup key: { : "mongo_0" }
+var dupKeyPattern = regexp.MustCompile(`index: (?:\S+\.\$)?(\S+)\s+dup key: (\{.*\})`)
+
+// parseDuplicateKey 从 E11000 错误信息中解析索引名称和键值
+func parseDuplicateKey(err error) *DuplicateKeyError {
+	dup := &DuplicateKeyError{Err: err}
+	if m := dupKeyPattern.FindStringSubmatch(err.Error()); m != nil {
+		dup.Index, dup.Key = m[1], m[2]
+	}
+	return dup
+}
+
+// classify 返回 err 的错误类别, 以及需要替换原始错误的详细错误(如 DuplicateKeyError)
+func classify(err error) (kind error, detail error) {
+	for _, k := range []error{ErrNotFound, ErrDuplicateKey, ErrValidationFailed, ErrInvalidSelector,
+		ErrAmbiguousMatch, ErrTimeout, ErrNetworkUnavailable, ErrConflict} {
+		if errors.Is(err, k) {
+			return k, err
+		}
+	}
+
+	if err == mgo.ErrNotFound {
+		return ErrNotFound, err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout, err
+	}
+
+	var code int
+	var lastErr *mgo.LastError
+	var queryErr *mgo.QueryError
+	var bulkErr *mgo.BulkError
+	switch {
+	case errors.As(err, &lastErr):
+		code = lastErr.Code
+		if lastErr.WTimeout {
+			return ErrTimeout, err
+		}
+	case errors.As(err, &queryErr):
+		code = queryErr.Code
+	case errors.As(err, &bulkErr):
+		// 批量操作中全部为重复键错误时才归类为 ErrDuplicateKey
+		if mgo.IsDup(bulkErr) {
+			return ErrDuplicateKey, parseDuplicateKey(err)
+		}
+		if cases := bulkErr.Cases(); len(cases) > 0 {
+			return classify(cases[0].Err)
+		}
+	}
+	if mgo.IsDup(err) {
+		return ErrDuplicateKey, parseDuplicateKey(err)
+	}
+	switch code {
+	case codeDocumentValidation:
+		return ErrValidationFailed, err
+	case codeBadValue, codeFailedToParse:
+		return ErrInvalidSelector, err
+	case codeMaxTimeMSExpired, codeExceededTimeLimit:
+		return ErrTimeout, err
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrTimeout, err
+		}
+		return ErrNetworkUnavailable, err
+	}
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrNetworkUnavailable, err
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "no reachable servers"), strings.Contains(msg, "Closed explicitly"),
+		strings.Contains(msg, "connection reset"), strings.Contains(msg, "broken pipe"):
+		return ErrNetworkUnavailable, err
+	case strings.Contains(msg, "i/o timeout"):
+		return ErrTimeout, err
+	case strings.Contains(msg, "unknown operator"), strings.Contains(msg, "unknown top level operator"):
+		return ErrInvalidSelector, err
+	}
+	return nil, err
+}
+
+// opError 将 err 包装为 *Error, err 为 nil 时返回 nil
+func opError(op, collection string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	kind, detail := classify(err)
+	return &Error{Op: op, Collection: collection, Kind: kind, Err: detail}
+}
@@ -0,0 +1,98 @@
+/*
+ * 说明：数据库错误分类单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:10
+ * 更新：
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+)
+
+func TestOpError(t *testing.T) {
+	dupErr := &mgo.LastError{Code: 11000,
+		Err: `E11000 duplicate key error collection: mongo.users index: account_1 dup key: { account: "mongo_0" }`}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "not found", err: mgo.ErrNotFound, want: ErrNotFound},
+		{name: "duplicate key", err: dupErr, want: ErrDuplicateKey},
+		{name: "validation", err: &mgo.QueryError{Code: 121, Message: "Document failed validation"}, want: ErrValidationFailed},
+		{name: "bad value", err: &mgo.QueryError{Code: 2, Message: "unknown operator: $foo"}, want: ErrInvalidSelector},
+		{name: "max time", err: &mgo.QueryError{Code: 50, Message: "operation exceeded time limit"}, want: ErrTimeout},
+		{name: "write timeout", err: &mgo.LastError{WTimeout: true, Err: "waiting for replication timed out"}, want: ErrTimeout},
+		{name: "ctx deadline", err: fmt.Errorf("%w: read tcp: i/o timeout", context.DeadlineExceeded), want: ErrTimeout},
+		{name: "no reachable servers", err: errors.New("no reachable servers"), want: ErrNetworkUnavailable},
+		{name: "nil selector", err: errNull, want: ErrInvalidSelector},
+		{name: "ambiguous", err: fmt.Errorf("%w: 2 documents matched", ErrAmbiguousMatch), want: ErrAmbiguousMatch},
+		{name: "unknown", err: errors.New("something else"), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := opError("FindOneDoc", "users", tt.err)
+
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("opError() = %T, want *Error", err)
+			}
+			if e.Op != "FindOneDoc" || e.Collection != "users" || e.Kind != tt.want {
+				t.Errorf("opError() = %+v, want Kind %v", e, tt.want)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.want)
+			}
+			// 原始错误仍可通过 errors.Is 判断
+			if !errors.Is(err, tt.err) {
+				t.Errorf("errors.Is(%v, original) = false", err)
+			}
+			// 已包装的错误不会重复包装
+			if again := opError("UpdateDoc", "users", err); again != err {
+				t.Errorf("opError() rewrapped = %v", again)
+			}
+		})
+	}
+
+	if err := opError("FindOneDoc", "users", nil); err != nil {
+		t.Errorf("opError(nil) = %v, want nil", err)
+	}
+}
+
+func TestDuplicateKeyError(t *testing.T) {
+	tests := []struct {
+		name      string
+		msg       string
+		wantIndex string
+		wantKey   string
+	}{
+		{name: "3.x", msg: `E11000 duplicate key error collection: mongo.users index: account_1 dup key: { account: "mongo_0" }`,
+			wantIndex: "account_1", wantKey: `{ account: "mongo_0" }`},
+		{name: "2.x", msg: `E11000 duplicate key error index: mongo.users.$account_1 dup key: { : "mongo_0" }`,
+			wantIndex: "account_1", wantKey: `{ : "mongo_0" }`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := opError("CreateDoc", "users", &mgo.LastError{Code: 11000, Err: tt.msg})
+
+			var dup *DuplicateKeyError
+			if !errors.As(err, &dup) {
+				t.Fatalf("errors.As(%v, *DuplicateKeyError) = false", err)
+			}
+			if dup.Index != tt.wantIndex || dup.Key != tt.wantKey {
+				t.Errorf("DuplicateKeyError = {Index: %q, Key: %q}, want {%q, %q}", dup.Index, dup.Key, tt.wantIndex, tt.wantKey)
+			}
+			if !mgo.IsDup(dup.Err) {
+				t.Errorf("mgo.IsDup(%v) = false", dup.Err)
+			}
+		})
+	}
+}
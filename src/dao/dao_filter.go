@@ -0,0 +1,647 @@
+/*
+ * 说明：查询条件校验
+ * 作者：agent
+ * 时间：2026-10-18 08:17
+ * 更新：客户端传入的查询条件按字段、操作符白名单校验并转换类型后再交给 FindDoc, 防止 $where 等操作符注入
+ */
+
+package dao
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// FilterTag 值为 "-" 时该字段不允许出现在查询条件中, 如 `filter:"-"`
+// json:"-" 的字段对客户端不可见, 同样不允许查询
+const FilterTag = "filter"
+
+// DefaultFilterOperators 默认允许的操作符, 不包含 $where、$function、$expr 等可执行代码或开销不可控的操作符
+var DefaultFilterOperators = []string{
+	"$eq", "$ne", "$gt", "$gte", "$lt", "$lte", "$in", "$nin",
+	"$and", "$or", "$nor", "$not",
+	"$exists", "$regex", "$options", "$all", "$size", "$elemMatch",
+}
+
+// 默认限制
+const (
+	DefaultFilterMaxDepth = 8   // 对象、数组的最大嵌套层数
+	DefaultFilterMaxSize  = 512 // 键和数组元素的最大总数
+)
+
+var (
+	objectIdType = reflect.TypeOf(bson.ObjectId(""))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// FilterError 查询条件校验错误, errors.Is(err, ErrInvalidSelector) 为 true
+type FilterError struct {
+	Path   string      // 出错的位置, 如 $or[1].age.$gt
+	Value  interface{} // 出错的值
+	Reason string      // 错误原因
+}
+
+func (e *FilterError) Error() string {
+	if e.Value == nil {
+		return fmt.Sprintf("filter %s: %s", e.Path, e.Reason)
+	}
+	return fmt.Sprintf("filter %s: %s (got %#v)", e.Path, e.Reason, e.Value)
+}
+
+func (e *FilterError) Unwrap() error {
+	return ErrInvalidSelector
+}
+
+// FilterPolicy 集合的查询条件校验规则
+type FilterPolicy struct {
+	Operators map[string]bool // 允许的操作符
+	MaxDepth  int             // 对象、数组的最大嵌套层数
+	MaxSize   int             // 键和数组元素的最大总数
+
+	fields map[string]reflect.Type // 允许的字段路径及其类型, 如 address.city => string
+	hidden bool                    // 包括 filter:"-"、json:"-" 的字段, 用于校验更新内容(见 NewUpdateFor)
+}
+
+// NewFilterPolicy 根据模型 T 的 bson 标签生成校验规则
+// 内嵌文档及内嵌数组文档的字段以 . 连接, 如 address.city、comments.content
+func NewFilterPolicy[T any]() *FilterPolicy {
+	p := newFieldPolicy(reflect.TypeOf((*T)(nil)).Elem(), false)
+	for _, op := range DefaultFilterOperators {
+		p.Operators[op] = true
+	}
+	return p
+}
+
+// newFieldPolicy 收集模型 t 的字段路径, 不允许任何操作符; hidden 为 true 时包括不允许查询的字段
+func newFieldPolicy(t reflect.Type, hidden bool) *FilterPolicy {
+	p := &FilterPolicy{
+		Operators: make(map[string]bool, len(DefaultFilterOperators)),
+		MaxDepth:  DefaultFilterMaxDepth,
+		MaxSize:   DefaultFilterMaxSize,
+		fields:    map[string]reflect.Type{},
+		hidden:    hidden,
+	}
+	p.addFields(t, "", 0)
+	return p
+}
+
+// addFields 收集结构体 t 的字段路径
+func (p *FilterPolicy) addFields(t reflect.Type, prefix string, depth int) {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct || depth > p.MaxDepth {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || !p.hidden && (f.Tag.Get(FilterTag) == "-" || f.Tag.Get("json") == "-") {
+			continue
+		}
+		name, inline := bsonFieldName(f)
+		if name == "-" {
+			continue
+		}
+		if inline {
+			p.addFields(f.Type, prefix, depth)
+			continue
+		}
+
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		p.fields[path] = f.Type
+
+		elem := indirectType(f.Type)
+		if elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array {
+			elem = indirectType(elem.Elem())
+		}
+		if elem.Kind() == reflect.Struct && !isTime(elem) {
+			p.addFields(elem, path, depth+1)
+		}
+	}
+}
+
+// bsonFieldName 返回字段在数据库中的名称, 规则与 mgo/bson 相同: 未指定时为字段名的小写形式
+func bsonFieldName(f reflect.StructField) (name string, inline bool) {
+	tag := f.Tag.Get("bson")
+	if tag == "" && !strings.Contains(string(f.Tag), ":") {
+		tag = string(f.Tag)
+	}
+	parts := strings.Split(tag, ",")
+	for _, flag := range parts[1:] {
+		if flag == "inline" {
+			inline = true
+		}
+	}
+	if parts[0] != "" {
+		return parts[0], inline
+	}
+	return strings.ToLower(f.Name), inline
+}
+
+// isTime 是否为时间类型: time.Time 或只内嵌了 time.Time 的结构体(如 model.Time)
+func isTime(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+	return t.Kind() == reflect.Struct && t.NumField() == 1 && t.Field(0).Anonymous && t.Field(0).Type == timeType
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Fields 返回允许查询的字段路径
+func (p *FilterPolicy) Fields() []string {
+	fields := make([]string, 0, len(p.fields))
+	for k := range p.fields {
+		fields = append(fields, k)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// lookup 返回字段路径对应的类型, 路径中可以包含数组下标, 如 friends.0、comments.1.content
+func (p *FilterPolicy) lookup(path string) (reflect.Type, bool) {
+	var prefix string
+	var t reflect.Type
+	for _, seg := range strings.Split(path, ".") {
+		if t != nil && isIndex(seg) {
+			if k := indirectType(t).Kind(); k == reflect.Slice || k == reflect.Array {
+				t = indirectType(t).Elem()
+				continue
+			}
+		}
+		if prefix != "" {
+			prefix += "."
+		}
+		prefix += seg
+
+		var ok bool
+		if t, ok = p.fields[prefix]; !ok {
+			return nil, false
+		}
+	}
+	return t, t != nil
+}
+
+func isIndex(seg string) bool {
+	if seg == "" {
+		return false
+	}
+	for _, c := range seg {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// CompileJSON 解析并校验 JSON 格式的查询条件
+func (p *FilterPolicy) CompileJSON(data []byte) (bson.M, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, &FilterError{Path: "$", Reason: fmt.Sprintf("must be a JSON object: %v", err)}
+	}
+	return p.Compile(m)
+}
+
+// Compile 校验查询条件并返回可直接用于查询的 bson.M
+// 字段和操作符必须在白名单中; 值按字段类型转换: ObjectId 十六进制字符串 => bson.ObjectId,
+// 时间字符串(RFC 3339 或 TimeLayout、DateLayout) => time.Time, 数字字符串 => 数字
+func (p *FilterPolicy) Compile(filter map[string]interface{}) (bson.M, error) {
+	c := &filterCompiler{policy: p}
+	return c.logical(filter, "", "", 0)
+}
+
+// CompileSearch 解析 q. 操作符格式的查询参数(见 ParseOperator), 校验其中的查询条件,
+// 以及 q.select、q.sort、q.hint 引用的字段
+func (p *FilterPolicy) CompileSearch(search []byte) (*Operator, error) {
+	op, err := ParseOperator(search)
+	if err != nil {
+		return nil, err
+	}
+	if op.Filter, err = p.Compile(op.Filter); err != nil {
+		return nil, err
+	}
+
+	check := func(name string, keys []string) error {
+		for _, k := range keys {
+			field := strings.TrimLeft(k, "+-")
+			if _, ok := p.lookup(field); !ok && field != "_id" {
+				return &OperatorError{Op: name, Value: k, Reason: "unknown field"}
+			}
+		}
+		return nil
+	}
+	selected := make([]string, 0, len(op.Select))
+	for k := range op.Select {
+		selected = append(selected, k)
+	}
+	sort.Strings(selected)
+	if err := check(OpSelect, selected); err != nil {
+		return nil, err
+	}
+	if err := check(OpSort, op.Sort); err != nil {
+		return nil, err
+	}
+	if err := check(OpHint, op.Hint); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// filterCompiler 单次校验的状态
+type filterCompiler struct {
+	policy *FilterPolicy
+	size   int
+}
+
+// enter 检查嵌套层数和节点总数
+func (c *filterCompiler) enter(path string, depth, n int) error {
+	maxDepth, maxSize := c.policy.MaxDepth, c.policy.MaxSize
+	if maxDepth > 0 && depth > maxDepth {
+		return &FilterError{Path: path, Reason: fmt.Sprintf("nesting exceeds %d levels", maxDepth)}
+	}
+	c.size += n
+	if maxSize > 0 && c.size > maxSize {
+		return &FilterError{Path: path, Reason: fmt.Sprintf("filter exceeds %d elements", maxSize)}
+	}
+	return nil
+}
+
+func (c *filterCompiler) allowed(op, path string) error {
+	if !c.policy.Operators[op] {
+		return &FilterError{Path: path, Reason: fmt.Sprintf("operator %s is not allowed", op)}
+	}
+	return nil
+}
+
+// logical 校验字段条件及 $and/$or/$nor 组成的查询条件, prefix 为 $elemMatch 所在的数组字段
+func (c *filterCompiler) logical(filter map[string]interface{}, prefix, path string, depth int) (bson.M, error) {
+	if err := c.enter(orRoot(path), depth, len(filter)); err != nil {
+		return nil, err
+	}
+
+	out := make(bson.M, len(filter))
+	for _, k := range sortedKeys(filter) {
+		v := filter[k]
+		kpath := joinPath(path, k)
+
+		if strings.HasPrefix(k, "$") {
+			if err := c.allowed(k, kpath); err != nil {
+				return nil, err
+			}
+			if k != "$and" && k != "$or" && k != "$nor" {
+				return nil, &FilterError{Path: kpath, Reason: "only $and, $or and $nor are allowed here"}
+			}
+			list, ok := v.([]interface{})
+			if !ok || len(list) == 0 {
+				return nil, &FilterError{Path: kpath, Value: v, Reason: "must be a non-empty array of objects"}
+			}
+			if err := c.enter(kpath, depth+1, len(list)); err != nil {
+				return nil, err
+			}
+			clauses := make([]interface{}, len(list))
+			for i, e := range list {
+				epath := fmt.Sprintf("%s[%d]", kpath, i)
+				m, ok := e.(map[string]interface{})
+				if !ok {
+					return nil, &FilterError{Path: epath, Value: e, Reason: "must be an object"}
+				}
+				clause, err := c.logical(m, prefix, epath, depth+2)
+				if err != nil {
+					return nil, err
+				}
+				clauses[i] = clause
+			}
+			out[k] = clauses
+			continue
+		}
+
+		field := k
+		if prefix != "" {
+			field = prefix + "." + k
+		}
+		t, ok := c.policy.lookup(field)
+		if !ok {
+			return nil, &FilterError{Path: kpath, Reason: "unknown field"}
+		}
+		cond, err := c.condition(v, t, field, kpath, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = cond
+	}
+	return out, nil
+}
+
+// condition 校验字段的条件: 操作符文档或需要相等的值
+func (c *filterCompiler) condition(v interface{}, t reflect.Type, field, path string, depth int) (interface{}, error) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return c.coerce(v, t, path, depth)
+	}
+
+	var ops, plain int
+	for k := range m {
+		if strings.HasPrefix(k, "$") {
+			ops++
+		} else {
+			plain++
+		}
+	}
+	if ops == 0 {
+		return nil, &FilterError{Path: path, Reason: "embedded document equality is not supported, use dotted field paths"}
+	}
+	if plain > 0 {
+		return nil, &FilterError{Path: path, Reason: "cannot mix operators and fields"}
+	}
+	if err := c.enter(path, depth, len(m)); err != nil {
+		return nil, err
+	}
+
+	out := make(bson.M, len(m))
+	for _, op := range sortedKeys(m) {
+		arg := m[op]
+		opath := joinPath(path, op)
+		if err := c.allowed(op, opath); err != nil {
+			return nil, err
+		}
+
+		var err error
+		switch op {
+		case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte":
+			out[op], err = c.coerce(arg, t, opath, depth+1)
+		case "$in", "$nin", "$all":
+			list, ok := arg.([]interface{})
+			if !ok {
+				return nil, &FilterError{Path: opath, Value: arg, Reason: "must be an array"}
+			}
+			if err := c.enter(opath, depth+1, len(list)); err != nil {
+				return nil, err
+			}
+			values := make([]interface{}, len(list))
+			for i, e := range list {
+				if values[i], err = c.coerce(e, t, fmt.Sprintf("%s[%d]", opath, i), depth+2); err != nil {
+					return nil, err
+				}
+			}
+			out[op] = values
+		case "$exists":
+			if _, ok := arg.(bool); !ok {
+				return nil, &FilterError{Path: opath, Value: arg, Reason: "must be a boolean"}
+			}
+			out[op] = arg
+		case "$size":
+			if !isSlice(t) {
+				return nil, &FilterError{Path: opath, Reason: "field is not an array"}
+			}
+			n, perr := parseCount(arg)
+			if perr != nil {
+				return nil, &FilterError{Path: opath, Value: arg, Reason: perr.Error()}
+			}
+			out[op] = *n
+		case "$regex":
+			if elem := elemType(t); elem.Kind() != reflect.String || elem == objectIdType {
+				return nil, &FilterError{Path: opath, Reason: "field is not a string"}
+			}
+			if _, ok := arg.(string); !ok {
+				return nil, &FilterError{Path: opath, Value: arg, Reason: "must be a string"}
+			}
+			out[op] = arg
+		case "$options":
+			s, ok := arg.(string)
+			if !ok || strings.Trim(s, "imsx") != "" {
+				return nil, &FilterError{Path: opath, Value: arg, Reason: "must only contain i, m, s, x"}
+			}
+			if _, ok := m["$regex"]; !ok {
+				return nil, &FilterError{Path: opath, Reason: "requires $regex"}
+			}
+			out[op] = arg
+		case "$not":
+			if s, ok := arg.(string); ok {
+				out[op] = bson.RegEx{Pattern: s}
+				break
+			}
+			if _, ok := arg.(map[string]interface{}); !ok {
+				return nil, &FilterError{Path: opath, Value: arg, Reason: "must be an operator object or a regular expression"}
+			}
+			out[op], err = c.condition(arg, t, field, opath, depth+1)
+		case "$elemMatch":
+			if !isSlice(t) {
+				return nil, &FilterError{Path: opath, Reason: "field is not an array"}
+			}
+			sub, ok := arg.(map[string]interface{})
+			if !ok {
+				return nil, &FilterError{Path: opath, Value: arg, Reason: "must be an object"}
+			}
+			if elemType(t).Kind() == reflect.Struct && !isTime(elemType(t)) {
+				out[op], err = c.logical(sub, field, opath, depth+1)
+			} else {
+				out[op], err = c.condition(sub, elemType(t), field, opath, depth+1)
+			}
+		default:
+			return nil, &FilterError{Path: opath, Reason: fmt.Sprintf("operator %s cannot be used on a field", op)}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// coerce 将值转换为字段类型; 数组字段的值可以是单个元素(匹配包含该元素的数组)或整个数组
+func (c *filterCompiler) coerce(v interface{}, t reflect.Type, path string, depth int) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	t = indirectType(t)
+
+	if list, ok := v.([]interface{}); ok {
+		if !isSlice(t) {
+			return nil, &FilterError{Path: path, Value: v, Reason: "field is not an array"}
+		}
+		if err := c.enter(path, depth, len(list)); err != nil {
+			return nil, err
+		}
+		out := make([]interface{}, len(list))
+		for i, e := range list {
+			var err error
+			if out[i], err = c.coerce(e, t.Elem(), fmt.Sprintf("%s[%d]", path, i), depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	}
+	if isSlice(t) {
+		return c.coerce(v, t.Elem(), path, depth)
+	}
+
+	mismatch := func() error {
+		return &FilterError{Path: path, Value: v, Reason: fmt.Sprintf("must be %s", typeName(t))}
+	}
+	switch {
+	case t == objectIdType:
+		switch id := v.(type) {
+		case bson.ObjectId:
+			return id, nil
+		case string:
+			if bson.IsObjectIdHex(id) {
+				return bson.ObjectIdHex(id), nil
+			}
+		}
+		return nil, mismatch()
+	case isTime(t):
+		switch tm := v.(type) {
+		case time.Time:
+			return tm, nil
+		case string:
+			if parsed, err := parseFilterTime(tm); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, mismatch()
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case reflect.Bool:
+		switch b := v.(type) {
+		case bool:
+			return b, nil
+		case string:
+			if parsed, err := strconv.ParseBool(b); err == nil {
+				return parsed, nil
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch n := v.(type) {
+		case float64:
+			if n == math.Trunc(n) && math.Abs(n) < 1<<53 {
+				return int64(n), nil
+			}
+		case int:
+			return int64(n), nil
+		case int64:
+			return n, nil
+		case json.Number:
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		switch n := v.(type) {
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		case json.Number:
+			if f, err := n.Float64(); err == nil {
+				return f, nil
+			}
+		case string:
+			if f, err := strconv.ParseFloat(n, 64); err == nil {
+				return f, nil
+			}
+		}
+	case reflect.Interface:
+		// 任意类型的字段只接受标量
+		switch v.(type) {
+		case string, bool, float64, int, int64, json.Number:
+			return v, nil
+		}
+	case reflect.Struct:
+		return nil, &FilterError{Path: path, Reason: "embedded document equality is not supported, use dotted field paths"}
+	}
+	return nil, mismatch()
+}
+
+// parseFilterTime 解析 RFC 3339、TimeLayout 或 DateLayout 格式的时间, 后两者按本地时区解析
+func parseFilterTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(TimeLayout, s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(DateLayout, s, time.Local)
+}
+
+func isSlice(t reflect.Type) bool {
+	t = indirectType(t)
+	return (t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8) || t.Kind() == reflect.Array
+}
+
+func elemType(t reflect.Type) reflect.Type {
+	t = indirectType(t)
+	if isSlice(t) {
+		return indirectType(t.Elem())
+	}
+	return t
+}
+
+func typeName(t reflect.Type) string {
+	switch {
+	case t == objectIdType:
+		return "an ObjectId hex string"
+	case isTime(t):
+		return "a time (RFC 3339)"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Interface:
+		return "a scalar value"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	}
+	return t.String()
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func orRoot(path string) string {
+	if path == "" {
+		return "$"
+	}
+	return path
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
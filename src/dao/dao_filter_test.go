@@ -0,0 +1,143 @@
+/*
+ * 说明：查询条件校验单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:17
+ * 更新：
+ */
+
+package dao
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+	"mongodb.golang.com/src/model"
+)
+
+func TestNewFilterPolicy(t *testing.T) {
+	fields := strings.Join(NewFilterPolicy[model.User]().Fields(), " ")
+	for _, want := range []string{"_id", "account", "age", "friends", "address.city", "comments.content", "comments._id"} {
+		if !strings.Contains(" "+fields+" ", " "+want+" ") {
+			t.Errorf("Fields() = %s, want to contain %s", fields, want)
+		}
+	}
+	// filter:"-" 及 json:"-" 的字段不允许查询
+	for _, hidden := range []string{"password", "is_delete", "delete_at", "comments.is_delete"} {
+		if strings.Contains(" "+fields+" ", " "+hidden+" ") {
+			t.Errorf("Fields() = %s, want not to contain %s", fields, hidden)
+		}
+	}
+}
+
+func TestFilterPolicy_CompileJSON(t *testing.T) {
+	id := bson.NewObjectId()
+	policy := NewFilterPolicy[model.User]()
+
+	tests := []struct {
+		name     string
+		filter   string
+		want     bson.M
+		wantPath string // 期望出错的位置
+	}{
+		{
+			name:   "coerce",
+			filter: `{"_id": "` + id.Hex() + `", "age": {"$gte": "18", "$lt": 30}, "friends": "KB"}`,
+			want:   bson.M{"_id": id, "age": bson.M{"$gte": int64(18), "$lt": int64(30)}, "friends": "KB"},
+		},
+		{
+			name:   "logical",
+			filter: `{"$or": [{"address.city": "hz"}, {"comments": {"$elemMatch": {"content": {"$regex": "^Code", "$options": "i"}}}}]}`,
+			want: bson.M{"$or": []interface{}{
+				bson.M{"address.city": "hz"},
+				bson.M{"comments": bson.M{"$elemMatch": bson.M{"content": bson.M{"$regex": "^Code", "$options": "i"}}}},
+			}},
+		},
+		{
+			name:   "array operators",
+			filter: `{"friends": {"$all": ["KB", "YM"], "$size": 6}, "comments.0._id": {"$in": ["` + id.Hex() + `"]}}`,
+			want: bson.M{
+				"friends":        bson.M{"$all": []interface{}{"KB", "YM"}, "$size": 6},
+				"comments.0._id": bson.M{"$in": []interface{}{id}},
+			},
+		},
+		{
+			name:   "time range",
+			filter: `{"create_at": {"$gte": "2018-01-17T00:00:00Z", "$lt": "2018-01-18 00:00:00"}, "comments.create_at": {"$gt": "2018-01-17"}}`,
+			want: bson.M{
+				"create_at":          bson.M{"$gte": time.Date(2018, 1, 17, 0, 0, 0, 0, time.UTC), "$lt": time.Date(2018, 1, 18, 0, 0, 0, 0, time.Local)},
+				"comments.create_at": bson.M{"$gt": time.Date(2018, 1, 17, 0, 0, 0, 0, time.Local)},
+			},
+		},
+		{name: "where", filter: `{"$where": "sleep(1000)"}`, wantPath: "$where"},
+		{name: "nested operator", filter: `{"$and": [{"age": {"$function": {}}}]}`, wantPath: "$and[0].age.$function"},
+		{name: "unknown field", filter: `{"$or": [{"age": 1}, {"salary": 1}]}`, wantPath: "$or[1].salary"},
+		{name: "hidden field", filter: `{"password": "123456"}`, wantPath: "password"},
+		{name: "bad ObjectId", filter: `{"_id": "123"}`, wantPath: "_id"},
+		{name: "bad number", filter: `{"age": {"$in": [1, "two"]}}`, wantPath: "age.$in[1]"},
+		{name: "type mismatch", filter: `{"account": 1}`, wantPath: "account"},
+		{name: "mixed", filter: `{"age": {"$gt": 1, "x": 2}}`, wantPath: "age"},
+		{name: "embedded equality", filter: `{"address": {"city": "hz"}}`, wantPath: "address"},
+		{name: "regex on number", filter: `{"age": {"$regex": "1"}}`, wantPath: "age.$regex"},
+		{name: "too deep", filter: `{"$or": [{"$or": [{"$or": [{"$or": [{"$or": [{"age": 1}]}]}]}]}]}`, wantPath: "$or[0].$or[0].$or[0].$or[0].$or"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := policy.CompileJSON([]byte(tt.filter))
+			if (err != nil) != (tt.wantPath != "") {
+				t.Fatalf("CompileJSON() error = %v, wantPath %q", err, tt.wantPath)
+			}
+			if err != nil {
+				var ferr *FilterError
+				if !errors.As(err, &ferr) || ferr.Path != tt.wantPath {
+					t.Errorf("CompileJSON() error = %v, want path %s", err, tt.wantPath)
+				}
+				if !errors.Is(err, ErrInvalidSelector) {
+					t.Errorf("CompileJSON() error = %v, want ErrInvalidSelector", err)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CompileJSON() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterPolicy_Limits(t *testing.T) {
+	policy := NewFilterPolicy[model.User]()
+	policy.MaxSize = 4
+
+	_, err := policy.CompileJSON([]byte(`{"age": {"$in": [1, 2, 3, 4, 5]}}`))
+	var ferr *FilterError
+	if !errors.As(err, &ferr) || ferr.Path != "age.$in" {
+		t.Errorf("CompileJSON() error = %v, want size limit at age.$in", err)
+	}
+
+	delete(policy.Operators, "$regex")
+	_, err = policy.CompileJSON([]byte(`{"name": {"$regex": "zhe"}}`))
+	if !errors.As(err, &ferr) || ferr.Path != "name.$regex" {
+		t.Errorf("CompileJSON() error = %v, want $regex not allowed", err)
+	}
+}
+
+func TestFilterPolicy_CompileSearch(t *testing.T) {
+	policy := NewFilterPolicy[model.User]()
+
+	op, err := policy.CompileSearch([]byte(`{"age": "2", "q.sort": "-create_at", "q.select": ["name", "address.city"]}`))
+	if err != nil {
+		t.Fatalf("CompileSearch() error = %v", err)
+	}
+	if !reflect.DeepEqual(op.Filter, bson.M{"age": int64(2)}) {
+		t.Errorf("CompileSearch() Filter = %v", op.Filter)
+	}
+
+	_, err = policy.CompileSearch([]byte(`{"q.sort": "-password"}`))
+	var opErr *OperatorError
+	if !errors.As(err, &opErr) || opErr.Op != OpSort {
+		t.Errorf("CompileSearch() error = %v, want unknown q.sort field", err)
+	}
+}
@@ -0,0 +1,119 @@
+/*
+ * 说明：数据库健康检查
+ * 作者：agent
+ * 时间：2026-10-18 08:02
+ * 更新：Ping & HealthCheck, 用于服务的就绪(readiness)探针
+ */
+
+package dao
+
+import (
+	"context"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Health 健康检查结果
+type Health struct {
+	OK      bool           `json:"ok"`                 // 主节点是否可达
+	Primary string         `json:"primary,omitempty"`  // 主节点地址
+	SetName string         `json:"set_name,omitempty"` // 副本集名称, 单机模式为空
+	Latency time.Duration  `json:"latency"`            // 到主节点的往返延迟
+	Members []MemberHealth `json:"members,omitempty"`  // 副本集成员状态, 单机模式为空
+	Error   string         `json:"error,omitempty"`    // 检查失败的原因
+}
+
+// MemberHealth 副本集成员状态(replSetGetStatus.members)
+type MemberHealth struct {
+	Name    string `json:"name"`              // 成员地址
+	State   string `json:"state"`             // PRIMARY, SECONDARY, ARBITER, RECOVERING ...
+	Healthy bool   `json:"healthy"`           // 是否可达
+	Self    bool   `json:"self,omitempty"`    // 是否为当前连接的节点
+	Message string `json:"message,omitempty"` // 不可达时的错误信息
+}
+
+// Ping 检查主节点是否可达, 返回往返延迟
+func (d *Dao) Ping(ctx context.Context) (time.Duration, error) {
+	var latency time.Duration
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		session.SetMode(mgo.Primary, true)
+		start := time.Now()
+		if err := session.Ping(); err != nil {
+			return err
+		}
+		latency = time.Since(start)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return latency, nil
+}
+
+// HealthCheck 检查主节点可达性、往返延迟及副本集各成员的状态
+// 主节点不可达时返回的 Health.OK 为 false 且 error 不为 nil; 成员状态获取失败不影响 OK
+func (d *Dao) HealthCheck(ctx context.Context) (*Health, error) {
+	health := &Health{}
+
+	latency, err := d.Ping(ctx)
+	if err != nil {
+		health.Error = err.Error()
+		return health, err
+	}
+	health.OK, health.Latency = true, latency
+
+	var isMaster struct {
+		SetName string `bson:"setName"`
+		Primary string `bson:"primary"`
+		Me      string `bson:"me"`
+	}
+	var liveServers []string
+	err = d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		session.SetMode(mgo.Primary, true)
+		liveServers = session.LiveServers()
+		return session.DB("admin").Run("isMaster", &isMaster)
+	})
+	if err != nil {
+		health.Error = err.Error()
+		return health, nil
+	}
+	health.SetName, health.Primary = isMaster.SetName, isMaster.Primary
+	if isMaster.SetName == "" {
+		// 单机模式
+		health.Primary = isMaster.Me
+		if health.Primary == "" && len(liveServers) > 0 {
+			health.Primary = liveServers[0]
+		}
+		return health, nil
+	}
+
+	var status struct {
+		Members []struct {
+			Name     string  `bson:"name"`
+			Health   float64 `bson:"health"`
+			StateStr string  `bson:"stateStr"`
+			Self     bool    `bson:"self"`
+			ErrMsg   string  `bson:"lastHeartbeatMessage"`
+		} `bson:"members"`
+	}
+	err = d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		session.SetMode(mgo.Primary, true)
+		return session.DB("admin").Run(bson.D{{Name: "replSetGetStatus", Value: 1}}, &status)
+	})
+	if err != nil {
+		health.Error = err.Error()
+		return health, nil
+	}
+	for _, m := range status.Members {
+		health.Members = append(health.Members, MemberHealth{
+			Name:    m.Name,
+			State:   m.StateStr,
+			Healthy: m.Health == 1,
+			Self:    m.Self,
+			Message: m.ErrMsg,
+		})
+	}
+	return health, nil
+}
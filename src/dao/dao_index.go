@@ -0,0 +1,551 @@
+/*
+ * 说明：索引管理
+ * 作者：agent
+ * 时间：2026-10-18 08:27
+ * 更新：索引在模型的 index 标签中声明, 启动时由 EnsureIndexes 创建, 不再在每次 CreateDoc 时 EnsureIndex
+ */
+
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// IndexTag 声明索引的结构体标签, 多个索引以 ; 分隔, 每个索引的选项以 , 分隔:
+//
+//	asc(默认)、desc、text、2dsphere、2d、hashed  该字段在索引中的类型
+//	unique、sparse                              唯一索引、稀疏索引
+//	name=<名称>                                 索引名称; 名称相同的字段按声明顺序组成复合索引
+//	ttl=<时长>                                  TTL 索引, 如 ttl=720h, 字段须为 time.Time
+//	partial=<JSON>                              部分索引的过滤条件, 如 partial={"is_delete": false}
+//
+// 例如:
+//
+//	Account string    `bson:"account" index:"unique,partial={\"is_delete\": false}"`
+//	Name    string    `bson:"name" index:"name=name_age"`
+//	Age     int       `bson:"age" index:"name=name_age,desc"`
+//	Expire  time.Time `bson:"expire" index:"ttl=24h"`
+//
+// 未指定名称时按字段生成, 规则与 MongoDB 相同, 如 account_1、create_at_-1、content_text
+const IndexTag = "index"
+
+// IndexModel 索引定义
+type IndexModel struct {
+	Name          string        // 索引名称
+	Key           []string      // 索引字段, 格式同 mgo.Index.Key: field、-field、$text:field、$2dsphere:field、$hashed:field
+	Unique        bool          // 唯一索引
+	Sparse        bool          // 稀疏索引, 不存在该字段的文档不进入索引
+	ExpireAfter   time.Duration // TTL, 大于0时为 TTL 索引
+	PartialFilter bson.M        // 部分索引的过滤条件
+}
+
+func (m IndexModel) String() string {
+	s := fmt.Sprintf("%s %v", m.Name, m.Key)
+	if m.Unique {
+		s += " unique"
+	}
+	if m.Sparse {
+		s += " sparse"
+	}
+	if m.ExpireAfter > 0 {
+		s += " ttl=" + m.ExpireAfter.String()
+	}
+	if m.PartialFilter != nil {
+		s += " partial=" + canonicalJSON(m.PartialFilter)
+	}
+	return s
+}
+
+// IndexDiff 声明的索引与集合中已有索引的差异
+type IndexDiff struct {
+	Missing []IndexModel // 已声明但集合中不存在
+	Extra   []IndexModel // 集合中存在但未声明(不含 _id 索引)
+	Changed []IndexModel // 名称相同但定义不同, 为声明的定义
+}
+
+// Empty 没有差异时返回 true
+func (d *IndexDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Extra) == 0 && len(d.Changed) == 0
+}
+
+// String 每行一个差异: + 缺少, - 多余, ~ 不一致
+func (d *IndexDiff) String() string {
+	var lines []string
+	for _, m := range d.Missing {
+		lines = append(lines, "+ "+m.String())
+	}
+	for _, m := range d.Extra {
+		lines = append(lines, "- "+m.String())
+	}
+	for _, m := range d.Changed {
+		lines = append(lines, "~ "+m.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Indexes 返回模型 T 的 index 标签声明的索引
+func Indexes[T any]() ([]IndexModel, error) {
+	return ParseIndexes(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// indexField 标签中声明的一个索引字段
+type indexField struct {
+	path string
+	kind string // 1、-1、text、2dsphere、2d、hashed
+	opts IndexModel
+}
+
+// ParseIndexes 解析结构体类型 t 的 index 标签
+// 内嵌文档及内嵌数组文档的字段以 . 连接, 如 address.city、comments.content
+func ParseIndexes(t reflect.Type) ([]IndexModel, error) {
+	var fields []indexField
+	if err := collectIndexFields(indirectType(t), "", 0, &fields); err != nil {
+		return nil, fmt.Errorf("%s: %w", t.String(), err)
+	}
+
+	var (
+		models []IndexModel
+		byName = map[string]int{}
+	)
+	for _, f := range fields {
+		name := f.opts.Name
+		if name == "" {
+			name = f.path + "_" + f.kind
+		}
+		i, ok := byName[name]
+		if !ok {
+			byName[name] = len(models)
+			models = append(models, IndexModel{Name: name})
+			i = len(models) - 1
+		}
+		m := &models[i]
+		m.Key = append(m.Key, indexKey(f.path, f.kind))
+		m.Unique = m.Unique || f.opts.Unique
+		m.Sparse = m.Sparse || f.opts.Sparse
+		if f.opts.ExpireAfter > 0 {
+			if m.ExpireAfter > 0 && m.ExpireAfter != f.opts.ExpireAfter {
+				return nil, fmt.Errorf("%s: index %s: conflicting ttl", t.String(), name)
+			}
+			m.ExpireAfter = f.opts.ExpireAfter
+		}
+		if f.opts.PartialFilter != nil {
+			if m.PartialFilter != nil && canonicalJSON(m.PartialFilter) != canonicalJSON(f.opts.PartialFilter) {
+				return nil, fmt.Errorf("%s: index %s: conflicting partial filter", t.String(), name)
+			}
+			m.PartialFilter = f.opts.PartialFilter
+		}
+	}
+	for _, m := range models {
+		if m.ExpireAfter > 0 && (len(m.Key) != 1 || strings.HasPrefix(m.Key[0], "$")) {
+			return nil, fmt.Errorf("%s: index %s: ttl requires a single ascending or descending field", t.String(), m.Name)
+		}
+	}
+	return models, nil
+}
+
+// collectIndexFields 按声明顺序收集结构体 t 中带 index 标签的字段
+func collectIndexFields(t reflect.Type, prefix string, depth int, out *[]indexField) error {
+	if t.Kind() != reflect.Struct || depth > DefaultFilterMaxDepth {
+		return nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, inline := bsonFieldName(f)
+		if name == "-" {
+			continue
+		}
+		if inline {
+			if err := collectIndexFields(indirectType(f.Type), prefix, depth, out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		path := joinPath(prefix, name)
+		if tag := f.Tag.Get(IndexTag); tag != "" {
+			for _, spec := range splitTag(tag, ';') {
+				field, err := parseIndexSpec(path, spec)
+				if err != nil {
+					return err
+				}
+				*out = append(*out, field)
+			}
+		}
+
+		elem := indirectType(f.Type)
+		if elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array {
+			elem = indirectType(elem.Elem())
+		}
+		if elem.Kind() == reflect.Struct && !isTime(elem) {
+			if err := collectIndexFields(elem, path, depth+1, out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseIndexSpec 解析一个索引的选项, 如 unique,name=account_age,partial={"is_delete": false}
+func parseIndexSpec(path, spec string) (indexField, error) {
+	f := indexField{path: path, kind: "1"}
+	for _, opt := range splitTag(spec, ',') {
+		opt = strings.TrimSpace(opt)
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "", "asc":
+		case "desc":
+			f.kind = "-1"
+		case "text", "2dsphere", "2d", "hashed":
+			f.kind = key
+		case "unique":
+			f.opts.Unique = true
+		case "sparse":
+			f.opts.Sparse = true
+		case "name":
+			if value == "" {
+				return f, fmt.Errorf("field %s: empty index name", path)
+			}
+			f.opts.Name = value
+		case "ttl":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return f, fmt.Errorf("field %s: invalid ttl %q", path, value)
+			}
+			f.opts.ExpireAfter = d
+		case "partial":
+			var filter bson.M
+			if err := bson.UnmarshalJSON([]byte(value), &filter); err != nil || filter == nil {
+				return f, fmt.Errorf("field %s: invalid partial filter %q", path, value)
+			}
+			// 经 bson 编解码后内嵌文档为 bson.M, 与 listIndexes 返回的一致
+			data, err := bson.Marshal(filter)
+			if err == nil {
+				err = bson.Unmarshal(data, &f.opts.PartialFilter)
+			}
+			if err != nil {
+				return f, fmt.Errorf("field %s: invalid partial filter %q: %v", path, value, err)
+			}
+		default:
+			return f, fmt.Errorf("field %s: unknown index option %q", path, opt)
+		}
+	}
+	return f, nil
+}
+
+// splitTag 以 sep 分隔标签, 忽略引号及括号内的分隔符(partial 的 JSON 中可以包含 , 和 ;)
+func splitTag(tag string, sep byte) []string {
+	var (
+		parts  []string
+		depth  int
+		quoted bool
+		start  int
+	)
+	for i := 0; i < len(tag); i++ {
+		switch c := tag[i]; {
+		case quoted:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quoted = false
+			}
+		case c == '"':
+			quoted = true
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, tag[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, tag[start:])
+}
+
+// indexKey 将字段及类型转换为 mgo.Index.Key 的格式
+func indexKey(path, kind string) string {
+	switch kind {
+	case "1":
+		return path
+	case "-1":
+		return "-" + path
+	default:
+		return "$" + kind + ":" + path
+	}
+}
+
+// indexSpec createIndexes、listIndexes 命令中的索引文档
+type indexSpec struct {
+	Name          string `bson:"name"`
+	Key           bson.D `bson:"key"`
+	Unique        bool   `bson:"unique,omitempty"`
+	Sparse        bool   `bson:"sparse,omitempty"`
+	ExpireAfter   int    `bson:"expireAfterSeconds,omitempty"`
+	PartialFilter bson.M `bson:"partialFilterExpression,omitempty"`
+	Weights       bson.D `bson:"weights,omitempty"`
+}
+
+// spec 转换为 createIndexes 命令中的索引文档; 文本索引的字段合并为 _fts、_ftsx, 各字段的权重为1
+func (m IndexModel) spec() indexSpec {
+	s := indexSpec{
+		Name:          m.Name,
+		Unique:        m.Unique,
+		Sparse:        m.Sparse,
+		ExpireAfter:   int(m.ExpireAfter / time.Second),
+		PartialFilter: m.PartialFilter,
+	}
+	for _, k := range m.Key {
+		switch {
+		case strings.HasPrefix(k, "$text:"):
+			if s.Weights == nil {
+				s.Key = append(s.Key, bson.DocElem{Name: "_fts", Value: "text"}, bson.DocElem{Name: "_ftsx", Value: 1})
+			}
+			s.Weights = append(s.Weights, bson.DocElem{Name: k[len("$text:"):], Value: 1})
+		case strings.HasPrefix(k, "$"):
+			kind, field, _ := strings.Cut(k[1:], ":")
+			s.Key = append(s.Key, bson.DocElem{Name: field, Value: kind})
+		case strings.HasPrefix(k, "-"):
+			s.Key = append(s.Key, bson.DocElem{Name: k[1:], Value: -1})
+		default:
+			s.Key = append(s.Key, bson.DocElem{Name: k, Value: 1})
+		}
+	}
+	return s
+}
+
+// model 将 listIndexes 返回的索引文档转换为 IndexModel
+func (s indexSpec) model() IndexModel {
+	m := IndexModel{
+		Name:          s.Name,
+		Unique:        s.Unique,
+		Sparse:        s.Sparse,
+		ExpireAfter:   time.Duration(s.ExpireAfter) * time.Second,
+		PartialFilter: s.PartialFilter,
+	}
+	for _, e := range s.Key {
+		switch v := e.Value.(type) {
+		case string:
+			if v == "text" {
+				for _, w := range s.Weights {
+					m.Key = append(m.Key, "$text:"+w.Name)
+				}
+			} else {
+				m.Key = append(m.Key, "$"+v+":"+e.Name)
+			}
+		default:
+			if e.Name == "_ftsx" {
+				continue
+			}
+			if n, _ := json.Marshal(v); string(n) == "-1" {
+				m.Key = append(m.Key, "-"+e.Name)
+			} else {
+				m.Key = append(m.Key, e.Name)
+			}
+		}
+	}
+	return m
+}
+
+// sameIndex 比较两个索引的定义(不比较名称), 文本索引的字段不区分顺序
+func sameIndex(a, b IndexModel) bool {
+	return reflect.DeepEqual(normalizeKey(a.Key), normalizeKey(b.Key)) &&
+		a.Unique == b.Unique && a.Sparse == b.Sparse && a.ExpireAfter == b.ExpireAfter &&
+		canonicalJSON(a.PartialFilter) == canonicalJSON(b.PartialFilter)
+}
+
+func normalizeKey(key []string) []string {
+	out := make([]string, 0, len(key))
+	var text []string
+	for _, k := range key {
+		if strings.HasPrefix(k, "$text:") {
+			if text == nil {
+				out = append(out, "$text")
+			}
+			text = append(text, k)
+			continue
+		}
+		out = append(out, k)
+	}
+	sort.Strings(text)
+	return append(out, text...)
+}
+
+// canonicalJSON 键按字母排序的 JSON, 用于比较过滤条件(数据库返回的数值类型可能与声明时不同)
+func canonicalJSON(filter bson.M) string {
+	if filter == nil {
+		return ""
+	}
+	data, err := json.Marshal(filter)
+	if err != nil {
+		return fmt.Sprint(filter)
+	}
+	return string(data)
+}
+
+// diffIndexes 按名称比较声明的索引与已有的索引
+func diffIndexes(declared, existing []IndexModel) *IndexDiff {
+	diff := &IndexDiff{}
+	have := make(map[string]IndexModel, len(existing))
+	for _, m := range existing {
+		have[m.Name] = m
+	}
+	want := make(map[string]bool, len(declared))
+	for _, m := range declared {
+		want[m.Name] = true
+		cur, ok := have[m.Name]
+		switch {
+		case !ok:
+			diff.Missing = append(diff.Missing, m)
+		case !sameIndex(m, cur):
+			diff.Changed = append(diff.Changed, m)
+		}
+	}
+	for _, m := range existing {
+		if m.Name != "_id_" && !want[m.Name] {
+			diff.Extra = append(diff.Extra, m)
+		}
+	}
+	return diff
+}
+
+// listIndexes 读取集合中的索引, 集合不存在时返回空
+func listIndexes(co *mgo.Collection) ([]IndexModel, error) {
+	var result struct {
+		Cursor struct {
+			FirstBatch []bson.Raw `bson:"firstBatch"`
+			Id         int64      `bson:"id"`
+		} `bson:"cursor"`
+	}
+	err := co.Database.Run(bson.D{{Name: "listIndexes", Value: co.Name}}, &result)
+	if qe, ok := err.(*mgo.QueryError); ok && qe.Code == 26 { // NamespaceNotFound
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		models []IndexModel
+		spec   indexSpec
+	)
+	iter := co.NewIter(nil, result.Cursor.FirstBatch, result.Cursor.Id, nil)
+	for iter.Next(&spec) {
+		models = append(models, spec.model())
+		spec = indexSpec{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	sort.Slice(models, func(i, j int) bool { return models[i].Name < models[j].Name })
+	return models, nil
+}
+
+// DiffIndexes 比较声明的索引与集合中已有的索引, 不做任何修改
+func (d *Dao) DiffIndexes(ctx context.Context, name string, models []IndexModel) (*IndexDiff, error) {
+	var diff *IndexDiff
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		existing, err := listIndexes(session.DB(d.Name).C(name))
+		diff = diffIndexes(models, existing)
+		return err
+	})
+	if err != nil {
+		return nil, opError("DiffIndexes", name, err)
+	}
+	return diff, nil
+}
+
+// EnsureIndexes 创建缺少的索引, 在程序启动时调用; 返回创建之前的差异
+// 集合中多余的索引及定义不一致的索引不会被修改, 调用方可以据此记录日志或改为调用 SyncIndexes
+func (d *Dao) EnsureIndexes(ctx context.Context, name string, models []IndexModel) (*IndexDiff, error) {
+	diff, err := d.syncIndexes(ctx, name, models, false)
+	return diff, opError("EnsureIndexes", name, err)
+}
+
+// SyncIndexes 使集合中的索引与声明一致: 删除多余的索引, 重建定义不一致的索引, 创建缺少的索引; 返回同步之前的差异
+// 删除、重建索引期间相关查询可能变慢, 唯一约束暂时失效, 需显式开启
+func (d *Dao) SyncIndexes(ctx context.Context, name string, models []IndexModel) (*IndexDiff, error) {
+	diff, err := d.syncIndexes(ctx, name, models, true)
+	return diff, opError("SyncIndexes", name, err)
+}
+
+func (d *Dao) syncIndexes(ctx context.Context, name string, models []IndexModel, sync bool) (*IndexDiff, error) {
+	var diff *IndexDiff
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		// Database.Run 按读操作选择节点, 因此在主节点上读取及修改索引, 并使用 Session 的写关注(见 WithSafe)
+		session.SetMode(mgo.Strong, false)
+		co := session.DB(d.Name).C(name)
+		existing, err := listIndexes(co)
+		if err != nil {
+			return err
+		}
+		diff = diffIndexes(models, existing)
+
+		create := diff.Missing
+		if sync {
+			drop := append(append([]IndexModel(nil), diff.Extra...), diff.Changed...)
+			for _, m := range drop {
+				if err := co.DropIndexName(m.Name); err != nil {
+					return err
+				}
+			}
+			create = append(append([]IndexModel(nil), create...), diff.Changed...)
+		}
+		if len(create) == 0 {
+			return nil
+		}
+		specs := make([]indexSpec, len(create))
+		for i, m := range create {
+			specs[i] = m.spec()
+		}
+		return co.Database.Run(bson.D{
+			{Name: "createIndexes", Value: name},
+			{Name: "indexes", Value: specs},
+			{Name: "writeConcern", Value: commandWriteConcern(session.Safe())},
+		}, nil)
+	})
+	return diff, err
+}
+
+// Indexes 返回模型 T 声明的索引
+func (r *Repository[T]) Indexes() ([]IndexModel, error) {
+	return Indexes[T]()
+}
+
+// EnsureIndexes 创建模型 T 声明而集合中缺少的索引, 同 Dao.EnsureIndexes
+func (r *Repository[T]) EnsureIndexes(ctx context.Context) (*IndexDiff, error) {
+	models, err := Indexes[T]()
+	if err != nil {
+		return nil, opError("EnsureIndexes", r.name, err)
+	}
+	return r.dao.EnsureIndexes(ctx, r.name, models)
+}
+
+// DiffIndexes 比较模型 T 声明的索引与集合中已有的索引, 同 Dao.DiffIndexes
+func (r *Repository[T]) DiffIndexes(ctx context.Context) (*IndexDiff, error) {
+	models, err := Indexes[T]()
+	if err != nil {
+		return nil, opError("DiffIndexes", r.name, err)
+	}
+	return r.dao.DiffIndexes(ctx, r.name, models)
+}
+
+// SyncIndexes 使集合中的索引与模型 T 的声明一致, 同 Dao.SyncIndexes
+func (r *Repository[T]) SyncIndexes(ctx context.Context) (*IndexDiff, error) {
+	models, err := Indexes[T]()
+	if err != nil {
+		return nil, opError("SyncIndexes", r.name, err)
+	}
+	return r.dao.SyncIndexes(ctx, r.name, models)
+}
@@ -0,0 +1,153 @@
+/*
+ * 说明：索引管理单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:27
+ * 更新：
+ */
+
+package dao
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+	"mongodb.golang.com/src/model"
+)
+
+type place struct {
+	Id       bson.ObjectId `bson:"_id,omitempty"`
+	Account  string        `bson:"account" index:"unique,partial={\"is_delete\": false, \"age\": {\"$gt\": 0}}"`
+	City     string        `bson:"city" index:"name=city_age;text,name=search"`
+	Age      int           `bson:"age" index:"name=city_age,desc"`
+	Remark   string        `bson:"remark" index:"text,name=search"`
+	Location []float64     `bson:"location" index:"2dsphere"`
+	Expire   time.Time     `bson:"expire" index:"ttl=24h,sparse"`
+	Tags     []placeTag    `bson:"tags"`
+	IsDelete bool          `bson:"is_delete"`
+}
+
+type placeTag struct {
+	Name string `bson:"name" index:"hashed"`
+}
+
+func TestParseIndexes(t *testing.T) {
+	got, err := Indexes[place]()
+	if err != nil {
+		t.Fatalf("Indexes() error = %v", err)
+	}
+	want := []IndexModel{
+		{Name: "account_1", Key: []string{"account"}, Unique: true, PartialFilter: bson.M{"is_delete": false, "age": bson.M{"$gt": float64(0)}}},
+		{Name: "city_age", Key: []string{"city", "-age"}},
+		{Name: "search", Key: []string{"$text:city", "$text:remark"}},
+		{Name: "location_2dsphere", Key: []string{"$2dsphere:location"}},
+		{Name: "expire_1", Key: []string{"expire"}, Sparse: true, ExpireAfter: 24 * time.Hour},
+		{Name: "tags.name_hashed", Key: []string{"$hashed:tags.name"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Indexes() =\n%v\nwant\n%v", got, want)
+	}
+
+	users, err := Indexes[model.User]()
+	if err != nil || len(users) == 0 || users[0].Name != "account_1" || !users[0].Unique {
+		t.Errorf("Indexes[model.User]() = %v, %v", users, err)
+	}
+}
+
+func TestParseIndexes_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"unknown option", struct {
+			A int `index:"uniq"`
+		}{}, `unknown index option "uniq"`},
+		{"bad ttl", struct {
+			A time.Time `index:"ttl=1day"`
+		}{}, `invalid ttl "1day"`},
+		{"bad partial", struct {
+			A int `index:"partial={a:"`
+		}{}, "invalid partial filter"},
+		{"compound ttl", struct {
+			A time.Time `index:"name=ab,ttl=1h"`
+			B int       `index:"name=ab"`
+		}{}, "ttl requires a single"},
+		{"conflicting partial", struct {
+			A int `index:"name=ab,partial={\"a\": 1}"`
+			B int `index:"name=ab,partial={\"b\": 1}"`
+		}{}, "conflicting partial filter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseIndexes(reflect.TypeOf(tt.v))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseIndexes() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSpecRoundTrip(t *testing.T) {
+	declared, err := Indexes[place]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range declared {
+		// 模拟数据库返回: 数值类型为 float64, 文本索引字段按字母顺序
+		data, err := bson.Marshal(m.spec())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var spec indexSpec
+		if err := bson.Unmarshal(data, &spec); err != nil {
+			t.Fatal(err)
+		}
+		for i, e := range spec.Key {
+			if n, ok := e.Value.(int); ok {
+				spec.Key[i].Value = float64(n)
+			}
+		}
+		if len(spec.Weights) > 1 {
+			spec.Weights[0], spec.Weights[1] = spec.Weights[1], spec.Weights[0]
+		}
+		if got := spec.model(); !sameIndex(got, m) {
+			t.Errorf("spec().model() = %v, want %v", got, m)
+		}
+	}
+}
+
+func TestDiffIndexes(t *testing.T) {
+	declared := []IndexModel{
+		{Name: "account_1", Key: []string{"account"}, Unique: true},
+		{Name: "create_at_-1", Key: []string{"-create_at"}},
+		{Name: "age_1", Key: []string{"age"}},
+	}
+	existing := []IndexModel{
+		{Name: "_id_", Key: []string{"_id"}},
+		{Name: "account_1", Key: []string{"account"}, Unique: true, Sparse: true},
+		{Name: "create_at_-1", Key: []string{"-create_at"}},
+		{Name: "first_1", Key: []string{"first"}},
+	}
+	diff := diffIndexes(declared, existing)
+	names := func(models []IndexModel) (s []string) {
+		for _, m := range models {
+			s = append(s, m.Name)
+		}
+		return s
+	}
+	if got := names(diff.Missing); !reflect.DeepEqual(got, []string{"age_1"}) {
+		t.Errorf("Missing = %v", got)
+	}
+	if got := names(diff.Extra); !reflect.DeepEqual(got, []string{"first_1"}) {
+		t.Errorf("Extra = %v", got)
+	}
+	if got := names(diff.Changed); !reflect.DeepEqual(got, []string{"account_1"}) {
+		t.Errorf("Changed = %v", got)
+	}
+	if diff.Empty() || diffIndexes(declared[:2], existing[:1]).Empty() || !diffIndexes(nil, existing[:1]).Empty() {
+		t.Errorf("Empty() mismatch")
+	}
+}
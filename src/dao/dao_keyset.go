@@ -0,0 +1,346 @@
+/*
+ * 说明：键集分页
+ * 作者：agent
+ * 时间：2026-10-18 08:18
+ * 更新：按排序字段的值翻页, 代替大集合上越来越慢、数据变化时会重复/遗漏的 Skip(offset).Limit(limit)
+ */
+
+package dao
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultKeysetLimit 未指定每页数量时的默认值
+const DefaultKeysetLimit = 20
+
+// PageTokenKey 翻页令牌的签名密钥, 默认在进程启动时随机生成
+// 多个实例共同提供服务时需设置为相同的密钥, 否则其它实例签发的令牌无法通过校验
+var PageTokenKey = randomKey(32)
+
+func randomKey(n int) []byte {
+	key := make([]byte, n)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// ErrInvalidPageToken 翻页令牌格式错误、签名不符或与本次查询的集合、查询条件、排序字段不一致
+var ErrInvalidPageToken = fmt.Errorf("%w: invalid page token", ErrInvalidSelector)
+
+// Keyset 键集分页参数
+type Keyset struct {
+	Limit int    // 每页数量, <=0 时为 DefaultKeysetLimit
+	Token string // 上一页结果中的 Next 或 Prev, 为空时返回第一页
+}
+
+// KeysetPage 键集分页结果
+type KeysetPage struct {
+	Items interface{} `json:"items"`          // 本页的文档
+	Next  string      `json:"next,omitempty"` // 下一页的令牌, 没有下一页时为空
+	Prev  string      `json:"prev,omitempty"` // 上一页的令牌, 没有上一页时为空
+}
+
+// keysetToken 翻页令牌的内容, 序列化为 bson 后签名并以 base64 编码
+type keysetToken struct {
+	Collection string        `bson:"c"`
+	Keys       []string      `bson:"k"`           // 排序字段(含 _id), 与本次查询不一致时拒绝
+	Filter     []byte        `bson:"f,omitempty"` // 查询条件的摘要, 与本次查询不一致时拒绝
+	Values     []interface{} `bson:"v"`           // 边界文档的排序字段值
+	Backward   bool          `bson:"b,omitempty"` // 向前翻页
+}
+
+// sortKey 排序字段
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+func (k sortKey) String() string {
+	if k.desc {
+		return "-" + k.field
+	}
+	return k.field
+}
+
+// parseSortKeys 解析排序字段, 未指定时按 -create_at 排序, 并以 _id 作为最后一个排序字段保证顺序唯一
+func parseSortKeys(sortKeys []string) []sortKey {
+	if len(sortKeys) == 0 {
+		sortKeys = []string{"-create_at"}
+	}
+	keys := make([]sortKey, 0, len(sortKeys)+1)
+	hasId := false
+	for _, s := range sortKeys {
+		k := sortKey{field: strings.TrimLeft(s, "+-"), desc: strings.HasPrefix(s, "-")}
+		hasId = hasId || k.field == "_id"
+		keys = append(keys, k)
+	}
+	if !hasId {
+		keys = append(keys, sortKey{field: "_id", desc: keys[len(keys)-1].desc})
+	}
+	return keys
+}
+
+// filterHash 计算查询条件的摘要, 先转换为 bson.M 再按字段名递归排序, 使字段顺序不同的同一条件得到相同的摘要
+func filterHash(query interface{}) ([]byte, error) {
+	raw, err := bson.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+	m := bson.M{}
+	if err := bson.Unmarshal(raw, m); err != nil {
+		return nil, err
+	}
+	if raw, err = bson.Marshal(sortedDoc(m)); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return sum[:], nil
+}
+
+// sortedDoc 将 bson.M 递归转换为按字段名排序的 bson.D
+func sortedDoc(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.M:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		doc := make(bson.D, len(names))
+		for i, name := range names {
+			doc[i] = bson.DocElem{Name: name, Value: sortedDoc(v[name])}
+		}
+		return doc
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, e := range v {
+			list[i] = sortedDoc(e)
+		}
+		return list
+	}
+	return v
+}
+
+// encodePageToken 签名并编码翻页令牌
+func encodePageToken(t *keysetToken) (string, error) {
+	payload, err := bson.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, PageTokenKey)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(payload)), nil
+}
+
+// decodePageToken 校验签名并解码翻页令牌
+func decodePageToken(s string) (*keysetToken, error) {
+	data, err := base64.RawURLEncoding.Strict().DecodeString(s)
+	if err != nil || len(data) <= sha256.Size {
+		return nil, ErrInvalidPageToken
+	}
+	payload, sum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	mac := hmac.New(sha256.New, PageTokenKey)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return nil, ErrInvalidPageToken
+	}
+
+	t := &keysetToken{}
+	if err := bson.Unmarshal(payload, t); err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	return t, nil
+}
+
+// keysetFilter 生成位于边界文档之后(backward 为 true 时之前)的查询条件, 例如按 -age, _id 排序时:
+// {"$or": [{"age": {"$lt": v0}}, {"age": v0, "_id": {"$lt": v1}}]}
+func keysetFilter(keys []sortKey, values []interface{}, backward bool) bson.M {
+	or := make([]interface{}, 0, len(keys))
+	for i, k := range keys {
+		clause := bson.M{}
+		for j := 0; j < i; j++ {
+			clause[keys[j].field] = values[j]
+		}
+		op := "$gt"
+		if k.desc != backward {
+			op = "$lt"
+		}
+		clause[k.field] = bson.M{op: values[i]}
+		or = append(or, clause)
+	}
+	return bson.M{"$or": or}
+}
+
+// keyValues 读取文档中排序字段的值, doc 可以是 bson.M 或结构体
+func keyValues(doc interface{}, keys []sortKey) ([]interface{}, error) {
+	m, ok := doc.(bson.M)
+	if !ok {
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		if err := bson.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+	}
+
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		var v interface{} = m
+		for _, seg := range strings.Split(k.field, ".") {
+			switch sub := v.(type) {
+			case bson.M:
+				v = sub[seg]
+			case map[string]interface{}:
+				v = sub[seg]
+			default:
+				v = nil
+			}
+		}
+		if v == nil {
+			return nil, fmt.Errorf("%w: sort key %s is missing from the result document", ErrInvalidSelector, k.field)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// FindDocKeyset 按键集分页查找文档, Items 为 []bson.M
+// name集合名称; query查询条件(*Operator 时只使用其查询条件); ks分页参数; sortKeys排序字段(结果中必须包含这些字段)
+func (d *Dao) FindDocKeyset(name string, query interface{}, ks Keyset, sortKeys ...string) (*KeysetPage, error) {
+	return d.FindDocKeysetCtx(context.Background(), name, query, ks, sortKeys...)
+}
+
+// FindDocKeysetCtx 同 FindDocKeyset, ctx 结束时中止查询及结果遍历
+func (d *Dao) FindDocKeysetCtx(ctx context.Context, name string, query interface{}, ks Keyset, sortKeys ...string) (*KeysetPage, error) {
+	var results []bson.M
+	page, err := d.findKeyset(ctx, name, &results, query, ks, sortKeys)
+	if err != nil {
+		return nil, opError("FindDocKeyset", name, err)
+	}
+	return page, nil
+}
+
+// FindDocToResultsKeyset 按键集分页查找文档, 其结果写入 results(结构体切片的指针), Items 为 results 指向的切片
+func (d *Dao) FindDocToResultsKeyset(name string, results, query interface{}, ks Keyset, sortKeys ...string) (*KeysetPage, error) {
+	return d.FindDocToResultsKeysetCtx(context.Background(), name, results, query, ks, sortKeys...)
+}
+
+// FindDocToResultsKeysetCtx 同 FindDocToResultsKeyset, ctx 结束时中止查询及结果遍历, 此时不会写入 results
+func (d *Dao) FindDocToResultsKeysetCtx(ctx context.Context, name string, results, query interface{}, ks Keyset, sortKeys ...string) (*KeysetPage, error) {
+	if v := reflect.ValueOf(results); v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("results must be a pointer to a slice")
+	}
+	page, err := d.findKeyset(ctx, name, results, query, ks, sortKeys)
+	if err != nil {
+		return nil, opError("FindDocToResultsKeyset", name, err)
+	}
+	return page, nil
+}
+
+// findKeyset 多读取一个文档判断是否还有下一页(向前翻页时为上一页), 向前翻页时按相反的顺序查询后再倒序
+func (d *Dao) findKeyset(ctx context.Context, name string, results, query interface{}, ks Keyset, sortKeys []string) (*KeysetPage, error) {
+	if query == nil {
+		return nil, errNull
+	}
+	if err := noCount(query); err != nil {
+		return nil, err
+	}
+	limit := ks.Limit
+	if limit <= 0 {
+		limit = DefaultKeysetLimit
+	}
+
+	keys := parseSortKeys(sortKeys)
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.String()
+	}
+
+	query = d.scope(name, query)
+	hash, err := filterHash(query)
+	if err != nil {
+		return nil, err
+	}
+	backward := false
+	filter := query
+	if ks.Token != "" {
+		token, err := decodePageToken(ks.Token)
+		if err != nil {
+			return nil, err
+		}
+		if token.Collection != name || !reflect.DeepEqual(token.Keys, names) || len(token.Values) != len(keys) {
+			return nil, fmt.Errorf("%w: issued for a different collection or sort", ErrInvalidPageToken)
+		}
+		if !hmac.Equal(token.Filter, hash) {
+			return nil, fmt.Errorf("%w: issued for a different filter", ErrInvalidPageToken)
+		}
+		backward = token.Backward
+		filter = bson.M{"$and": []interface{}{query, keysetFilter(keys, token.Values, backward)}}
+	}
+
+	order := make([]string, len(keys))
+	for i, k := range keys {
+		if backward {
+			k.desc = !k.desc
+		}
+		order[i] = k.String()
+	}
+
+	err = d.decodeCtx(ctx, results, func(session *mgo.Session, out interface{}) error {
+		q := session.DB(d.Name).C(name).Find(filter).Sort(order...).Limit(limit + 1)
+		return allCtx(ctx, withMaxTime(ctx, q).Iter(), out)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slice := reflect.ValueOf(results).Elem()
+	more := slice.Len() > limit
+	if more {
+		slice.Set(slice.Slice(0, limit))
+	}
+	if backward {
+		swap := reflect.Swapper(slice.Interface())
+		for i, j := 0, slice.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	page := &KeysetPage{Items: slice.Interface()}
+	if slice.Len() == 0 {
+		return page, nil
+	}
+	token := func(i int, backward bool) (string, error) {
+		values, err := keyValues(slice.Index(i).Interface(), keys)
+		if err != nil {
+			return "", err
+		}
+		return encodePageToken(&keysetToken{Collection: name, Keys: names, Filter: hash, Values: values, Backward: backward})
+	}
+	// 向后翻页时, 第一页之后总有上一页; 向前翻页时, 来自后面的页, 总有下一页
+	if more || backward {
+		if page.Next, err = token(slice.Len()-1, false); err != nil {
+			return nil, err
+		}
+	}
+	if (backward && more) || (!backward && ks.Token != "") {
+		if page.Prev, err = token(0, true); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,165 @@
+/*
+ * 说明：键集分页单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:18
+ * 更新：
+ */
+
+package dao
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+	"mongodb.golang.com/src/model"
+)
+
+func TestParseSortKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		sortKeys []string
+		want     []sortKey
+	}{
+		{name: "default", want: []sortKey{{"create_at", true}, {"_id", true}}},
+		{name: "multi", sortKeys: []string{"-age", "+name"}, want: []sortKey{{"age", true}, {"name", false}, {"_id", false}}},
+		{name: "explicit _id", sortKeys: []string{"-_id"}, want: []sortKey{{"_id", true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSortKeys(tt.sortKeys); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSortKeys() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageToken(t *testing.T) {
+	id := bson.NewObjectId()
+	hash, err := filterHash(bson.M{"age": bson.M{"$gte": 18}})
+	if err != nil {
+		t.Fatalf("filterHash() error = %v", err)
+	}
+	token := &keysetToken{Collection: "users", Keys: []string{"-age", "-_id"}, Filter: hash, Values: []interface{}{18, id}, Backward: true}
+
+	s, err := encodePageToken(token)
+	if err != nil {
+		t.Fatalf("encodePageToken() error = %v", err)
+	}
+	got, err := decodePageToken(s)
+	if err != nil {
+		t.Fatalf("decodePageToken() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, token) {
+		t.Errorf("decodePageToken() = %+v, want %+v", got, token)
+	}
+
+	// 修改任意一个字节都无法通过校验
+	data := []byte(s)
+	for i := range data {
+		tampered := append([]byte(nil), data...)
+		tampered[i] ^= 'A' ^ 'B'
+		if _, err := decodePageToken(string(tampered)); err == nil {
+			t.Fatalf("decodePageToken(tampered at %d) error = nil", i)
+		}
+	}
+	if _, err := decodePageToken("not-a-token"); !errors.Is(err, ErrInvalidPageToken) {
+		t.Errorf("decodePageToken() error = %v, want ErrInvalidPageToken", err)
+	}
+}
+
+func TestFilterHash(t *testing.T) {
+	hash := func(query interface{}) string {
+		sum, err := filterHash(query)
+		if err != nil {
+			t.Fatalf("filterHash(%v) error = %v", query, err)
+		}
+		return string(sum)
+	}
+
+	base := hash(bson.M{"age": bson.M{"$gte": 18, "$lt": 30}, "address.city": "hz"})
+	tests := []struct {
+		name  string
+		query interface{}
+		same  bool
+	}{
+		{name: "same", query: bson.M{"address.city": "hz", "age": bson.M{"$lt": 30, "$gte": 18}}, same: true},
+		{name: "bson.D", query: bson.D{{Name: "age", Value: bson.D{{Name: "$lt", Value: 30}, {Name: "$gte", Value: 18}}}, {Name: "address.city", Value: "hz"}}, same: true},
+		{name: "different value", query: bson.M{"age": bson.M{"$gte": 18, "$lt": 40}, "address.city": "hz"}},
+		{name: "different field", query: bson.M{"age": bson.M{"$gte": 18, "$lt": 30}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hash(tt.query) == base; got != tt.same {
+				t.Errorf("filterHash() equal = %v, want %v", got, tt.same)
+			}
+		})
+	}
+}
+
+func TestKeysetFilter(t *testing.T) {
+	id := bson.NewObjectId()
+	keys := []sortKey{{"age", true}, {"name", false}, {"_id", false}}
+	values := []interface{}{18, "zhe", id}
+
+	want := bson.M{"$or": []interface{}{
+		bson.M{"age": bson.M{"$lt": 18}},
+		bson.M{"age": 18, "name": bson.M{"$gt": "zhe"}},
+		bson.M{"age": 18, "name": "zhe", "_id": bson.M{"$gt": id}},
+	}}
+	if got := keysetFilter(keys, values, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("keysetFilter(forward) = %v, want %v", got, want)
+	}
+
+	want = bson.M{"$or": []interface{}{
+		bson.M{"age": bson.M{"$gt": 18}},
+		bson.M{"age": 18, "name": bson.M{"$lt": "zhe"}},
+		bson.M{"age": 18, "name": "zhe", "_id": bson.M{"$lt": id}},
+	}}
+	if got := keysetFilter(keys, values, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("keysetFilter(backward) = %v, want %v", got, want)
+	}
+}
+
+func TestKeyValues(t *testing.T) {
+	user := model.User{Id: bson.NewObjectId(), Age: 18, Address: model.Address{City: "hz"}}
+	keys := parseSortKeys([]string{"-age", "address.city"})
+
+	got, err := keyValues(user, keys)
+	if err != nil {
+		t.Fatalf("keyValues() error = %v", err)
+	}
+	if want := []interface{}{18, "hz", user.Id}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keyValues() = %v, want %v", got, want)
+	}
+
+	if _, err := keyValues(bson.M{"_id": user.Id}, keys); !errors.Is(err, ErrInvalidSelector) {
+		t.Errorf("keyValues(missing key) error = %v, want ErrInvalidSelector", err)
+	}
+}
+
+func TestDao_FindDocKeysetToken(t *testing.T) {
+	// 令牌校验在访问数据库之前完成, 因此 Session 为 nil 也不会 panic
+	d := &Dao{Name: "mongo"}
+	other, err := encodePageToken(&keysetToken{Collection: "users", Keys: []string{"name", "_id"}, Values: []interface{}{"zhe", bson.NewObjectId()}})
+	if err != nil {
+		t.Fatalf("encodePageToken() error = %v", err)
+	}
+
+	hash, err := filterHash(bson.M{"age": bson.M{"$gte": 18}})
+	if err != nil {
+		t.Fatalf("filterHash() error = %v", err)
+	}
+	filtered, err := encodePageToken(&keysetToken{Collection: "users", Keys: []string{"-age", "-_id"}, Filter: hash, Values: []interface{}{18, bson.NewObjectId()}})
+	if err != nil {
+		t.Fatalf("encodePageToken() error = %v", err)
+	}
+
+	for name, token := range map[string]string{"malformed": "xxx", "different sort": other, "different filter": filtered} {
+		_, err := d.FindDocKeyset("users", bson.M{"age": bson.M{"$gte": 20}}, Keyset{Limit: 5, Token: token}, "-age")
+		if !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("%s: FindDocKeyset() error = %v, want ErrInvalidPageToken", name, err)
+		}
+	}
+}
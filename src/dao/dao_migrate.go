@@ -0,0 +1,384 @@
+/*
+ * 说明：数据迁移
+ * 作者：agent
+ * 时间：2026-10-18 08:29
+ * 更新：按版本号顺序执行迁移, 已执行的版本及校验和记录在 migrations 集合中, 代替手工执行的脚本
+ */
+
+package dao
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// 迁移的默认配置
+const (
+	DefaultMigrationCollection = "migrations"     // 记录已执行迁移的集合, 锁位于 <集合>_lock
+	DefaultMigrationLockTTL    = 10 * time.Minute // 锁的有效期, 持有者异常退出后超过有效期可被其它实例获取
+)
+
+var (
+	ErrMigrationLocked   = errors.New("migration lock is held by another instance")                // 其它实例正在执行迁移
+	ErrMigrationMismatch = errors.New("applied migrations do not match the registered migrations") // 已执行的迁移被修改或删除
+	ErrIrreversible      = errors.New("migration has no Down function")                            // 迁移不能回滚
+)
+
+// Migration 一个迁移, Up 执行迁移, Down 回滚迁移
+// Up、Down 失败时不会记录, 下次仍会执行, 因此应当可以重复执行(如 $rename 前先判断字段是否存在)
+type Migration struct {
+	Version     int    // 版本号, 大于0且不能重复, 按升序执行
+	Name        string // 名称, 如 rename_book_to_movies
+	Description string // 说明, 与版本号、名称一起计算校验和
+	Up          func(ctx context.Context, d *Dao) error
+	Down        func(ctx context.Context, d *Dao) error // 为 nil 时不能回滚
+}
+
+// Checksum 由版本号、名称及说明计算, 修改已执行迁移的名称或说明后 Status 会报告 modified
+// Go 函数无法参与计算, 修改已执行迁移的实现时应同时修改其说明
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d\x00%s\x00%s", m.Version, m.Name, m.Description)))
+	return hex.EncodeToString(sum[:])
+}
+
+// MigrationState 迁移的状态
+type MigrationState string
+
+const (
+	MigrationPending  MigrationState = "pending"  // 未执行
+	MigrationApplied  MigrationState = "applied"  // 已执行
+	MigrationModified MigrationState = "modified" // 已执行, 但校验和与当前定义不同
+	MigrationMissing  MigrationState = "missing"  // 已执行, 但当前程序中没有该版本
+)
+
+// MigrationStatus 迁移的执行情况
+type MigrationStatus struct {
+	Version   int            `json:"version"`
+	Name      string         `json:"name"`
+	State     MigrationState `json:"state"`
+	AppliedAt *time.Time     `json:"applied_at,omitempty"`
+}
+
+// migrationRecord 迁移集合中的文档
+type migrationRecord struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	Checksum  string    `bson:"checksum"`
+	AppliedAt time.Time `bson:"applied_at"`
+	Duration  int64     `bson:"duration_ms"`
+}
+
+// Migrator 迁移执行器, 用法:
+//
+//	m, err := NewMigrator(d, UserMigrations...)
+//	if err != nil {
+//		return err
+//	}
+//	m.DryRun = true // 只返回将要执行的迁移
+//	applied, err := m.Up(ctx, 0)
+//
+// 多个实例同时调用 Up、Down 时只有一个能获得锁, 其它实例返回 ErrMigrationLocked
+type Migrator struct {
+	Collection string        // 记录已执行迁移的集合, 默认 DefaultMigrationCollection
+	LockTTL    time.Duration // 锁的有效期, 默认 DefaultMigrationLockTTL; 每执行完一个迁移续期一次, 应大于单个迁移的耗时
+	DryRun     bool          // 为 true 时 Up、Down 只返回将要执行的迁移, 不做任何修改
+	Owner      string        // 锁的持有者, 默认为 主机名:进程号:随机数
+
+	dao        *Dao
+	migrations []Migration
+}
+
+// NewMigrator 初始化迁移执行器, 校验迁移的版本号、名称及 Up 函数
+func NewMigrator(d *Dao, migrations ...Migration) (*Migrator, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		switch {
+		case m.Version <= 0:
+			return nil, fmt.Errorf("migration %q: version must be positive", m.Name)
+		case i > 0 && sorted[i-1].Version == m.Version:
+			return nil, fmt.Errorf("migration %d: duplicate version (%s, %s)", m.Version, sorted[i-1].Name, m.Name)
+		case m.Name == "":
+			return nil, fmt.Errorf("migration %d: empty name", m.Version)
+		case m.Up == nil:
+			return nil, fmt.Errorf("migration %d %s: Up is nil", m.Version, m.Name)
+		}
+	}
+
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return &Migrator{
+		Collection: DefaultMigrationCollection,
+		LockTTL:    DefaultMigrationLockTTL,
+		Owner:      fmt.Sprintf("%s:%d:%x", host, os.Getpid(), suffix),
+		dao:        d,
+		migrations: sorted,
+	}, nil
+}
+
+// Status 返回所有迁移的执行情况, 按版本号升序, 包括已执行但当前程序中没有的版本
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, opError("MigrationStatus", m.Collection, err)
+	}
+	session := m.session(ctx)
+	defer session.Close()
+	status, err := m.status(ctx, session)
+	return status, opError("MigrationStatus", m.Collection, err)
+}
+
+// session 拷贝读写迁移记录及锁使用的 Session
+// 在主节点上读写(Strong), 否则从节点可能尚未复制上一个锁持有者写入的记录, 导致已执行的迁移被再次执行;
+// ctx 带有截止时间时将 socket 超时时间设置为剩余时间
+func (m *Migrator) session(ctx context.Context) *mgo.Session {
+	session := m.dao.cursorSession(ctx)
+	session.SetMode(mgo.Strong, false)
+	return session
+}
+
+func (m *Migrator) status(ctx context.Context, session *mgo.Session) ([]MigrationStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var records []migrationRecord
+	if err := withMaxTime(ctx, session.DB(m.dao.Name).C(m.Collection).Find(nil)).All(&records); err != nil {
+		return nil, ctxError(ctx, err)
+	}
+	applied := make(map[int]migrationRecord, len(records))
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	appliedAt := func(r migrationRecord) *time.Time {
+		return &r.AppliedAt
+	}
+
+	status := make([]MigrationStatus, 0, len(m.migrations)+len(records))
+	for _, mig := range m.migrations {
+		s := MigrationStatus{Version: mig.Version, Name: mig.Name, State: MigrationPending}
+		if r, ok := applied[mig.Version]; ok {
+			s.State, s.AppliedAt = MigrationApplied, appliedAt(r)
+			if r.Checksum != mig.Checksum() {
+				s.State = MigrationModified
+			}
+			delete(applied, mig.Version)
+		}
+		status = append(status, s)
+	}
+	for _, r := range applied {
+		status = append(status, MigrationStatus{Version: r.Version, Name: r.Name, State: MigrationMissing, AppliedAt: appliedAt(r)})
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+	return status, nil
+}
+
+// Report 将执行情况以表格形式写入 w
+func (m *Migrator) Report(ctx context.Context, w io.Writer) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	for _, s := range status {
+		at := "-"
+		if s.AppliedAt != nil {
+			at = s.AppliedAt.Local().Format(TimeLayout)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Version, s.Name, s.State, at)
+	}
+	return tw.Flush()
+}
+
+// Up 按版本号升序执行未执行的迁移, target 为最后执行的版本号, <=0 时执行全部
+// 返回已执行(DryRun 时为将要执行)的迁移; 已执行的迁移被修改或删除时返回 ErrMigrationMismatch, 不执行任何迁移
+func (m *Migrator) Up(ctx context.Context, target int) ([]MigrationStatus, error) {
+	done, err := m.run(ctx, true, target)
+	return done, opError("MigrateUp", m.Collection, err)
+}
+
+// Down 按版本号降序回滚版本号大于 target 的迁移, target 为0时回滚全部
+// 返回已回滚(DryRun 时为将要回滚)的迁移; 其中有迁移不能回滚时返回 ErrIrreversible, 不回滚任何迁移
+func (m *Migrator) Down(ctx context.Context, target int) ([]MigrationStatus, error) {
+	if target < 0 {
+		return nil, opError("MigrateDown", m.Collection, fmt.Errorf("invalid target version %d", target))
+	}
+	done, err := m.run(ctx, false, target)
+	return done, opError("MigrateDown", m.Collection, err)
+}
+
+// run 获得锁后重新计算计划并依次执行, 每执行完一个迁移立即记录并为锁续期
+// 锁、执行情况及迁移记录均通过同一个 Session 在主节点上读写(见 session)
+func (m *Migrator) run(ctx context.Context, up bool, target int) ([]MigrationStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	session := m.session(ctx)
+	defer session.Close()
+
+	if m.DryRun {
+		steps, err := m.plan(ctx, session, up, target)
+		if err != nil {
+			return nil, err
+		}
+		done := make([]MigrationStatus, len(steps))
+		for i, s := range steps {
+			done[i] = MigrationStatus{Version: s.Version, Name: s.Name, State: MigrationPending}
+		}
+		return done, nil
+	}
+
+	if err := m.lock(ctx, session); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	steps, err := m.plan(ctx, session, up, target)
+	if err != nil {
+		return nil, err
+	}
+	var done []MigrationStatus
+	for _, s := range steps {
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+		fn, state := s.Up, MigrationApplied
+		if !up {
+			fn, state = s.Down, MigrationPending
+		}
+
+		start := time.Now()
+		if err := fn(ctx, m.dao); err != nil {
+			return done, fmt.Errorf("migration %d %s: %w", s.Version, s.Name, err)
+		}
+		co := session.DB(m.dao.Name).C(m.Collection)
+		if up {
+			err = co.Insert(&migrationRecord{
+				Version:   s.Version,
+				Name:      s.Name,
+				Checksum:  s.Checksum(),
+				AppliedAt: start.UTC(),
+				Duration:  time.Since(start).Milliseconds(),
+			})
+		} else {
+			err = co.RemoveId(s.Version)
+		}
+		if err = ctxError(ctx, err); err != nil {
+			return done, fmt.Errorf("migration %d %s: record: %w", s.Version, s.Name, err)
+		}
+		status := MigrationStatus{Version: s.Version, Name: s.Name, State: state}
+		if up {
+			at := start.UTC()
+			status.AppliedAt = &at
+		}
+		done = append(done, status)
+
+		if err := m.refresh(ctx, session); err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// plan 返回将要执行(up)或回滚的迁移
+func (m *Migrator) plan(ctx context.Context, session *mgo.Session, up bool, target int) ([]Migration, error) {
+	status, err := m.status(ctx, session)
+	if err != nil {
+		return nil, err
+	}
+	return planMigrations(m.migrations, status, up, target)
+}
+
+// planMigrations 根据执行情况计算将要执行(up)或回滚的迁移
+func planMigrations(migrations []Migration, status []MigrationStatus, up bool, target int) ([]Migration, error) {
+	byVersion := make(map[int]Migration, len(migrations))
+	for _, mig := range migrations {
+		byVersion[mig.Version] = mig
+	}
+
+	var (
+		steps []Migration
+		bad   []string
+	)
+	for _, s := range status {
+		if s.State == MigrationModified || s.State == MigrationMissing {
+			bad = append(bad, fmt.Sprintf("%d %s (%s)", s.Version, s.Name, s.State))
+			continue
+		}
+		if up && s.State == MigrationPending && (target <= 0 || s.Version <= target) {
+			steps = append(steps, byVersion[s.Version])
+		}
+		if !up && s.State == MigrationApplied && s.Version > target {
+			steps = append([]Migration{byVersion[s.Version]}, steps...)
+		}
+	}
+	if len(bad) > 0 {
+		return nil, fmt.Errorf("%w: %v", ErrMigrationMismatch, bad)
+	}
+	if !up {
+		for _, s := range steps {
+			if s.Down == nil {
+				return nil, fmt.Errorf("migration %d %s: %w", s.Version, s.Name, ErrIrreversible)
+			}
+		}
+	}
+	return steps, nil
+}
+
+// lockId 锁文档的 _id
+const lockId = "lock"
+
+// lock 获取锁: 锁不存在或已过期时写入自己的锁, 否则违反 _id 唯一约束, 返回 ErrMigrationLocked
+func (m *Migrator) lock(ctx context.Context, session *mgo.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	co := session.DB(m.dao.Name).C(m.Collection + "_lock")
+	_, err := co.Upsert(
+		bson.M{"_id": lockId, "expire_at": bson.M{"$lt": now}},
+		bson.M{"_id": lockId, "owner": m.Owner, "locked_at": now, "expire_at": now.Add(m.LockTTL)},
+	)
+	if mgo.IsDup(err) {
+		var held bson.M
+		if co.FindId(lockId).One(&held) == nil {
+			return fmt.Errorf("%w: owner %v, expires at %v", ErrMigrationLocked, held["owner"], held["expire_at"])
+		}
+		return ErrMigrationLocked
+	}
+	return ctxError(ctx, err)
+}
+
+// refresh 为锁续期, 锁已过期并被其它实例获取时返回 ErrMigrationLocked
+func (m *Migrator) refresh(ctx context.Context, session *mgo.Session) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err := session.DB(m.dao.Name).C(m.Collection+"_lock").Update(
+		bson.M{"_id": lockId, "owner": m.Owner},
+		bson.M{"$set": bson.M{"expire_at": time.Now().UTC().Add(m.LockTTL)}},
+	)
+	if err == mgo.ErrNotFound {
+		return fmt.Errorf("%w: lock expired and was taken over", ErrMigrationLocked)
+	}
+	return ctxError(ctx, err)
+}
+
+// unlock 释放自己持有的锁; ctx 可能已结束(run 的 Session 的 socket 超时可能已到期), 因此使用新的 Session 且不使用 ctx
+func (m *Migrator) unlock() {
+	session := m.dao.SessionCopy()
+	defer session.Close()
+	session.DB(m.dao.Name).C(m.Collection + "_lock").Remove(bson.M{"_id": lockId, "owner": m.Owner})
+}
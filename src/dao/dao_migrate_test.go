@@ -0,0 +1,179 @@
+/*
+ * 说明：数据迁移单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:29
+ * 更新：
+ */
+
+package dao
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func noop(ctx context.Context, d *Dao) error { return nil }
+
+func TestNewMigrator(t *testing.T) {
+	tests := []struct {
+		name       string
+		migrations []Migration
+		want       string
+	}{
+		{"zero version", []Migration{{Name: "a", Up: noop}}, "version must be positive"},
+		{"duplicate", []Migration{{Version: 1, Name: "a", Up: noop}, {Version: 1, Name: "b", Up: noop}}, "duplicate version"},
+		{"no name", []Migration{{Version: 1, Up: noop}}, "empty name"},
+		{"no up", []Migration{{Version: 1, Name: "a"}}, "Up is nil"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMigrator(&Dao{}, tt.migrations...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewMigrator() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	m, err := NewMigrator(&Dao{}, Migration{Version: 2, Name: "b", Up: noop}, Migration{Version: 1, Name: "a", Up: noop})
+	if err != nil || m.migrations[0].Version != 1 || m.Collection != DefaultMigrationCollection || m.Owner == "" {
+		t.Errorf("NewMigrator() = %+v, %v", m, err)
+	}
+	if _, err := NewMigrator(&Dao{}, UserMigrations...); err != nil {
+		t.Errorf("NewMigrator(UserMigrations) error = %v", err)
+	}
+}
+
+func TestMigration_Checksum(t *testing.T) {
+	a := Migration{Version: 1, Name: "a", Description: "x"}
+	if a.Checksum() != (Migration{Version: 1, Name: "a", Description: "x", Up: noop}).Checksum() {
+		t.Errorf("Checksum() depends on Up")
+	}
+	for _, b := range []Migration{{Version: 2, Name: "a", Description: "x"}, {Version: 1, Name: "b", Description: "x"}, {Version: 1, Name: "a"}} {
+		if a.Checksum() == b.Checksum() {
+			t.Errorf("Checksum() of %+v equals %+v", b, a)
+		}
+	}
+}
+
+func TestPlanMigrations(t *testing.T) {
+	migrations := []Migration{
+		{Version: 1, Name: "a", Up: noop, Down: noop},
+		{Version: 2, Name: "b", Up: noop},
+		{Version: 3, Name: "c", Up: noop, Down: noop},
+		{Version: 4, Name: "d", Up: noop, Down: noop},
+	}
+	status := []MigrationStatus{
+		{Version: 1, State: MigrationApplied},
+		{Version: 2, State: MigrationApplied},
+		{Version: 3, State: MigrationApplied},
+		{Version: 4, State: MigrationPending},
+	}
+	versions := func(steps []Migration) (v []int) {
+		for _, s := range steps {
+			v = append(v, s.Version)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name    string
+		status  []MigrationStatus
+		up      bool
+		target  int
+		want    []int
+		wantErr error
+	}{
+		{name: "up all", status: status, up: true, want: []int{4}},
+		{name: "up to 3", status: status, up: true, target: 3},
+		{name: "down to 2", status: status, target: 2, want: []int{3}},
+		{name: "down irreversible", status: status, target: 0, wantErr: ErrIrreversible},
+		{name: "modified", status: append([]MigrationStatus{{Version: 0, State: MigrationModified}}, status...), up: true, wantErr: ErrMigrationMismatch},
+		{name: "missing", status: append(status[:4:4], MigrationStatus{Version: 9, State: MigrationMissing}), target: 2, wantErr: ErrMigrationMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := planMigrations(migrations, tt.status, tt.up, tt.target)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("planMigrations() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := versions(steps); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planMigrations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrationStatus_JSON(t *testing.T) {
+	at := time.Date(2018, 1, 30, 5, 47, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status MigrationStatus
+		want   string
+	}{
+		{"pending", MigrationStatus{Version: 1, Name: "a", State: MigrationPending},
+			`{"version":1,"name":"a","state":"pending"}`},
+		{"applied", MigrationStatus{Version: 1, Name: "a", State: MigrationApplied, AppliedAt: &at},
+			`{"version":1,"name":"a","state":"applied","applied_at":"2018-01-30T05:47:00Z"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.status)
+			if err != nil || string(got) != tt.want {
+				t.Errorf("json.Marshal() = %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrator_CtxCanceled(t *testing.T) {
+	m, err := NewMigrator(&Dao{}, UserMigrations...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	m.DryRun = true
+	if _, err := m.Up(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Up() error = %v, want context.Canceled", err)
+	}
+	m.DryRun = false
+	if _, err := m.Down(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("Down() error = %v, want context.Canceled", err)
+	}
+	if _, err := m.Down(ctx, -1); err == nil {
+		t.Errorf("Down(-1) error = nil")
+	}
+}
+
+func TestConvertTimestampFields(t *testing.T) {
+	at := time.Date(2018, 1, 17, 22, 55, 0, 0, time.Local)
+	legacy := bson.M{"create_at": "2018-01-17 22:55:00", "modify_at": "2018-01-17 22:55:00", "delete_at": "", "name": "zhe"}
+	dates := bson.M{"create_at": at.UTC(), "modify_at": at.UTC(), "delete_at": nil}
+
+	set, err := convertTimestampFields(legacy, true)
+	if err != nil || !reflect.DeepEqual(set, dates) {
+		t.Errorf("convertTimestampFields(toDate) = %v, %v, want %v", set, err, dates)
+	}
+	// 已转换的文档不再更新
+	if set, _ := convertTimestampFields(dates, true); len(set) != 0 {
+		t.Errorf("convertTimestampFields(dates, toDate) = %v, want empty", set)
+	}
+
+	set, err = convertTimestampFields(dates, false)
+	delete(legacy, "name")
+	if err != nil || !reflect.DeepEqual(set, legacy) {
+		t.Errorf("convertTimestampFields(back) = %v, %v, want %v", set, err, legacy)
+	}
+
+	if _, err := convertTimestampFields(bson.M{"create_at": "yesterday"}, true); err == nil {
+		t.Errorf("convertTimestampFields(invalid) error = nil")
+	}
+}
@@ -0,0 +1,309 @@
+/*
+ * 说明：查询操作符
+ * 作者：agent
+ * 时间：2026-10-18 08:14
+ * 更新：解析 search={"q.sort": "name", "q.select": {...}} 形式的查询参数, 见 _docs/01.Base.md
+ */
+
+package dao
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// OperatorPrefix 查询操作符前缀, 操作符以 mgo.Query 对应的方法名命名
+const OperatorPrefix = "q."
+
+// 查询操作符
+const (
+	OpSelect = "q.select" // 指定返回的字段: {"name": 1, "age": 1}、["name", "-age"] 或 "name,-age"
+	OpSort   = "q.sort"   // 排序字段: "-age,name" 或 ["-age", "name"]
+	OpSkip   = "q.skip"   // 跳过的文档数量, 非负整数
+	OpLimit  = "q.limit"  // 返回的最大文档数量, 非负整数, 0 表示不限制
+	OpHint   = "q.hint"   // 使用的索引: "account" 或 ["-create_at", "name"]
+	OpCount  = "q.count"  // true 时返回匹配的文档数量而不是文档
+)
+
+// OperatorOrder 操作符在 mgo.Query 上的执行顺序
+// 与书写顺序无关: Find(条件) => Select => Hint => Sort => Skip => Limit => Count
+var OperatorOrder = []string{OpSelect, OpHint, OpSort, OpSkip, OpLimit, OpCount}
+
+// OperatorError 查询操作符解析错误, errors.Is(err, ErrInvalidSelector) 为 true
+type OperatorError struct {
+	Op     string      // 操作符, 如 q.sort
+	Value  interface{} // 操作符的值
+	Reason string      // 错误原因
+}
+
+func (e *OperatorError) Error() string {
+	if e.Value == nil {
+		return fmt.Sprintf("operator %s: %s", e.Op, e.Reason)
+	}
+	return fmt.Sprintf("operator %s: %s (got %#v)", e.Op, e.Reason, e.Value)
+}
+
+func (e *OperatorError) Unwrap() error {
+	return ErrInvalidSelector
+}
+
+// Operator 解析后的查询参数: 查询条件及 mgo.Query 的修饰操作
+// 可以直接作为 FindWithQuery、FindDoc 等方法的 query 参数
+type Operator struct {
+	Filter bson.M   // 查询条件(不以 q. 开头的键)
+	Select bson.M   // q.select
+	Sort   []string // q.sort
+	Skip   *int     // q.skip
+	Limit  *int     // q.limit
+	Hint   []string // q.hint
+	Count  bool     // q.count
+}
+
+// ParseOperator 解析 JSON 格式的查询参数, 如 {"name": "zhe", "q.sort": "-age", "q.limit": 10}
+func ParseOperator(search []byte) (*Operator, error) {
+	var m map[string]interface{}
+	if err := json.Unmarshal(search, &m); err != nil {
+		return nil, fmt.Errorf("%w: search must be a JSON object: %v", ErrInvalidSelector, err)
+	}
+	return NewOperator(m)
+}
+
+// NewOperator 从查询参数中分离出查询条件和 q. 操作符
+// 未知的 q. 操作符或值不合法时返回 *OperatorError; 多个错误时返回按操作符名称排序的第一个
+func NewOperator(search map[string]interface{}) (*Operator, error) {
+	o := &Operator{Filter: bson.M{}}
+
+	keys := make([]string, 0, len(search))
+	for k := range search {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := search[k]
+		if !strings.HasPrefix(k, OperatorPrefix) {
+			o.Filter[k] = v
+			continue
+		}
+
+		var err error
+		switch k {
+		case OpSelect:
+			o.Select, err = parseSelect(v)
+		case OpSort:
+			o.Sort, err = parseKeys(v)
+		case OpSkip:
+			o.Skip, err = parseCount(v)
+		case OpLimit:
+			o.Limit, err = parseCount(v)
+		case OpHint:
+			o.Hint, err = parseKeys(v)
+		case OpCount:
+			b, ok := v.(bool)
+			if !ok {
+				err = fmt.Errorf("must be a boolean")
+			}
+			o.Count = b
+		default:
+			return nil, &OperatorError{Op: k, Reason: fmt.Sprintf("unknown operator, supported: %s", strings.Join(OperatorOrder, ", "))}
+		}
+		if err != nil {
+			return nil, &OperatorError{Op: k, Value: v, Reason: err.Error()}
+		}
+	}
+	return o, nil
+}
+
+// GetBSON 实现 bson.Getter, *Operator 直接用作查询条件时只使用 Filter
+func (o *Operator) GetBSON() (interface{}, error) {
+	return o.Filter, nil
+}
+
+// apply 按 OperatorOrder 将操作符应用到 q
+// 未指定 q.sort 时使用 sortKeys, 都未指定时按 -create_at 排序; 未指定 q.skip/q.limit 时使用 page
+func (o *Operator) apply(q *mgo.Query, page Page, sortKeys ...string) *mgo.Query {
+	if o != nil && o.Select != nil {
+		q = q.Select(o.Select)
+	}
+	if o != nil && len(o.Hint) > 0 {
+		q = q.Hint(o.Hint...)
+	}
+
+	if o != nil && len(o.Sort) > 0 {
+		sortKeys = o.Sort
+	}
+	if len(sortKeys) == 0 {
+		sortKeys = append(sortKeys, "-create_at")
+	}
+	q = q.Sort(sortKeys...)
+
+	if o == nil || (o.Skip == nil && o.Limit == nil) {
+		if page.Valid {
+			q = q.Skip(page.Offset).Limit(page.Limit)
+		}
+		return q
+	}
+	if o.Skip != nil {
+		q = q.Skip(*o.Skip)
+	}
+	if o.Limit != nil {
+		q = q.Limit(*o.Limit)
+	}
+	return q
+}
+
+// noCount query 为指定了 q.count 的 *Operator 时返回错误, 用于只能返回文档的方法
+func noCount(query interface{}) error {
+	if op, ok := query.(*Operator); ok && op.Count {
+		return &OperatorError{Op: OpCount, Value: true, Reason: "not supported here, use FindDoc or Count"}
+	}
+	return nil
+}
+
+// parseSelect 解析 q.select, 返回 mgo.Query.Select 使用的字段文档
+// 除 _id 外, 不能同时包含返回(1)和不返回(0)的字段
+func parseSelect(v interface{}) (bson.M, error) {
+	fields := bson.M{}
+	switch s := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(s))
+		for k := range s {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			flag := s[k]
+			if k == "" {
+				return nil, fmt.Errorf("empty field name")
+			}
+			switch f := flag.(type) {
+			case bool:
+				fields[k] = boolToInt(f)
+			default:
+				n, err := parseCount(flag)
+				if err != nil || *n > 1 {
+					return nil, fmt.Errorf("field %q must be 0, 1 or a boolean", k)
+				}
+				fields[k] = *n
+			}
+		}
+	default:
+		keys, err := parseKeys(v)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			if strings.HasPrefix(k, "-") {
+				fields[k[1:]] = 0
+			} else {
+				fields[k] = 1
+			}
+		}
+	}
+
+	var include, exclude []string
+	for k, flag := range fields {
+		if k == "_id" {
+			continue
+		}
+		if flag == 1 {
+			include = append(include, k)
+		} else {
+			exclude = append(exclude, k)
+		}
+	}
+	if len(include) > 0 && len(exclude) > 0 {
+		sort.Strings(include)
+		sort.Strings(exclude)
+		return nil, fmt.Errorf("cannot mix inclusion %v and exclusion %v", include, exclude)
+	}
+	return fields, nil
+}
+
+// parseKeys 解析以逗号分隔的字符串或字符串数组, 字段名可以带 - 前缀
+func parseKeys(v interface{}) ([]string, error) {
+	var keys []string
+	switch s := v.(type) {
+	case string:
+		keys = strings.Split(s, ",")
+	case []string:
+		keys = s
+	case []interface{}:
+		for _, e := range s {
+			k, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("must be a string or an array of strings")
+			}
+			keys = append(keys, k)
+		}
+	default:
+		return nil, fmt.Errorf("must be a string or an array of strings")
+	}
+
+	out := make([]string, 0, len(keys))
+	for _, k := range keys {
+		k = strings.TrimSpace(k)
+		if name := strings.TrimLeft(k, "+-"); name == "" || strings.HasPrefix(name, "$") {
+			return nil, fmt.Errorf("invalid field name %q", k)
+		}
+		out = append(out, k)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("must not be empty")
+	}
+	return out, nil
+}
+
+// parseCount 解析非负整数, 支持 JSON 数字、Go 整数类型及数字字符串
+func parseCount(v interface{}) (*int, error) {
+	var n int64
+	switch c := v.(type) {
+	case int:
+		n = int64(c)
+	case int32:
+		n = int64(c)
+	case int64:
+		n = c
+	case float64:
+		if c != math.Trunc(c) || c > math.MaxInt32 || c < math.MinInt32 {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		n = int64(c)
+	case json.Number:
+		i, err := c.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		n = i
+	case string:
+		i, err := strconv.ParseInt(c, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		n = i
+	default:
+		return nil, fmt.Errorf("must be an integer")
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("must not be negative")
+	}
+	if n > math.MaxInt32 {
+		return nil, fmt.Errorf("must not exceed %d", math.MaxInt32)
+	}
+	i := int(n)
+	return &i, nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
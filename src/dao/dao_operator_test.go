@@ -0,0 +1,108 @@
+/*
+ * 说明：查询操作符单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:14
+ * 更新：
+ */
+
+package dao
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func TestParseOperator(t *testing.T) {
+	tests := []struct {
+		name    string
+		search  string
+		want    *Operator
+		wantOp  string // 期望出错的操作符
+		wantErr bool
+	}{
+		{
+			name:   "filter only",
+			search: `{"name": "zhe", "age": {"$gt": 1}}`,
+			want:   &Operator{Filter: bson.M{"name": "zhe", "age": map[string]interface{}{"$gt": float64(1)}}},
+		},
+		{
+			name: "all operators",
+			search: `{"name": "zhe", "q.select": {"name": 1, "age": true, "_id": 0}, "q.sort": "-age, name",
+				"q.skip": 10, "q.limit": "5", "q.hint": ["account"], "q.count": false}`,
+			want: &Operator{
+				Filter: bson.M{"name": "zhe"},
+				Select: bson.M{"name": 1, "age": 1, "_id": 0},
+				Sort:   []string{"-age", "name"},
+				Skip:   intPtr(10),
+				Limit:  intPtr(5),
+				Hint:   []string{"account"},
+			},
+		},
+		{
+			name:   "select list",
+			search: `{"q.select": ["-password", "-email"], "q.count": true}`,
+			want:   &Operator{Filter: bson.M{}, Select: bson.M{"password": 0, "email": 0}, Count: true},
+		},
+		{name: "mixed select", search: `{"q.sort": "name", "q.select": {"name": 0, "age": 1}}`, wantOp: OpSelect, wantErr: true},
+		{name: "select flag", search: `{"q.select": {"name": 2}}`, wantOp: OpSelect, wantErr: true},
+		{name: "unknown operator", search: `{"q.order": "name"}`, wantOp: "q.order", wantErr: true},
+		{name: "empty sort key", search: `{"q.sort": "name,,age"}`, wantOp: OpSort, wantErr: true},
+		{name: "sort operator injection", search: `{"q.sort": "$natural"}`, wantOp: OpSort, wantErr: true},
+		{name: "negative skip", search: `{"q.skip": -1}`, wantOp: OpSkip, wantErr: true},
+		{name: "fractional limit", search: `{"q.limit": 1.5}`, wantOp: OpLimit, wantErr: true},
+		{name: "hint type", search: `{"q.hint": 1}`, wantOp: OpHint, wantErr: true},
+		{name: "count type", search: `{"q.count": "yes"}`, wantOp: OpCount, wantErr: true},
+		{name: "not an object", search: `["q.sort"]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOperator([]byte(tt.search))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOperator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrInvalidSelector) {
+					t.Errorf("ParseOperator() error = %v, want ErrInvalidSelector", err)
+				}
+				var opErr *OperatorError
+				if tt.wantOp != "" && (!errors.As(err, &opErr) || opErr.Op != tt.wantOp) {
+					t.Errorf("ParseOperator() error = %v, want *OperatorError for %s", err, tt.wantOp)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseOperator() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperator_GetBSON(t *testing.T) {
+	op, err := NewOperator(map[string]interface{}{"name": "zhe", "q.limit": 1})
+	if err != nil {
+		t.Fatalf("NewOperator() error = %v", err)
+	}
+	data, err := bson.Marshal(op)
+	if err != nil {
+		t.Fatalf("bson.Marshal() error = %v", err)
+	}
+	var got bson.M
+	if err := bson.Unmarshal(data, &got); err != nil {
+		t.Fatalf("bson.Unmarshal() error = %v", err)
+	}
+	if want := (bson.M{"name": "zhe"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("bson.Marshal(*Operator) = %v, want %v", got, want)
+	}
+
+	op.Count = true
+	if err := noCount(op); err == nil {
+		t.Error("noCount() = nil, want error for q.count")
+	}
+}
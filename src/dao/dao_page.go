@@ -0,0 +1,195 @@
+/*
+ * 说明：分页查询
+ * 作者：agent
+ * 时间：2026-10-18 08:20
+ * 更新：FindPage 同时返回本页文档、匹配的文档总数及页码信息, 调用方不再需要另外统计总数
+ */
+
+package dao
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CountMode 统计文档总数的方式
+type CountMode int
+
+const (
+	CountExact     CountMode = iota // 在同一会话中先执行 count 再查询本页文档
+	CountFacet                      // 使用 $facet 在一次聚合中同时返回本页文档和总数, 本页文档总大小不能超过16MB
+	CountEstimated                  // 使用集合的文档总数(由元数据得出, 忽略查询条件), 适用于不带条件浏览超大集合
+)
+
+// PageInfo 分页信息
+type PageInfo struct {
+	Page      int  `json:"page"`                // 当前页码, 从1开始
+	PageSize  int  `json:"page_size"`           // 每页数量, 0 表示不分页
+	Pages     int  `json:"pages"`               // 总页数
+	HasMore   bool `json:"has_more"`            // 是否还有下一页
+	HasPrev   bool `json:"has_prev"`            // 是否有上一页
+	Estimated bool `json:"estimated,omitempty"` // Total 是否为估计值(CountEstimated)
+}
+
+// PageResult 分页查询结果
+type PageResult struct {
+	Items interface{} `json:"items"` // 本页文档
+	Total int         `json:"total"` // 匹配的文档总数
+	PageInfo
+}
+
+// Response 转换为 Response, 序列化时包含分页信息
+func (p *PageResult) Response() Response {
+	info := p.PageInfo
+	return Response{Total: p.Total, Data: p.Items, Page: &info}
+}
+
+// newPageResult 根据总数、分页参数及本页文档数量计算分页信息
+func newPageResult(items interface{}, total, n int, page Page) *PageResult {
+	p := &PageResult{Items: items, Total: total}
+	offset := 0
+	if page.Valid {
+		offset = page.Offset
+		p.PageSize = page.Limit
+	}
+
+	p.Page, p.Pages = 1, 0
+	if p.PageSize > 0 {
+		p.Page = offset/p.PageSize + 1
+		p.Pages = (total + p.PageSize - 1) / p.PageSize
+	} else if total > 0 {
+		p.Pages = 1
+	}
+	p.HasPrev = offset > 0
+	p.HasMore = offset+n < total
+	return p
+}
+
+// FindPage 分页查找文档, 返回本页文档、匹配的文档总数及页码信息
+// name集合名称; results结果切片的指针, 为 nil 时 Items 为 []bson.M; query查询条件(可以是 *Operator);
+// page指定分页参数; count统计总数的方式; sortKeys指定排序字段
+func (d *Dao) FindPage(name string, results, query interface{}, page Page, count CountMode, sortKeys ...string) (*PageResult, error) {
+	return d.FindPageCtx(context.Background(), name, results, query, page, count, sortKeys...)
+}
+
+// FindPageCtx 同 FindPage, ctx 结束时中止查询, 此时不会写入 results
+func (d *Dao) FindPageCtx(ctx context.Context, name string, results, query interface{}, page Page, count CountMode, sortKeys ...string) (*PageResult, error) {
+	if results == nil {
+		results = &[]bson.M{}
+	}
+	if v := reflect.ValueOf(results); v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("results must be a pointer to a slice")
+	}
+	if query == nil {
+		return nil, opError("FindPage", name, errNull)
+	}
+	if err := noCount(query); err != nil {
+		return nil, opError("FindPage", name, err)
+	}
+
+	page = effectivePage(query, page)
+	scoped := d.scope(name, query)
+	var total int
+	err := d.decodeCtx(ctx, results, func(session *mgo.Session, out interface{}) error {
+		co := session.DB(d.Name).C(name)
+
+		var err error
+		switch count {
+		case CountFacet:
+			var res struct {
+				Items bson.Raw `bson:"items"`
+				Total []struct {
+					N int `bson:"n"`
+				} `bson:"total"`
+			}
+			pipeline := facetPipeline(scoped, page, sortKeys)
+			if err = co.Pipe(pipeline).AllowDiskUse().One(&res); err != nil {
+				return err
+			}
+			if len(res.Total) > 0 {
+				total = res.Total[0].N
+			}
+			return res.Items.Unmarshal(out)
+		case CountEstimated:
+			total, err = co.Count()
+		default:
+			total, err = withMaxTime(ctx, co.Find(scoped)).Count()
+		}
+		if err != nil {
+			return err
+		}
+		q := d.findQuery(ctx, session, name, query, page, sortKeys...)
+		return allCtx(ctx, q.Iter(), out)
+	})
+	if err != nil {
+		return nil, opError("FindPage", name, err)
+	}
+
+	items := reflect.ValueOf(results).Elem()
+	p := newPageResult(items.Interface(), total, items.Len(), page)
+	p.Estimated = count == CountEstimated
+	return p, nil
+}
+
+// effectivePage 返回实际使用的分页参数, *Operator 指定了 q.skip、q.limit 时以其为准(同 Operator.apply)
+func effectivePage(query interface{}, page Page) Page {
+	op, ok := query.(*Operator)
+	if !ok || (op.Skip == nil && op.Limit == nil) {
+		return page
+	}
+	p := Page{Valid: true}
+	if op.Skip != nil {
+		p.Offset = *op.Skip
+	}
+	if op.Limit != nil {
+		p.Limit = *op.Limit
+	}
+	return p
+}
+
+// facetPipeline 生成 $facet 聚合管道: items 为排序、分页后的本页文档, total 为匹配的文档总数
+func facetPipeline(query interface{}, page Page, sortKeys []string) []bson.M {
+	var project bson.M
+	if op, ok := query.(*Operator); ok {
+		query, project = op.Filter, op.Select
+		if len(op.Sort) > 0 {
+			sortKeys = op.Sort
+		}
+	}
+	if len(sortKeys) == 0 {
+		sortKeys = []string{"-create_at"}
+	}
+	sort := make(bson.D, 0, len(sortKeys))
+	for _, k := range sortKeys {
+		order := 1
+		if strings.HasPrefix(k, "-") {
+			order = -1
+		}
+		sort = append(sort, bson.DocElem{Name: strings.TrimLeft(k, "+-"), Value: order})
+	}
+
+	items := []bson.M{{"$skip": 0}}
+	if page.Valid {
+		items[0]["$skip"] = page.Offset
+		if page.Limit > 0 {
+			items = append(items, bson.M{"$limit": page.Limit})
+		}
+	}
+	if len(project) > 0 {
+		items = append(items, bson.M{"$project": project})
+	}
+
+	return []bson.M{
+		{"$match": query},
+		{"$sort": sort},
+		{"$facet": bson.M{
+			"items": items,
+			"total": []bson.M{{"$count": "n"}},
+		}},
+	}
+}
@@ -0,0 +1,90 @@
+/*
+ * 说明：分页查询单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:20
+ * 更新：
+ */
+
+package dao
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestNewPageResult(t *testing.T) {
+	tests := []struct {
+		name  string
+		total int
+		n     int
+		page  Page
+		want  PageInfo
+	}{
+		{name: "first page", total: 23, n: 10, page: Page{Valid: true, Offset: 0, Limit: 10},
+			want: PageInfo{Page: 1, PageSize: 10, Pages: 3, HasMore: true}},
+		{name: "middle page", total: 23, n: 10, page: Page{Valid: true, Offset: 10, Limit: 10},
+			want: PageInfo{Page: 2, PageSize: 10, Pages: 3, HasMore: true, HasPrev: true}},
+		{name: "last page", total: 23, n: 3, page: Page{Valid: true, Offset: 20, Limit: 10},
+			want: PageInfo{Page: 3, PageSize: 10, Pages: 3, HasPrev: true}},
+		{name: "not paged", total: 5, n: 5, want: PageInfo{Page: 1, Pages: 1}},
+		{name: "empty", total: 0, n: 0, page: Page{Valid: true, Limit: 10}, want: PageInfo{Page: 1, PageSize: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newPageResult(nil, tt.total, tt.n, tt.page)
+			if got.Total != tt.total || got.PageInfo != tt.want {
+				t.Errorf("newPageResult() = %+v, want %+v", got.PageInfo, tt.want)
+			}
+		})
+	}
+}
+
+func TestFacetPipeline(t *testing.T) {
+	op, err := ParseOperator([]byte(`{"age": 2, "q.sort": "-age,name", "q.skip": 5, "q.limit": 5, "q.select": "name"}`))
+	if err != nil {
+		t.Fatalf("ParseOperator() error = %v", err)
+	}
+	page := effectivePage(op, Page{})
+	if page != (Page{Valid: true, Offset: 5, Limit: 5}) {
+		t.Errorf("effectivePage() = %+v", page)
+	}
+
+	want := []bson.M{
+		{"$match": bson.M{"age": float64(2)}},
+		{"$sort": bson.D{{Name: "age", Value: -1}, {Name: "name", Value: 1}}},
+		{"$facet": bson.M{
+			"items": []bson.M{{"$skip": 5}, {"$limit": 5}, {"$project": bson.M{"name": 1}}},
+			"total": []bson.M{{"$count": "n"}},
+		}},
+	}
+	if got := facetPipeline(op, page, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("facetPipeline() = %v, want %v", got, want)
+	}
+}
+
+func TestPageResult_Response(t *testing.T) {
+	p := newPageResult([]bson.M{{"_id": "1", "name": "zhe"}}, 11, 1, Page{Valid: true, Offset: 10, Limit: 10})
+	resp := p.Response()
+	data, err := resp.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON() error = %v", err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"total": float64(11),
+		"data":  []interface{}{map[string]interface{}{"id": "1", "name": "zhe"}},
+		"page": map[string]interface{}{
+			"page": float64(2), "page_size": float64(10), "pages": float64(2), "has_more": false, "has_prev": true,
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MarshalJSON() = %s", data)
+	}
+}
@@ -0,0 +1,161 @@
+/*
+ * 说明：查询句柄
+ * 作者：agent
+ * 时间：2026-10-18 08:23
+ * 更新：QueryHandle 持有自己的 Session, 代替 FindWithQuery 返回的、Session 已关闭的 *mgo.Query
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gopkg.in/mgo.v2"
+)
+
+// ErrQueryClosed 查询句柄关闭后仍被使用
+var ErrQueryClosed = errors.New("query handle is closed")
+
+// QueryHandle 查询句柄, 持有一个拷贝的 Session, 使用完毕后必须调用 Close, 用法:
+//
+//	h, err := d.Query(ctx, "users", bson.M{"age": 2}, Page{})
+//	if err != nil {
+//		return err
+//	}
+//	defer h.Close()
+//	n, err := h.Count()
+//	err = h.Select(bson.M{"name": 1}).Sort("-age").All(&users)
+//
+// Select、Sort 等链式方法修改查询本身并返回同一个句柄; 关闭后调用链式方法会 panic, 调用其它方法返回 ErrQueryClosed
+// QueryHandle 不能在多个 goroutine 中同时使用
+type QueryHandle struct {
+	name    string
+	ctx     context.Context
+	session *mgo.Session
+	query   *mgo.Query
+	closed  bool
+}
+
+// Query 按条件、分页及排序字段创建查询句柄, 参数同 FindDoc(query 可以是 *Operator)
+// ctx 带有截止时间时为查询设置 maxTimeMS 及 socket 超时; 每次执行查询前都会检查 ctx
+func (d *Dao) Query(ctx context.Context, name string, query interface{}, page Page, sortKeys ...string) (*QueryHandle, error) {
+	if query == nil {
+		return nil, opError("Query", name, errNull)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, opError("Query", name, err)
+	}
+
+	session := d.cursorSession(ctx)
+	return &QueryHandle{
+		name:    name,
+		ctx:     ctx,
+		session: session,
+		query:   d.findQuery(ctx, session, name, query, page, sortKeys...),
+	}, nil
+}
+
+// mustOpen 链式方法在句柄关闭后调用时 panic
+func (h *QueryHandle) mustOpen(method string) {
+	if h.closed {
+		panic(fmt.Sprintf("dao: QueryHandle.%s called after Close (collection %s)", method, h.name))
+	}
+}
+
+// check 执行查询前检查句柄是否已关闭、ctx 是否已结束
+func (h *QueryHandle) check() error {
+	if h.closed {
+		return ErrQueryClosed
+	}
+	return h.ctx.Err()
+}
+
+// Select 指定返回的字段, 如 bson.M{"name": 1, "age": 1}
+func (h *QueryHandle) Select(selector interface{}) *QueryHandle {
+	h.mustOpen("Select")
+	h.query.Select(selector)
+	return h
+}
+
+// Sort 指定排序字段, 替换创建句柄时的排序字段
+func (h *QueryHandle) Sort(fields ...string) *QueryHandle {
+	h.mustOpen("Sort")
+	h.query.Sort(fields...)
+	return h
+}
+
+// Hint 指定使用的索引
+func (h *QueryHandle) Hint(indexKey ...string) *QueryHandle {
+	h.mustOpen("Hint")
+	h.query.Hint(indexKey...)
+	return h
+}
+
+// Batch 指定每批从服务器读取的文档数量
+func (h *QueryHandle) Batch(n int) *QueryHandle {
+	h.mustOpen("Batch")
+	h.query.Batch(n)
+	return h
+}
+
+// Comment 为查询添加注释, 便于在 profiler 及日志中定位
+func (h *QueryHandle) Comment(comment string) *QueryHandle {
+	h.mustOpen("Comment")
+	h.query.Comment(comment)
+	return h
+}
+
+// One 读取第一个文档写入 result, 未找到时返回 ErrNotFound
+func (h *QueryHandle) One(result interface{}) error {
+	if err := h.check(); err != nil {
+		return opError("Query.One", h.name, err)
+	}
+	return opError("Query.One", h.name, ctxError(h.ctx, h.query.One(result)))
+}
+
+// All 读取全部文档写入 result(切片的指针), 每读取一个文档都会检查 ctx
+func (h *QueryHandle) All(result interface{}) error {
+	if err := h.check(); err != nil {
+		return opError("Query.All", h.name, err)
+	}
+	return opError("Query.All", h.name, allCtx(h.ctx, h.query.Iter(), result))
+}
+
+// Iter 返回遍历结果的游标, 游标使用句柄的 Session, 因此需在关闭句柄之前使用完毕
+func (h *QueryHandle) Iter() (*Cursor, error) {
+	if err := h.check(); err != nil {
+		return nil, opError("Query.Iter", h.name, err)
+	}
+	return &Cursor{op: "Query.Iter", name: h.name, ctx: h.ctx, iter: h.query.Iter()}, nil
+}
+
+// Count 返回匹配的文档数量, 受 Skip、Limit 影响
+func (h *QueryHandle) Count() (int, error) {
+	if err := h.check(); err != nil {
+		return 0, opError("Query.Count", h.name, err)
+	}
+	n, err := h.query.Count()
+	if err != nil {
+		return 0, opError("Query.Count", h.name, ctxError(h.ctx, err))
+	}
+	return n, nil
+}
+
+// Explain 返回查询计划, result 通常为 bson.M
+func (h *QueryHandle) Explain(result interface{}) error {
+	if err := h.check(); err != nil {
+		return opError("Query.Explain", h.name, err)
+	}
+	return opError("Query.Explain", h.name, ctxError(h.ctx, h.query.Explain(result)))
+}
+
+// Close 关闭句柄及其 Session, 可以重复调用
+func (h *QueryHandle) Close() {
+	if h.closed {
+		return
+	}
+	h.closed = true
+	h.session.Close()
+}
@@ -0,0 +1,73 @@
+/*
+ * 说明：查询句柄单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:23
+ * 更新：
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestDao_QueryCtxCanceled(t *testing.T) {
+	d := &Dao{Name: "mongo"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := d.Query(ctx, "users", bson.M{}, Page{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Query() error = %v, want context.Canceled", err)
+	}
+	if _, err := d.Query(context.Background(), "users", nil, Page{}); !errors.Is(err, ErrInvalidSelector) {
+		t.Errorf("Query(nil) error = %v, want ErrInvalidSelector", err)
+	}
+	if _, err := d.FindWithQueryCtx(ctx, "users", bson.M{}, Page{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("FindWithQueryCtx() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestQueryHandle_Closed(t *testing.T) {
+	h := &QueryHandle{name: "users", ctx: context.Background(), closed: true}
+
+	var users []bson.M
+	var user bson.M
+	errs := map[string]error{
+		"One":     h.One(&user),
+		"All":     h.All(&users),
+		"Explain": h.Explain(&user),
+	}
+	_, errs["Iter"] = h.Iter()
+	_, errs["Count"] = h.Count()
+	for name, err := range errs {
+		if !errors.Is(err, ErrQueryClosed) {
+			t.Errorf("%s() after Close error = %v, want ErrQueryClosed", name, err)
+		}
+	}
+
+	chains := map[string]func(){
+		"Select":  func() { h.Select(bson.M{"name": 1}) },
+		"Sort":    func() { h.Sort("-age") },
+		"Hint":    func() { h.Hint("account") },
+		"Batch":   func() { h.Batch(100) },
+		"Comment": func() { h.Comment("export") },
+	}
+	for name, fn := range chains {
+		func() {
+			defer func() {
+				r := recover()
+				if msg, _ := r.(string); !strings.Contains(msg, "QueryHandle."+name+" called after Close") {
+					t.Errorf("%s() after Close recovered %v, want panic", name, r)
+				}
+			}()
+			fn()
+		}()
+	}
+
+	h.Close() // 重复关闭不会 panic
+}
@@ -0,0 +1,352 @@
+/*
+ * 说明：泛型数据访问对象
+ * 作者：agent
+ * 时间：2026-10-18 08:12
+ * 更新：Repository[T] 按模型类型读写集合, 直接返回 T/[]T, 不再需要对 interface{} 做类型断言
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gedex/inflector"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CollectionTag 指定集合名称的结构体标签, 可标注在任意字段上(通常为 _ 字段), 例如:
+//
+//	type Person struct {
+//		_  struct{}      `collection:"people"`
+//		Id bson.ObjectId `bson:"_id,omitempty"`
+//	}
+const CollectionTag = "collection"
+
+// CollectionName 返回模型 T 对应的集合名称
+// 优先使用 collection 标签, 否则为类型名称的复数小写形式, 如 User => users
+func CollectionName[T any]() string {
+	return collectionName(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+func collectionName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			if name := t.Field(i).Tag.Get(CollectionTag); name != "" {
+				return name
+			}
+		}
+	}
+	return strings.ToLower(inflector.Pluralize(t.Name()))
+}
+
+// Repository 模型 T 的数据访问对象, T 为结构体类型(如 model.User)
+// 所有方法的第一个参数为 ctx, ctx 结束时中止操作, 与 Dao 的 ...Ctx 方法一致
+type Repository[T any] struct {
+	dao    *Dao
+	name   string
+	filter *FilterPolicy
+}
+
+// NewRepository 初始化 Repository, 集合名称由 CollectionName[T] 得出
+func NewRepository[T any](dao *Dao) *Repository[T] {
+	return &Repository[T]{dao: dao, name: CollectionName[T](), filter: NewFilterPolicy[T]()}
+}
+
+// Name 返回集合名称
+func (r *Repository[T]) Name() string {
+	return r.name
+}
+
+// Filter 返回集合的查询条件校验规则, 用于校验客户端传入的查询条件, 可修改其中的操作符白名单及限制
+func (r *Repository[T]) Filter() *FilterPolicy {
+	return r.filter
+}
+
+// Dao 返回底层的 Dao, 用于执行 Repository 未封装的操作
+func (r *Repository[T]) Dao() *Dao {
+	return r.dao
+}
+
+// Insert 插入文档, 自动写入审计字段(同 Dao.CreateDoc), 不会创建索引
+func (r *Repository[T]) Insert(ctx context.Context, docs ...T) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	ins, err := r.dao.prepareInserts(ctx, r.name, docs)
+	if err != nil {
+		return opError("Insert", r.name, err)
+	}
+	err = r.dao.withSessionCtx(ctx, func(session *mgo.Session) error {
+		return session.DB(r.dao.Name).C(r.name).Insert(ins...)
+	})
+	return opError("Insert", r.name, err)
+}
+
+// Get 按 _id 查找文档, 未找到(或已软删除, 见 Dao.WithDeleted)时返回 ErrNotFound
+func (r *Repository[T]) Get(ctx context.Context, id bson.ObjectId) (T, error) {
+	var doc T
+	err := r.dao.decodeCtx(ctx, &doc, func(session *mgo.Session, out interface{}) error {
+		return withMaxTime(ctx, session.DB(r.dao.Name).C(r.name).Find(r.dao.scope(r.name, id))).One(out)
+	})
+	return doc, opError("Get", r.name, err)
+}
+
+// Find 查找文档, 参数同 Dao.FindDoc; 未匹配到文档时返回空切片
+func (r *Repository[T]) Find(ctx context.Context, query interface{}, page Page, sortKeys ...string) ([]T, error) {
+	if query == nil {
+		return nil, opError("Find", r.name, errNull)
+	}
+	if err := noCount(query); err != nil {
+		return nil, opError("Find", r.name, err)
+	}
+	var docs []T
+	err := r.dao.decodeCtx(ctx, &docs, func(session *mgo.Session, out interface{}) error {
+		q := r.dao.findQuery(ctx, session, r.name, query, page, sortKeys...)
+		return allCtx(ctx, q.Iter(), out)
+	})
+	if err != nil {
+		return nil, opError("Find", r.name, err)
+	}
+	if docs == nil {
+		docs = []T{}
+	}
+	return docs, nil
+}
+
+// FindPage 分页查找文档, 返回的 Items 为 []T, 参数同 Dao.FindPage
+func (r *Repository[T]) FindPage(ctx context.Context, query interface{}, page Page, count CountMode, sortKeys ...string) (*PageResult, error) {
+	docs := []T{}
+	return r.dao.FindPageCtx(ctx, r.name, &docs, query, page, count, sortKeys...)
+}
+
+// FindOne 查找唯一的文档, 参数同 Dao.FindOneDoc
+// 未找到时返回 ErrNotFound, 匹配到多个文档时返回 ErrAmbiguousMatch
+func (r *Repository[T]) FindOne(ctx context.Context, query interface{}) (T, error) {
+	var doc T
+	err := r.dao.FindOneDocToResultCtx(ctx, r.name, &doc, query)
+	if err != nil {
+		var zero T
+		return zero, opError("FindOne", r.name, unwrapOp(err))
+	}
+	return doc, nil
+}
+
+// Update 更新匹配到的第一个文档, 返回更新后的文档
+// update 可以是操作符文档(如 {"$inc": {"age": 1}}), 也可以是字段文档或 T, 后两者按 $set 更新(忽略 _id、create_at)
+// 自动写入审计字段, 同 Dao.Update、Dao.UpsertDoc
+func (r *Repository[T]) Update(ctx context.Context, selector interface{}, update interface{}) (T, error) {
+	return r.apply(ctx, "Update", selector, update, false)
+}
+
+// Upsert 更新匹配到的第一个文档, 不存在时插入, 返回更新/插入后的文档; update 同 Update
+func (r *Repository[T]) Upsert(ctx context.Context, selector interface{}, update interface{}) (T, error) {
+	return r.apply(ctx, "Upsert", selector, update, true)
+}
+
+// apply 通过 findAndModify 更新文档并返回更新后的结果
+func (r *Repository[T]) apply(ctx context.Context, op string, selector interface{}, update interface{}, upsert bool) (T, error) {
+	var doc T
+	if selector == nil || update == nil {
+		return doc, opError(op, r.name, errNull)
+	}
+	if id, ok := selector.(bson.ObjectId); ok {
+		selector = bson.M{"_id": id}
+	}
+	change, err := r.dao.prepareUpdate(ctx, r.name, update, upsert)
+	if err != nil {
+		return doc, opError(op, r.name, err)
+	}
+
+	err = r.dao.decodeCtx(ctx, &doc, func(session *mgo.Session, out interface{}) error {
+		q := withMaxTime(ctx, session.DB(r.dao.Name).C(r.name).Find(selector))
+		_, err := q.Apply(mgo.Change{Update: change, Upsert: upsert, ReturnNew: true}, out)
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, opError(op, r.name, err)
+	}
+	return doc, nil
+}
+
+// UpdateIfVersion 只在文档的版本号为 version 时更新, 返回更新后的文档, 同 Dao.UpdateIfVersion
+// 版本号不一致时返回 ErrConflict(详见 ConflictError), 文档不存在时返回 ErrNotFound
+func (r *Repository[T]) UpdateIfVersion(ctx context.Context, id bson.ObjectId, version int, update interface{}) (T, error) {
+	var doc T
+	if id == "" || update == nil {
+		return doc, opError("UpdateIfVersion", r.name, errNull)
+	}
+	change, err := stampUpdate(ctx, update, false)
+	if err == nil {
+		err = versionUpdate(change)
+	}
+	if err != nil {
+		return doc, opError("UpdateIfVersion", r.name, err)
+	}
+
+	err = r.dao.decodeCtx(ctx, &doc, func(session *mgo.Session, out interface{}) error {
+		co := session.DB(r.dao.Name).C(r.name)
+		_, err := withMaxTime(ctx, co.Find(versionSelector(id, version))).Apply(mgo.Change{Update: change, ReturnNew: true}, out)
+		if err == mgo.ErrNotFound {
+			return conflict(ctx, co, id, version)
+		}
+		return err
+	})
+	if err != nil {
+		var zero T
+		return zero, opError("UpdateIfVersion", r.name, err)
+	}
+	return doc, nil
+}
+
+// SoftDelete 软删除匹配到的第一个文档, 同 Dao.RemoveDocByMark
+func (r *Repository[T]) SoftDelete(ctx context.Context, selector interface{}) error {
+	return opError("SoftDelete", r.name, unwrapOp(r.dao.RemoveDocByMarkCtx(ctx, r.name, selector)))
+}
+
+// Restore 恢复软删除的文档, 同 Dao.Restore
+func (r *Repository[T]) Restore(ctx context.Context, selector interface{}) error {
+	return opError("Restore", r.name, unwrapOp(r.dao.RestoreCtx(ctx, r.name, selector)))
+}
+
+// PurgeDeleted 物理删除软删除超过 olderThan 的文档, 同 Dao.PurgeDeleted
+func (r *Repository[T]) PurgeDeleted(ctx context.Context, olderThan time.Duration) (int, error) {
+	n, err := r.dao.PurgeDeletedCtx(ctx, r.name, olderThan)
+	return n, opError("PurgeDeleted", r.name, unwrapOp(err))
+}
+
+// Bulk 创建集合的批量写入, 同 Dao.Bulk
+func (r *Repository[T]) Bulk() *Bulk {
+	return r.dao.Bulk(r.name)
+}
+
+// Count 统计匹配到的文档数量, query 为 *Operator 时只使用其中的查询条件
+func (r *Repository[T]) Count(ctx context.Context, query interface{}) (int, error) {
+	if query == nil {
+		return 0, opError("Count", r.name, errNull)
+	}
+	var n int
+	err := r.dao.withSessionCtx(ctx, func(session *mgo.Session) error {
+		var err error
+		n, err = withMaxTime(ctx, session.DB(r.dao.Name).C(r.name).Find(r.dao.scope(r.name, query))).Count()
+		return err
+	})
+	if err != nil {
+		return 0, opError("Count", r.name, err)
+	}
+	return n, nil
+}
+
+// Iterate 逐个读取匹配到的文档并调用 fn, 不会将全部结果载入内存, fn 在调用方的 goroutine 中执行
+// fn 返回 ErrStopIteration 时提前结束并返回 nil, 返回其它错误时停止遍历并原样返回该错误; ctx 结束时返回 ctx.Err()
+func (r *Repository[T]) Iterate(ctx context.Context, query interface{}, page Page, fn func(doc T) error, sortKeys ...string) error {
+	cur, err := r.dao.FindCursor(ctx, r.name, query, page, CursorOptions{}, sortKeys...)
+	if err != nil {
+		return opError("Iterate", r.name, unwrapOp(err))
+	}
+	var fnErr error
+	err = cur.Each(func(c *Cursor) error {
+		var doc T
+		if err := c.Decode(&doc); err != nil {
+			return err
+		}
+		fnErr = fn(doc)
+		return fnErr
+	})
+	if err != nil && err == fnErr {
+		return err
+	}
+	return opError("Iterate", r.name, unwrapOp(err))
+}
+
+// updateDocument 生成更新内容
+// 所有键均为操作符($开头)时原样使用; 均不是操作符时按 $set 更新并忽略 _id、create_at; 二者混用或操作符未知时返回错误
+// 结构体按 bson 标签转换为字段文档; *UpdateBuilder 使用 Build 的结果, 但不支持 arrayFilters(只有 Dao.Update 等方法支持)
+func updateDocument(update interface{}) (interface{}, error) {
+	var fields bson.M
+	switch u := update.(type) {
+	case *UpdateBuilder:
+		if len(u.ArrayFilters()) > 0 {
+			return nil, fmt.Errorf("%w: array filters are only supported by Update, UpdateId and UpdateMany", ErrInvalidSelector)
+		}
+		doc, err := u.Build()
+		if err != nil {
+			return nil, err
+		}
+		return doc, nil
+	case bson.M:
+		fields = u
+	case map[string]interface{}:
+		fields = u
+	case bson.D:
+		fields = u.Map()
+	default:
+		v := reflect.ValueOf(update)
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("%w: unsupported update type %T", ErrInvalidSelector, update)
+		}
+		data, err := bson.Marshal(update)
+		if err != nil {
+			return nil, err
+		}
+		if err := bson.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: empty update document", ErrInvalidSelector)
+	}
+
+	var ops, plain []string
+	for k := range fields {
+		if strings.HasPrefix(k, "$") {
+			ops = append(ops, k)
+		} else {
+			plain = append(plain, k)
+		}
+	}
+	if len(ops) > 0 && len(plain) > 0 {
+		sort.Strings(ops)
+		sort.Strings(plain)
+		return nil, fmt.Errorf("%w: update mixes operators %v with fields %v", ErrInvalidSelector, ops, plain)
+	}
+	if len(ops) > 0 {
+		sort.Strings(ops)
+		for _, op := range ops {
+			if !updateOperators[op] {
+				return nil, fmt.Errorf("%w: unknown update operator %s", ErrInvalidSelector, op)
+			}
+		}
+		return fields, nil
+	}
+
+	set := make(bson.M, len(fields))
+	for k, v := range fields {
+		if k != "_id" && k != "create_at" {
+			set[k] = v
+		}
+	}
+	return bson.M{"$set": set}, nil
+}
+
+// unwrapOp 取出 *Error 包装的原始错误, 用于以新的操作名称重新包装
+func unwrapOp(err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Err
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+/*
+ * 说明：泛型数据访问对象单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:12
+ * 更新：
+ */
+
+package dao
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+	"mongodb.golang.com/src/model"
+)
+
+type person struct {
+	_    struct{}      `collection:"people"`
+	Id   bson.ObjectId `bson:"_id,omitempty"`
+	Name string        `bson:"name"`
+}
+
+type category struct {
+	Name string `bson:"name"`
+}
+
+func TestCollectionName(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "model.User", got: CollectionName[model.User](), want: "users"},
+		{name: "pointer", got: CollectionName[*model.Comment](), want: "comments"},
+		{name: "irregular plural", got: CollectionName[category](), want: "categories"},
+		{name: "tag override", got: CollectionName[person](), want: "people"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("CollectionName() = %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateDocument(t *testing.T) {
+	id := bson.NewObjectId()
+	tests := []struct {
+		name    string
+		update  interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "operators", update: bson.M{"$inc": bson.M{"age": 1}, "$push": bson.M{"friends": "You"}},
+			want: bson.M{"$inc": bson.M{"age": 1}, "$push": bson.M{"friends": "You"}}},
+		{name: "fields", update: bson.M{"_id": id, "name": "zhe", "create_at": "x"},
+			want: bson.M{"$set": bson.M{"name": "zhe"}}},
+		{name: "struct", update: &person{Id: id, Name: "zhe"},
+			want: bson.M{"$set": bson.M{"name": "zhe"}}},
+		{name: "bson.D", update: bson.D{{Name: "name", Value: "zhe"}},
+			want: bson.M{"$set": bson.M{"name": "zhe"}}},
+		{name: "mixed", update: bson.M{"$inc": bson.M{"age": 1}, "name": "zhe"}, wantErr: true},
+		{name: "unknown operator", update: bson.M{"$sett": bson.M{"name": "zhe"}}, wantErr: true},
+		{name: "empty", update: bson.M{}, wantErr: true},
+		{name: "unsupported", update: []string{"name"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := updateDocument(tt.update)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("updateDocument() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSelector) {
+				t.Errorf("updateDocument() error = %v, want ErrInvalidSelector", err)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("updateDocument() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ * 说明：会话(Session)一致性模式、写关注(write concern)及连接池设置
+ * 作者：agent
+ * 时间：2026-10-18 08:04
+ * 更新：支持全局配置, 并可按 Dao 及单次调用覆盖
+ */
+
+package dao
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// modes 一致性模式名称与mgo.Mode的对应关系(不区分大小写)
+// 除 readPreference 的标准取值外, 还支持mgo特有的 strong, monotonic, eventual
+var modes = map[string]mgo.Mode{
+	"strong":             mgo.Strong,
+	"monotonic":          mgo.Monotonic,
+	"eventual":           mgo.Eventual,
+	"primary":            mgo.Primary,
+	"primarypreferred":   mgo.PrimaryPreferred,
+	"secondary":          mgo.Secondary,
+	"secondarypreferred": mgo.SecondaryPreferred,
+	"nearest":            mgo.Nearest,
+}
+
+// ParseMode 解析一致性模式名称, 如 strong, monotonic, eventual, secondaryPreferred
+func ParseMode(name string) (mgo.Mode, error) {
+	mode, ok := modes[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown consistency mode %q", name)
+	}
+	return mode, nil
+}
+
+// WriteConcern 写关注配置, 对应 mgo.Safe
+type WriteConcern struct {
+	W        string        `yaml:"w"`        // 需要确认写入的节点数或模式: 数字, majority 或 tag set 名称; 0 表示不确认写入
+	J        bool          `yaml:"j"`        // 是否等待写入journal
+	FSync    bool          `yaml:"fsync"`    // 是否等待数据同步到磁盘
+	WTimeout time.Duration `yaml:"wtimeout"` // 等待写确认的超时时间
+}
+
+// IsZero 是否未设置任何写关注选项(即使用mgo默认值：由主节点确认写入)
+func (w WriteConcern) IsZero() bool {
+	return w == WriteConcern{}
+}
+
+// Safe 转换为 mgo.Safe; W 为 "0" 时返回 nil, 即不确认写入(fire-and-forget)
+func (w WriteConcern) Safe() (*mgo.Safe, error) {
+	safe := &mgo.Safe{
+		J:        w.J,
+		FSync:    w.FSync,
+		WTimeout: int(w.WTimeout / time.Millisecond),
+	}
+	if w.W != "" {
+		if n, err := strconv.Atoi(w.W); err == nil {
+			if n < 0 {
+				return nil, fmt.Errorf("invalid write concern w=%d", n)
+			}
+			if n == 0 {
+				if w.J || w.FSync {
+					return nil, fmt.Errorf("write concern w=0 conflicts with j/fsync")
+				}
+				return nil, nil
+			}
+			safe.W = n
+		} else {
+			safe.WMode = w.W
+		}
+	}
+	return safe, nil
+}
+
+// commandWriteConcern 将 mgo.Safe 转换为命令的 writeConcern, 与 mgo 的写入操作一致; safe 为 nil 时为 {w: 0}
+// mgo 的 Database.Run 不会附加 writeConcern, 直接执行 update、commitTransaction 等命令时使用
+func commandWriteConcern(safe *mgo.Safe) bson.D {
+	if safe == nil {
+		return bson.D{{Name: "w", Value: 0}}
+	}
+	wc := bson.D{}
+	switch {
+	case safe.WMode != "":
+		wc = append(wc, bson.DocElem{Name: "w", Value: safe.WMode})
+	case safe.W > 0:
+		wc = append(wc, bson.DocElem{Name: "w", Value: safe.W})
+	}
+	if safe.WTimeout > 0 {
+		wc = append(wc, bson.DocElem{Name: "wtimeout", Value: safe.WTimeout})
+	}
+	if safe.FSync {
+		wc = append(wc, bson.DocElem{Name: "fsync", Value: true})
+	}
+	if safe.J {
+		wc = append(wc, bson.DocElem{Name: "j", Value: true})
+	}
+	return wc
+}
+
+// sessionOptions 会话选项, 未设置的选项沿用源Session的设置
+type sessionOptions struct {
+	mode          *mgo.Mode
+	safe          *mgo.Safe
+	safeSet       bool // safe 为 nil 时表示不确认写入, 因此需要单独记录是否设置
+	socketTimeout time.Duration
+	poolLimit     int
+}
+
+// apply 将选项应用到 session
+func (o *sessionOptions) apply(session *mgo.Session) {
+	if o.mode != nil {
+		session.SetMode(*o.mode, true)
+	}
+	if o.safeSet {
+		session.SetSafe(o.safe)
+	}
+	if o.socketTimeout > 0 {
+		session.SetSocketTimeout(o.socketTimeout)
+	}
+	if o.poolLimit > 0 {
+		session.SetPoolLimit(o.poolLimit)
+	}
+}
+
+// clone 复制 Dao, 用于按 Dao 或单次调用覆盖会话选项, 不影响原 Dao
+func (d *Dao) clone() *Dao {
+	c := *d
+	return &c
+}
+
+// WithMode 返回使用指定一致性模式的 Dao, 如结算流程使用 mgo.Strong, 报表使用 mgo.Eventual
+//
+//	d.WithMode(mgo.Strong).FindOneDoc("orders", bson.M{"_id": id})
+func (d *Dao) WithMode(mode mgo.Mode) *Dao {
+	c := d.clone()
+	c.opts.mode = &mode
+	return c
+}
+
+// WithSafe 返回使用指定写关注的 Dao; safe 为 nil 时不确认写入
+//
+//	d.WithSafe(&mgo.Safe{WMode: "majority", J: true}).CreateDoc("audits", doc)
+func (d *Dao) WithSafe(safe *mgo.Safe) *Dao {
+	c := d.clone()
+	if safe != nil {
+		s := *safe
+		safe = &s
+	}
+	c.opts.safe, c.opts.safeSet = safe, true
+	return c
+}
+
+// WithWriteConcern 同 WithSafe, 使用 WriteConcern 描述写关注
+func (d *Dao) WithWriteConcern(w WriteConcern) (*Dao, error) {
+	safe, err := w.Safe()
+	if err != nil {
+		return nil, err
+	}
+	return d.WithSafe(safe), nil
+}
+
+// WithSocketTimeout 返回使用指定socket超时时间的 Dao
+func (d *Dao) WithSocketTimeout(timeout time.Duration) *Dao {
+	c := d.clone()
+	c.opts.socketTimeout = timeout
+	return c
+}
+
+// WithPoolLimit 返回限制每个服务器最大连接数的 Dao
+func (d *Dao) WithPoolLimit(limit int) *Dao {
+	c := d.clone()
+	c.opts.poolLimit = limit
+	return c
+}
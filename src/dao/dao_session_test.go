@@ -0,0 +1,119 @@
+/*
+ * 说明：会话选项单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:04
+ * 更新：
+ */
+
+package dao
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    mgo.Mode
+		wantErr bool
+	}{
+		{name: "strong", want: mgo.Strong},
+		{name: "Monotonic", want: mgo.Monotonic},
+		{name: "eventual", want: mgo.Eventual},
+		{name: "secondaryPreferred", want: mgo.SecondaryPreferred},
+		{name: "linearizable", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMode(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseMode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteConcern_Safe(t *testing.T) {
+	tests := []struct {
+		name    string
+		wc      WriteConcern
+		want    *mgo.Safe
+		wantErr bool
+	}{
+		{name: "default", wc: WriteConcern{}, want: &mgo.Safe{}},
+		{name: "majority journaled", wc: WriteConcern{W: "majority", J: true, WTimeout: 5 * time.Second},
+			want: &mgo.Safe{WMode: "majority", J: true, WTimeout: 5000}},
+		{name: "numeric", wc: WriteConcern{W: "2"}, want: &mgo.Safe{W: 2}},
+		{name: "unacknowledged", wc: WriteConcern{W: "0"}, want: nil},
+		{name: "unacknowledged journaled", wc: WriteConcern{W: "0", J: true}, wantErr: true},
+		{name: "negative", wc: WriteConcern{W: "-1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.wc.Safe()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Safe() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Safe() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommandWriteConcern(t *testing.T) {
+	tests := []struct {
+		name string
+		safe *mgo.Safe
+		want bson.D
+	}{
+		{"unacknowledged", nil, bson.D{{Name: "w", Value: 0}}},
+		{"default", &mgo.Safe{}, bson.D{}},
+		{"majority journaled", &mgo.Safe{WMode: "majority", J: true, WTimeout: 5000},
+			bson.D{{Name: "w", Value: "majority"}, {Name: "wtimeout", Value: 5000}, {Name: "j", Value: true}}},
+		{"numeric fsync", &mgo.Safe{W: 2, FSync: true}, bson.D{{Name: "w", Value: 2}, {Name: "fsync", Value: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commandWriteConcern(tt.safe); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commandWriteConcern() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDao_With(t *testing.T) {
+	d := &Dao{Name: "mongo"}
+
+	strong := d.WithMode(mgo.Strong)
+	audit := strong.WithSafe(&mgo.Safe{WMode: "majority", J: true}).WithSocketTimeout(time.Second)
+	fast := d.WithSafe(nil).WithPoolLimit(8)
+
+	if d.opts != (sessionOptions{}) {
+		t.Errorf("With*() modified the source Dao: %+v", d.opts)
+	}
+	if strong.opts.mode == nil || *strong.opts.mode != mgo.Strong || strong.opts.safeSet {
+		t.Errorf("WithMode() opts = %+v", strong.opts)
+	}
+	if *audit.opts.mode != mgo.Strong || !audit.opts.safeSet || audit.opts.safe.WMode != "majority" ||
+		audit.opts.socketTimeout != time.Second {
+		t.Errorf("chained With*() opts = %+v", audit.opts)
+	}
+	if !fast.opts.safeSet || fast.opts.safe != nil || fast.opts.poolLimit != 8 || fast.opts.mode != nil {
+		t.Errorf("WithSafe(nil).WithPoolLimit() opts = %+v", fast.opts)
+	}
+
+	if _, err := d.WithWriteConcern(WriteConcern{W: "0", FSync: true}); err == nil {
+		t.Error("WithWriteConcern() error = nil, want error")
+	}
+}
@@ -0,0 +1,280 @@
+/*
+ * 说明：软删除策略
+ * 作者：agent
+ * 时间：2026-10-18 08:40
+ * 更新：按集合启用软删除, 读取时默认排除已删除的文档; 支持恢复、级联删除内嵌文档及超过保留期后物理删除
+ */
+
+package dao
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DeletedMode 读取启用了软删除的集合时如何处理已删除(is_delete 为 true)的文档
+type DeletedMode int
+
+const (
+	ExcludeDeleted DeletedMode = iota // 排除已删除的文档(默认)
+	IncludeDeleted                    // 包括已删除的文档
+	OnlyDeleted                       // 只读取已删除的文档, 如回收站
+)
+
+// String 实现 fmt.Stringer
+func (m DeletedMode) String() string {
+	switch m {
+	case ExcludeDeleted:
+		return "exclude"
+	case IncludeDeleted:
+		return "include"
+	case OnlyDeleted:
+		return "only"
+	}
+	return fmt.Sprintf("DeletedMode(%d)", int(m))
+}
+
+// SoftDeletePolicy 集合的软删除策略, 由 Dao.SetSoftDelete 设置
+type SoftDeletePolicy struct {
+	// Cascade 内嵌文档数组字段, 如 comments; 软删除、恢复、物理删除文档时同时处理其中的元素
+	Cascade []string
+}
+
+// collectionPolicies 按集合启用的策略(软删除、乐观锁), 由 Dao 及其副本(见 WithMode 等)共享
+type collectionPolicies struct {
+	mu         sync.RWMutex
+	softDelete map[string]SoftDeletePolicy
+	versioned  map[string]bool
+}
+
+// collectionPolicies 返回 Dao 的集合策略, 未设置过时创建
+func (d *Dao) collectionPolicies() *collectionPolicies {
+	if d.policies == nil {
+		d.policies = &collectionPolicies{}
+	}
+	return d.policies
+}
+
+// SetSoftDelete 为集合 name 启用软删除, policy 为 nil 时停用; 应在启动时调用
+// 启用后, Find*、FindPage、FindCursor、Query 及 Repository 的读取方法默认排除已删除的文档(见 WithDeleted),
+// 聚合管道(PipeDoc 等)不受影响; 查询条件中已指定 is_delete 时以查询条件为准
+func (d *Dao) SetSoftDelete(name string, policy *SoftDeletePolicy) {
+	p := d.collectionPolicies()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if policy == nil {
+		delete(p.softDelete, name)
+		return
+	}
+	if p.softDelete == nil {
+		p.softDelete = make(map[string]SoftDeletePolicy)
+	}
+	p.softDelete[name] = SoftDeletePolicy{Cascade: append([]string(nil), policy.Cascade...)}
+}
+
+// SoftDeletePolicy 返回集合 name 的软删除策略, 未启用时 ok 为 false
+func (d *Dao) SoftDeletePolicy(name string) (policy SoftDeletePolicy, ok bool) {
+	if d.policies == nil {
+		return SoftDeletePolicy{}, false
+	}
+	d.policies.mu.RLock()
+	defer d.policies.mu.RUnlock()
+	policy, ok = d.policies.softDelete[name]
+	return policy, ok
+}
+
+// WithDeleted 返回按 mode 处理已删除文档的 Dao, 只影响启用了软删除的集合
+//
+//	d.WithDeleted(dao.OnlyDeleted).FindDoc("users", bson.M{}, page)
+func (d *Dao) WithDeleted(mode DeletedMode) *Dao {
+	c := d.clone()
+	c.deleted = mode
+	return c
+}
+
+// scope 按软删除策略及 WithDeleted 为查询条件加入 is_delete 条件
+// query 为 bson.M 时直接加入(已指定 is_delete 时不变), *Operator 时加入其中的 Filter, bson.ObjectId 时转换为 {_id: id}, 其它类型以 $and 组合
+func (d *Dao) scope(name string, query interface{}) interface{} {
+	if _, ok := d.SoftDeletePolicy(name); !ok {
+		return query
+	}
+	return scopeDeleted(query, d.deleted)
+}
+
+func scopeDeleted(query interface{}, mode DeletedMode) interface{} {
+	var cond interface{}
+	switch mode {
+	case IncludeDeleted:
+		return query
+	case OnlyDeleted:
+		cond = true
+	default:
+		// 未写入 is_delete 的旧文档视为未删除
+		cond = bson.M{"$ne": true}
+	}
+
+	switch q := query.(type) {
+	case nil:
+		return nil
+	case *Operator:
+		c := *q
+		c.Filter = withField(q.Filter, cond)
+		return &c
+	case bson.ObjectId:
+		return bson.M{"_id": q, FieldIsDelete: cond}
+	case bson.M:
+		return withField(q, cond)
+	case map[string]interface{}:
+		return withField(q, cond)
+	}
+	return bson.M{"$and": []interface{}{query, bson.M{FieldIsDelete: cond}}}
+}
+
+// withField 返回加入 is_delete 条件的副本, m 已指定 is_delete 时原样返回
+func withField(m map[string]interface{}, cond interface{}) bson.M {
+	if _, ok := m[FieldIsDelete]; ok {
+		return bson.M(m)
+	}
+	out := copyM(m)
+	out[FieldIsDelete] = cond
+	return out
+}
+
+// softRemove 按 update(已写入审计字段)软删除 selector 匹配到的第一个未删除的文档, 并级联软删除 Cascade 字段中未删除的元素
+// now 为 update 中的删除时间; 文档本身及各个内嵌数组分别更新, 不是原子操作
+func softRemove(ctx context.Context, co *mgo.Collection, selector, update bson.M, now time.Time, policy SoftDeletePolicy) error {
+	var doc struct {
+		Id interface{} `bson:"_id"`
+	}
+	if err := withMaxTime(ctx, co.Find(scopeDeleted(selector, ExcludeDeleted)).Select(bson.M{"_id": 1})).One(&doc); err != nil {
+		return err
+	}
+	if err := co.Update(bson.M{"_id": doc.Id, FieldIsDelete: bson.M{"$ne": true}}, update); err != nil {
+		return err
+	}
+	for _, field := range policy.Cascade {
+		set := bson.M{field + ".$[e]." + FieldIsDelete: true, field + ".$[e]." + FieldDeleteAt: now}
+		filter := bson.M{"e." + FieldIsDelete: bson.M{"$ne": true}}
+		if err := updateArray(co, doc.Id, field, set, filter); err != nil {
+			return fmt.Errorf("cascade %s: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// Restore 恢复软删除的文档, 同时恢复随其一起被级联删除(delete_at 相同)的内嵌文档
+// name 集合名；selector 选择条件(bson.ObjectId or bson.M), 只匹配已删除的文档, 未找到时返回 ErrNotFound
+func (d *Dao) Restore(name string, selector interface{}) error {
+	return d.RestoreCtx(context.Background(), name, selector)
+}
+
+// RestoreCtx 同 Restore, ctx 结束时中止操作; ctx 中有操作人(见 WithActor)时写入 modified_by
+func (d *Dao) RestoreCtx(ctx context.Context, name string, selector interface{}) error {
+	sel, err := idSelector(selector)
+	if err != nil {
+		return opError("Restore", name, err)
+	}
+	update, err := d.prepareUpdate(ctx, name, bson.M{"$set": bson.M{FieldDeleteAt: nil, FieldIsDelete: false}}, false)
+	if err != nil {
+		return opError("Restore", name, err)
+	}
+	policy, _ := d.SoftDeletePolicy(name)
+
+	err = d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		co := session.DB(d.Name).C(name)
+
+		var doc struct {
+			Id       interface{} `bson:"_id"`
+			DeleteAt interface{} `bson:"delete_at"`
+		}
+		q := co.Find(scopeDeleted(sel, OnlyDeleted)).Select(bson.M{"_id": 1, FieldDeleteAt: 1})
+		if err := withMaxTime(ctx, q).One(&doc); err != nil {
+			return err
+		}
+		if err := co.Update(bson.M{"_id": doc.Id, FieldIsDelete: true}, update); err != nil {
+			return err
+		}
+		for _, field := range policy.Cascade {
+			set := bson.M{field + ".$[e]." + FieldIsDelete: false, field + ".$[e]." + FieldDeleteAt: nil}
+			filter := bson.M{"e." + FieldIsDelete: true, "e." + FieldDeleteAt: doc.DeleteAt}
+			if err := updateArray(co, doc.Id, field, set, filter); err != nil {
+				return fmt.Errorf("cascade %s: %w", field, err)
+			}
+		}
+		return nil
+	})
+	return opError("Restore", name, err)
+}
+
+// PurgeDeleted 物理删除软删除时间早于 olderThan 之前的文档, 返回删除的文档数量
+// 同时从 Cascade 字段中移除超过保留期的已删除元素; 可定期执行, 如 d.PurgeDeleted("users", 30*24*time.Hour)
+func (d *Dao) PurgeDeleted(name string, olderThan time.Duration) (int, error) {
+	return d.PurgeDeletedCtx(context.Background(), name, olderThan)
+}
+
+// PurgeDeletedCtx 同 PurgeDeleted, ctx 结束时中止操作
+func (d *Dao) PurgeDeletedCtx(ctx context.Context, name string, olderThan time.Duration) (int, error) {
+	if olderThan < 0 {
+		return 0, opError("PurgeDeleted", name, fmt.Errorf("negative retention %v", olderThan))
+	}
+	expired := purgeFilter(Now().Add(-olderThan))
+	policy, _ := d.SoftDeletePolicy(name)
+	pull := func(field string) bson.M {
+		u := bson.M{"$pull": bson.M{field: expired}}
+		if d.Versioned(name) {
+			u["$inc"] = bson.M{FieldVersion: 1}
+		}
+		return u
+	}
+
+	var removed int
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		co := session.DB(d.Name).C(name)
+
+		info, err := co.RemoveAll(expired)
+		if err != nil {
+			return err
+		}
+		removed = info.Removed
+		for _, field := range policy.Cascade {
+			_, err := co.UpdateAll(bson.M{field: bson.M{"$elemMatch": expired}}, pull(field))
+			if err != nil {
+				return fmt.Errorf("cascade %s: %w", field, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, opError("PurgeDeleted", name, err)
+	}
+	return removed, nil
+}
+
+// purgeFilter 匹配删除时间早于 cutoff 的已删除文档
+func purgeFilter(cutoff time.Time) bson.M {
+	return bson.M{FieldIsDelete: true, FieldDeleteAt: bson.M{"$lt": cutoff}}
+}
+
+// idSelector 将 bson.ObjectId 或 bson.M 类型的选择条件统一为 bson.M
+func idSelector(selector interface{}) (bson.M, error) {
+	switch s := selector.(type) {
+	case nil:
+		return nil, errNull
+	case bson.M:
+		return s, nil
+	case bson.ObjectId:
+		return bson.M{"_id": s}, nil
+	}
+	return nil, errUnSupportType
+}
+
+// updateArray 按 arrayFilters(标识符为 e)更新文档 id 的数组字段 field 中的元素, field 不是数组时跳过
+func updateArray(co *mgo.Collection, id interface{}, field string, set, filter bson.M) error {
+	_, err := updateCommand(co, bson.M{"_id": id, field: bson.M{"$type": "array"}}, bson.M{"$set": set}, false, []bson.M{filter})
+	return err
+}
@@ -0,0 +1,117 @@
+/*
+ * 说明：软删除策略单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:40
+ * 更新：
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestScopeDeleted(t *testing.T) {
+	id := bson.NewObjectId()
+	notDeleted := bson.M{"$ne": true}
+	limit := 10
+	tests := []struct {
+		name  string
+		query interface{}
+		mode  DeletedMode
+		want  interface{}
+	}{
+		{"exclude", bson.M{"age": 18}, ExcludeDeleted, bson.M{"age": 18, "is_delete": notDeleted}},
+		{"only", bson.M{"age": 18}, OnlyDeleted, bson.M{"age": 18, "is_delete": true}},
+		{"include", bson.M{"age": 18}, IncludeDeleted, bson.M{"age": 18}},
+		{"explicit is_delete", bson.M{"is_delete": true}, ExcludeDeleted, bson.M{"is_delete": true}},
+		{"object id", id, ExcludeDeleted, bson.M{"_id": id, "is_delete": notDeleted}},
+		{"bson.D", bson.D{{Name: "age", Value: 18}}, OnlyDeleted,
+			bson.M{"$and": []interface{}{bson.D{{Name: "age", Value: 18}}, bson.M{"is_delete": true}}}},
+		{"operator", &Operator{Filter: bson.M{"age": 18}, Limit: &limit}, ExcludeDeleted,
+			&Operator{Filter: bson.M{"age": 18, "is_delete": notDeleted}, Limit: &limit}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scopeDeleted(tt.query, tt.mode); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("scopeDeleted() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	// 不修改调用方的查询条件
+	query := bson.M{"age": 18}
+	scopeDeleted(query, ExcludeDeleted)
+	if len(query) != 1 {
+		t.Errorf("query modified: %v", query)
+	}
+}
+
+func TestSoftDeletePolicy(t *testing.T) {
+	d := &Dao{}
+	query := bson.M{"age": 18}
+	if got := d.scope("users", query); !reflect.DeepEqual(got, query) {
+		t.Errorf("scope() without policy = %v", got)
+	}
+
+	cascade := []string{"comments"}
+	d.SetSoftDelete("users", &SoftDeletePolicy{Cascade: cascade})
+	cascade[0] = "changed"
+	if p, ok := d.SoftDeletePolicy("users"); !ok || !reflect.DeepEqual(p.Cascade, []string{"comments"}) {
+		t.Errorf("SoftDeletePolicy() = %v, %v", p, ok)
+	}
+	if _, ok := d.SoftDeletePolicy("books"); ok {
+		t.Error("SoftDeletePolicy(books) enabled")
+	}
+
+	// 副本共享策略, 读取方式互不影响
+	all := d.WithDeleted(IncludeDeleted)
+	if got := all.scope("users", query); !reflect.DeepEqual(got, query) {
+		t.Errorf("WithDeleted(IncludeDeleted).scope() = %v", got)
+	}
+	if got := d.scope("users", query); !reflect.DeepEqual(got, bson.M{"age": 18, "is_delete": bson.M{"$ne": true}}) {
+		t.Errorf("scope() = %v", got)
+	}
+
+	d.SetSoftDelete("users", nil)
+	if _, ok := all.SoftDeletePolicy("users"); ok {
+		t.Error("SetSoftDelete(nil) not visible to clone")
+	}
+}
+
+func TestIdSelector(t *testing.T) {
+	id := bson.NewObjectId()
+	if got, err := idSelector(id); err != nil || !reflect.DeepEqual(got, bson.M{"_id": id}) {
+		t.Errorf("idSelector(id) = %v, %v", got, err)
+	}
+	if _, err := idSelector(nil); err != errNull {
+		t.Errorf("idSelector(nil) error = %v, want errNull", err)
+	}
+	if _, err := idSelector("id"); err != errUnSupportType {
+		t.Errorf("idSelector(string) error = %v, want errUnSupportType", err)
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	cutoff := time.Date(2018, 1, 17, 0, 0, 0, 0, time.UTC)
+	want := bson.M{"is_delete": true, "delete_at": bson.M{"$lt": cutoff}}
+	if got := purgeFilter(cutoff); !reflect.DeepEqual(got, want) {
+		t.Errorf("purgeFilter() = %v, want %v", got, want)
+	}
+
+	d := &Dao{}
+	if _, err := d.PurgeDeletedCtx(context.Background(), "users", -time.Hour); err == nil {
+		t.Error("PurgeDeletedCtx(negative) error = nil")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := d.PurgeDeletedCtx(ctx, "users", time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("PurgeDeletedCtx(canceled) error = %v, want context.Canceled", err)
+	}
+}
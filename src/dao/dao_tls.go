@@ -0,0 +1,136 @@
+/*
+ * 说明：TLS连接及x.509客户端证书认证
+ * 作者：agent
+ * 时间：2026-10-18 08:03
+ * 更新：
+ */
+
+package dao
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// 认证机制, 对应 mgo.DialInfo.Mechanism
+const (
+	AuthSCRAMSHA1 = "SCRAM-SHA-1"  // 用户名密码认证(MongoDB 3.0+默认)
+	AuthMongoCR   = "MONGODB-CR"   // 用户名密码认证(MongoDB 3.0之前)
+	AuthX509      = "MONGODB-X509" // x.509客户端证书认证, 需要启用TLS并配置客户端证书
+)
+
+// x509AuthSource x.509认证用户所在的虚拟数据库
+const x509AuthSource = "$external"
+
+// TLSConfig TLS连接配置
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`              // 是否启用TLS
+	CAFile             string `yaml:"ca_file"`              // 用于校验服务器证书的CA证书(PEM), 为空时使用系统根证书
+	CertFile           string `yaml:"cert_file"`            // 客户端证书(PEM), x.509认证时必须配置
+	KeyFile            string `yaml:"key_file"`             // 客户端私钥(PEM), 为空时从 CertFile 中读取
+	ServerName         string `yaml:"server_name"`          // 校验服务器证书时使用的主机名, 为空时使用连接地址中的主机名
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"` // 跳过服务器证书校验, 仅用于本地测试
+}
+
+// normalizeAuthMechanism 统一认证机制名称, 允许简写 X509
+func normalizeAuthMechanism(mechanism string) string {
+	switch strings.ToUpper(mechanism) {
+	case "X509", AuthX509:
+		return AuthX509
+	case AuthSCRAMSHA1, AuthMongoCR:
+		return strings.ToUpper(mechanism)
+	}
+	return mechanism
+}
+
+// tlsConfig 根据配置生成 tls.Config
+func (t *TLSConfig) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: read ca file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("tls: no certificate found in ca file %s", t.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if t.CertFile != "" {
+		keyFile := t.KeyFile
+		if keyFile == "" {
+			keyFile = t.CertFile
+		}
+		cert, err := tls.LoadX509KeyPair(t.CertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// clientSubject 返回客户端证书的 Subject(RFC 2253格式), 作为x.509认证的用户名
+func clientSubject(cfg *tls.Config) (string, error) {
+	if len(cfg.Certificates) == 0 || len(cfg.Certificates[0].Certificate) == 0 {
+		return "", fmt.Errorf("tls: x.509 authentication requires a client certificate")
+	}
+	cert, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	if err != nil {
+		return "", fmt.Errorf("tls: parse client certificate: %v", err)
+	}
+	return cert.Subject.String(), nil
+}
+
+// dialServerTLS 返回 mgo.DialInfo.DialServer, 使用TLS连接各个服务器
+func dialServerTLS(cfg *tls.Config, timeout time.Duration) func(addr *mgo.ServerAddr) (net.Conn, error) {
+	return func(addr *mgo.ServerAddr) (net.Conn, error) {
+		c := cfg.Clone()
+		if c.ServerName == "" {
+			host, _, err := net.SplitHostPort(addr.String())
+			if err != nil {
+				host = addr.String()
+			}
+			c.ServerName = host
+		}
+		dialer := &net.Dialer{Timeout: timeout}
+		return tls.DialWithDialer(dialer, "tcp", addr.String(), c)
+	}
+}
+
+// setupTLS 在 info 中启用TLS及x.509认证
+func (m *MongoDB) setupTLS(info *mgo.DialInfo) error {
+	if !m.TLS.Enabled {
+		return nil
+	}
+	cfg, err := m.TLS.tlsConfig()
+	if err != nil {
+		return err
+	}
+	info.DialServer = dialServerTLS(cfg, info.Timeout)
+
+	if m.EnableAuth && normalizeAuthMechanism(m.AuthMechanism) == AuthX509 {
+		info.Mechanism = AuthX509
+		info.Source = x509AuthSource
+		info.Password = ""
+		if m.Username == "" {
+			if info.Username, err = clientSubject(cfg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
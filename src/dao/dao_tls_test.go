@@ -0,0 +1,195 @@
+/*
+ * 说明：TLS连接及x.509认证单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:03
+ * 更新：
+ */
+
+package dao
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert 生成自签名证书, 返回证书和私钥合并后的PEM文件路径
+func writeTestCert(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "app", OrganizationalUnit: []string{"dev"}, Organization: []string{"mongo"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "dao_tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})...)
+	path := filepath.Join(dir, "client.pem")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestMongoDB_DialInfoTLS(t *testing.T) {
+	pem := writeTestCert(t)
+
+	tests := []struct {
+		name          string
+		cfg           MongoDB
+		wantDialer    bool
+		wantMechanism string
+		wantUsername  string
+		wantSource    string
+		wantErr       bool
+	}{
+		{
+			name: "plain",
+			cfg:  MongoDB{Name: "app", Adds: addrs{"db1:27017"}},
+		},
+		{
+			name:       "tls with ca",
+			cfg:        MongoDB{Name: "app", Adds: addrs{"db1:27017"}, TLS: TLSConfig{Enabled: true, CAFile: pem}},
+			wantDialer: true,
+		},
+		{
+			name: "scram over tls",
+			cfg: MongoDB{Name: "app", Adds: addrs{"db1:27017"}, EnableAuth: true, Username: "u", Password: "p",
+				AuthMechanism: "scram-sha-1", TLS: TLSConfig{Enabled: true, InsecureSkipVerify: true}},
+			wantDialer:    true,
+			wantMechanism: AuthSCRAMSHA1,
+			wantUsername:  "u",
+		},
+		{
+			name: "x509 derives username",
+			cfg: MongoDB{Name: "app", Adds: addrs{"db1:27017"}, EnableAuth: true,
+				AuthMechanism: "X509", TLS: TLSConfig{Enabled: true, CertFile: pem}},
+			wantDialer:    true,
+			wantMechanism: AuthX509,
+			wantUsername:  "CN=app,OU=dev,O=mongo",
+			wantSource:    "$external",
+		},
+		{
+			name:    "missing ca file",
+			cfg:     MongoDB{Name: "app", Adds: addrs{"db1:27017"}, TLS: TLSConfig{Enabled: true, CAFile: pem + ".missing"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := tt.cfg.DialInfo()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DialInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if (info.DialServer != nil) != tt.wantDialer {
+				t.Errorf("DialInfo().DialServer set = %v, want %v", info.DialServer != nil, tt.wantDialer)
+			}
+			if info.Mechanism != tt.wantMechanism || info.Username != tt.wantUsername || info.Source != tt.wantSource {
+				t.Errorf("DialInfo() mechanism/username/source = %q/%q/%q, want %q/%q/%q",
+					info.Mechanism, info.Username, info.Source, tt.wantMechanism, tt.wantUsername, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestMongoDB_ValidateTLS(t *testing.T) {
+	cfg := &MongoDB{
+		Name:          "app",
+		Adds:          addrs{"db1:27017"},
+		EnableAuth:    true,
+		AuthMechanism: AuthX509,
+		TLS:           TLSConfig{KeyFile: "key.pem", InsecureSkipVerify: true},
+	}
+	errs, ok := cfg.Validate().(ConfigError)
+	if !ok {
+		t.Fatalf("Validate() error = %v, want ConfigError", cfg.Validate())
+	}
+
+	var fields []string
+	for _, fe := range errs {
+		fields = append(fields, fe.Field)
+	}
+	want := []string{"auth_mechanism", "tls.cert_file", "tls.key_file", "tls.insecure_skip_verify"}
+	if len(fields) != len(want) {
+		t.Fatalf("Validate() fields = %v, want %v", fields, want)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Errorf("Validate() fields = %v, want %v", fields, want)
+			break
+		}
+	}
+}
+
+func TestLoadConfig_X509Username(t *testing.T) {
+	pem := writeTestCert(t)
+	path := writeTestYaml(t, `
+dev:
+  enable_auth: true
+  auth_mechanism: X509
+  tls:
+    enabled: true
+    cert_file: `+pem+`
+`)
+
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantUsername string
+	}{
+		{"derives username", nil, "CN=app,OU=dev,O=mongo"},
+		{"configured username", map[string]string{EnvUsername: "CN=other"}, "CN=other"},
+		{"configured default username", map[string]string{EnvUsername: "mongo"}, "mongo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Unsetenv(EnvProfile)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := LoadConfig(path, "", nil)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			info, err := cfg.DialInfo()
+			if err != nil {
+				t.Fatalf("DialInfo() error = %v", err)
+			}
+			if info.Mechanism != AuthX509 || info.Username != tt.wantUsername || info.Source != "$external" || info.Password != "" {
+				t.Errorf("DialInfo() mechanism/username/source = %q/%q/%q, want %q/%q/%q",
+					info.Mechanism, info.Username, info.Source, AuthX509, tt.wantUsername, "$external")
+			}
+		})
+	}
+}
@@ -0,0 +1,417 @@
+/*
+ * 说明：多文档事务
+ * 作者：agent
+ * 时间：2026-10-18 08:46
+ * 更新：服务器支持时使用会话事务, 临时错误、提交结果未知时有限次重试; 单机或旧版本服务器上可回退为基于 transactions 集合的两阶段提交
+ */
+
+package dao
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/mgo.v2/txn"
+)
+
+// 服务器不支持事务时的处理方式, 见 TransactionConfig.Fallback
+const (
+	TxFallbackTwoPhase = "twophase" // 通过 transactions 集合两阶段提交(mgo/txn)
+	TxFallbackNone     = "none"     // 返回 ErrTransactionUnsupported
+)
+
+// 事务的默认配置
+const (
+	DefaultTxnCollection  = "transactions"
+	DefaultTxnMaxAttempts = 3
+	DefaultTxnTimeout     = 2 * time.Minute
+)
+
+var (
+	ErrTransactionUnsupported = errors.New("transactions not supported by server") // 服务器不支持事务且未配置回退
+	ErrTransactionAborted     = errors.New("transaction aborted")                  // Assert 不满足或插入的文档已存在, 事务未提交
+)
+
+// txnBackoff 重试事务前的等待时间
+var txnBackoff = RetryPolicy{InitialInterval: 10 * time.Millisecond, MaxInterval: time.Second, Multiplier: 2, Jitter: 0.5}
+
+// TransactionConfig 事务配置, 零值字段使用默认值
+type TransactionConfig struct {
+	Fallback    string        `yaml:"fallback"`     // 服务器不支持事务(单机、4.0 以前的版本)时: twophase(默认) 或 none
+	Collection  string        `yaml:"collection"`   // 两阶段提交记录事务的集合, 缺省为 transactions
+	MaxAttempts int           `yaml:"max_attempts"` // 遇到临时错误、提交结果未知时最多尝试的次数(含第一次), 缺省为 3
+	Timeout     time.Duration `yaml:"timeout"`      // 重试的总时间, 超过后不再重试, 缺省为 2m
+}
+
+// withDefaults 返回填充了默认值的配置
+func (c TransactionConfig) withDefaults() TransactionConfig {
+	if c.Fallback == "" {
+		c.Fallback = TxFallbackTwoPhase
+	}
+	if c.Collection == "" {
+		c.Collection = DefaultTxnCollection
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = DefaultTxnMaxAttempts
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = DefaultTxnTimeout
+	}
+	return c
+}
+
+// WithTransactionConfig 返回使用指定事务配置的 Dao
+func (d *Dao) WithTransactionConfig(cfg TransactionConfig) *Dao {
+	c := d.clone()
+	c.txn = cfg
+	return c
+}
+
+type txOpKind int
+
+const (
+	txInsert txOpKind = iota
+	txUpdate
+	txRemove
+	txAssert
+)
+
+// txOp 事务中的一个操作, 文档均以 _id 指定
+type txOp struct {
+	kind   txOpKind
+	c      string
+	id     interface{}
+	doc    bson.M // 插入的文档或更新内容
+	assert bson.M // txAssert 的条件, nil 表示文档存在
+}
+
+// Tx 事务, 由 WithTransaction 传给回调; 回调中加入的写操作在回调返回 nil 后一起提交
+// 操作按加入的顺序执行, 文档均以 _id 指定; Update、Remove 的文档不存在时不做任何修改(需要时先调用 Assert)
+type Tx struct {
+	dao    *Dao
+	ctx    context.Context
+	native bool
+	ops    []txOp
+}
+
+// Native 是否使用服务器的会话事务, false 表示两阶段提交
+func (tx *Tx) Native() bool {
+	return tx.native
+}
+
+// Insert 插入文档并返回其 _id(未指定时自动生成), 自动写入审计字段; 文档已存在时事务中止
+func (tx *Tx) Insert(name string, doc interface{}) (interface{}, error) {
+	m, err := tx.dao.prepareInsert(tx.ctx, name, doc)
+	if err != nil {
+		return nil, err
+	}
+	if m["_id"] == nil {
+		m["_id"] = bson.NewObjectId()
+	}
+	tx.ops = append(tx.ops, txOp{kind: txInsert, c: name, id: m["_id"], doc: m})
+	return m["_id"], nil
+}
+
+// Update 更新 _id 为 id 的文档, update 规则同 Dao.Update
+func (tx *Tx) Update(name string, id interface{}, update interface{}) error {
+	if id == nil || update == nil {
+		return errNull
+	}
+	u, err := tx.dao.prepareUpdate(tx.ctx, name, update, false)
+	if err != nil {
+		return err
+	}
+	tx.ops = append(tx.ops, txOp{kind: txUpdate, c: name, id: id, doc: u})
+	return nil
+}
+
+// Remove 删除 _id 为 id 的文档(物理删除)
+func (tx *Tx) Remove(name string, id interface{}) error {
+	if id == nil {
+		return errNull
+	}
+	tx.ops = append(tx.ops, txOp{kind: txRemove, c: name, id: id})
+	return nil
+}
+
+// Assert 要求 _id 为 id 的文档存在且满足 cond(为 nil 时只要求存在), 否则事务中止并返回 ErrTransactionAborted
+func (tx *Tx) Assert(name string, id interface{}, cond bson.M) error {
+	if id == nil {
+		return errNull
+	}
+	tx.ops = append(tx.ops, txOp{kind: txAssert, c: name, id: id, assert: cond})
+	return nil
+}
+
+// WithTransaction 在事务中执行 fn 加入的写操作, 全部成功或全部不生效
+//
+//	err := d.WithTransaction(ctx, func(tx *dao.Tx) error {
+//		if err := tx.Update("users", userId, bson.M{"$push": bson.M{"comments": c}}); err != nil {
+//			return err
+//		}
+//		return tx.Update("counters", "comments", bson.M{"$inc": bson.M{"seq": 1}})
+//	})
+//
+// 服务器(4.0+ 副本集, 4.2+ 分片集群)支持时使用会话事务, 遇到临时错误时重新调用 fn 并重试, 提交结果未知时重试提交;
+// 否则按配置(见 TransactionConfig、WithTransactionConfig)回退为两阶段提交或返回 ErrTransactionUnsupported。
+// 重试次数及总时间受 MaxAttempts、Timeout 限制; fn 可能被调用多次, 返回错误时不提交也不重试, 原样返回该错误。
+// 注意: fn 只能通过 tx 加入写操作, 这些操作在 fn 返回后才执行; fn 中的读取(如 d.FindDoc)不在事务中, 读到的是已提交的数据,
+// 不受事务隔离保护, 依赖读取结果的写操作应通过 Assert 在事务中校验文档的状态
+// 注意: 两阶段提交修改过的文档带有 txn-queue、txn-revno 字段, 之后应只通过 WithTransaction 修改这些文档
+func (d *Dao) WithTransaction(ctx context.Context, fn func(tx *Tx) error) error {
+	cfg := d.txn.withDefaults()
+	deadline := time.Now().Add(cfg.Timeout)
+
+	var native bool
+	err := d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		var err error
+		native, err = supportsTransactions(session)
+		return err
+	})
+	if err != nil {
+		return opError("WithTransaction", "", err)
+	}
+	if !native && cfg.Fallback == TxFallbackNone {
+		return opError("WithTransaction", "", ErrTransactionUnsupported)
+	}
+
+	for attempt := 1; ; attempt++ {
+		tx := &Tx{dao: d, ctx: ctx, native: native}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if len(tx.ops) == 0 {
+			return nil
+		}
+
+		err = d.withSessionCtx(ctx, func(session *mgo.Session) error {
+			session.SetMode(mgo.Strong, true)
+			if native {
+				return runNativeTxn(session, d.Name, tx.ops, cfg.MaxAttempts, deadline)
+			}
+			return runTwoPhaseTxn(session.DB(d.Name).C(cfg.Collection), tx.ops, cfg.MaxAttempts, deadline)
+		})
+		if err == nil || !hasLabel(err, labelTransient) || attempt >= cfg.MaxAttempts || time.Now().After(deadline) {
+			return opError("WithTransaction", "", err)
+		}
+		select {
+		case <-time.After(txnBackoff.Backoff(attempt)):
+		case <-ctx.Done():
+			return opError("WithTransaction", "", ctxError(ctx, err))
+		}
+	}
+}
+
+// 服务器返回的错误标签
+const (
+	labelTransient     = "TransientTransactionError"      // 可以重新执行整个事务
+	labelUnknownCommit = "UnknownTransactionCommitResult" // 可以重试提交
+)
+
+// txnError 带有错误标签的事务错误
+type txnError struct {
+	err    error
+	labels []string
+}
+
+func (e *txnError) Error() string { return e.err.Error() }
+func (e *txnError) Unwrap() error { return e.err }
+
+// hasLabel err 是否带有错误标签 label
+func hasLabel(err error, label string) bool {
+	var te *txnError
+	if !errors.As(err, &te) {
+		return false
+	}
+	for _, l := range te.labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// txnReply 事务中各命令的返回结果
+type txnReply struct {
+	N           int      `bson:"n"`
+	ErrorLabels []string `bson:"errorLabels"`
+	WriteErrors []struct {
+		Code   int    `bson:"code"`
+		Errmsg string `bson:"errmsg"`
+	} `bson:"writeErrors"`
+	Cursor struct {
+		FirstBatch []bson.Raw `bson:"firstBatch"`
+	} `bson:"cursor"`
+}
+
+// labeled 为命令的错误加上错误标签; 服务器未返回标签的网络错误按 network 标签处理(执行操作时可重试整个事务, 提交时结果未知)
+func labeled(err error, reply txnReply, network string) error {
+	if err == nil && len(reply.WriteErrors) > 0 {
+		e := reply.WriteErrors[0]
+		err = &mgo.QueryError{Code: e.Code, Message: e.Errmsg}
+	}
+	if err == nil {
+		return nil
+	}
+	labels := reply.ErrorLabels
+	if len(labels) == 0 {
+		if kind, _ := classify(err); kind == ErrNetworkUnavailable || kind == ErrTimeout {
+			labels = []string{network}
+		}
+	}
+	return &txnError{err: err, labels: labels}
+}
+
+// supportsTransactions 服务器是否支持会话事务
+func supportsTransactions(session *mgo.Session) (bool, error) {
+	var hello helloReply
+	if err := session.Run("isMaster", &hello); err != nil {
+		return false, err
+	}
+	return hello.transactions(), nil
+}
+
+type helloReply struct {
+	SetName        string `bson:"setName"`
+	Msg            string `bson:"msg"`
+	MaxWireVersion int    `bson:"maxWireVersion"`
+}
+
+// transactions 副本集需要 4.0+(wire version 7), 分片集群需要 4.2+(wire version 8)
+func (h helloReply) transactions() bool {
+	switch {
+	case h.SetName != "":
+		return h.MaxWireVersion >= 7
+	case h.Msg == "isdbgrid":
+		return h.MaxWireVersion >= 8
+	}
+	return false
+}
+
+// runNativeTxn 在新的逻辑会话中执行事务并提交; mgo 不支持会话, 因此直接执行带 lsid、txnNumber 的命令
+func runNativeTxn(session *mgo.Session, db string, ops []txOp, maxAttempts int, deadline time.Time) error {
+	lsid, err := newSessionId()
+	if err != nil {
+		return err
+	}
+	txnFields := bson.D{{Name: "lsid", Value: lsid}, {Name: "txnNumber", Value: int64(1)}, {Name: "autocommit", Value: false}}
+	defer session.Run(bson.D{{Name: "endSessions", Value: []interface{}{lsid}}}, nil)
+
+	for i, op := range ops {
+		cmd := append(op.command(), txnFields...)
+		if i == 0 {
+			cmd = append(cmd, bson.D{{Name: "startTransaction", Value: true}}...)
+		}
+		var reply txnReply
+		if err := op.check(labeled(session.DB(db).Run(cmd, &reply), reply, labelTransient), reply); err != nil {
+			session.Run(append(bson.D{{Name: "abortTransaction", Value: 1}}, txnFields...), nil)
+			return err
+		}
+	}
+
+	commit := commitCommand(txnFields, session.Safe())
+	for attempt := 1; ; attempt++ {
+		var reply txnReply
+		err := labeled(session.Run(commit, &reply), reply, labelUnknownCommit)
+		if err == nil || !hasLabel(err, labelUnknownCommit) || attempt >= maxAttempts || time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(txnBackoff.Backoff(attempt))
+	}
+}
+
+// commitCommand 返回提交事务的命令
+// 事务中的写操作不能单独指定写关注, 提交时使用 Session 的写关注(见 WithSafe); safe 为 nil(不确认写入)时使用服务器的默认值
+func commitCommand(txnFields bson.D, safe *mgo.Safe) bson.D {
+	cmd := append(bson.D{{Name: "commitTransaction", Value: 1}}, txnFields...)
+	if safe != nil {
+		cmd = append(cmd, bson.DocElem{Name: "writeConcern", Value: commandWriteConcern(safe)})
+	}
+	return cmd
+}
+
+// command 返回操作对应的命令(不含事务字段)
+func (op txOp) command() bson.D {
+	selector := bson.M{"_id": op.id}
+	switch op.kind {
+	case txInsert:
+		return bson.D{{Name: "insert", Value: op.c}, {Name: "documents", Value: []interface{}{op.doc}}}
+	case txUpdate:
+		return bson.D{{Name: "update", Value: op.c}, {Name: "updates", Value: []bson.M{{"q": selector, "u": op.doc}}}}
+	case txRemove:
+		return bson.D{{Name: "delete", Value: op.c}, {Name: "deletes", Value: []bson.M{{"q": selector, "limit": 1}}}}
+	}
+	for k, v := range op.assert {
+		selector[k] = v
+	}
+	return bson.D{{Name: "find", Value: op.c}, {Name: "filter", Value: selector}, {Name: "limit", Value: 1}, {Name: "batchSize", Value: 1}}
+}
+
+// check 检查 Assert 的结果, 并将插入时的重复键错误转换为 ErrTransactionAborted(与两阶段提交一致); err 为 labeled 的返回值
+func (op txOp) check(err error, reply txnReply) error {
+	switch {
+	case err != nil && op.kind == txInsert && mgo.IsDup(errors.Unwrap(err)):
+		return fmt.Errorf("%w: %s %v already exists", ErrTransactionAborted, op.c, op.id)
+	case err != nil:
+		return err
+	case op.kind == txAssert && len(reply.Cursor.FirstBatch) == 0:
+		return fmt.Errorf("%w: assertion on %s %v failed", ErrTransactionAborted, op.c, op.id)
+	}
+	return nil
+}
+
+// runTwoPhaseTxn 通过 mgo/txn 两阶段提交; 失败原因不是中止时事务可能已部分应用, 以相同的 id 恢复(Resume)直至完成
+func runTwoPhaseTxn(tc *mgo.Collection, ops []txOp, maxAttempts int, deadline time.Time) error {
+	runner := txn.NewRunner(tc)
+	id := bson.NewObjectId()
+	err := runner.Run(twoPhaseOps(ops), id, nil)
+	for attempt := 1; err != nil && err != txn.ErrAborted && attempt < maxAttempts && time.Now().Before(deadline); attempt++ {
+		time.Sleep(txnBackoff.Backoff(attempt))
+		err = runner.Resume(id)
+	}
+	if err == txn.ErrAborted {
+		return fmt.Errorf("%w: an assertion failed or an inserted document already exists", ErrTransactionAborted)
+	}
+	return err
+}
+
+// twoPhaseOps 转换为 mgo/txn 的操作, 插入时要求文档不存在
+func twoPhaseOps(ops []txOp) []txn.Op {
+	out := make([]txn.Op, len(ops))
+	for i, op := range ops {
+		o := txn.Op{C: op.c, Id: op.id}
+		switch op.kind {
+		case txInsert:
+			doc := copyM(op.doc)
+			delete(doc, "_id")
+			o.Insert, o.Assert = doc, txn.DocMissing
+		case txUpdate:
+			o.Update = op.doc
+		case txRemove:
+			o.Remove = true
+		case txAssert:
+			o.Assert = txn.DocExists
+			if len(op.assert) > 0 {
+				o.Assert = op.assert
+			}
+		}
+		out[i] = o
+	}
+	return out
+}
+
+// newSessionId 生成逻辑会话 id: {id: UUID(v4)}
+func newSessionId() (bson.M, error) {
+	uuid := make([]byte, 16)
+	if _, err := rand.Read(uuid); err != nil {
+		return nil, err
+	}
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	return bson.M{"id": bson.Binary{Kind: 0x04, Data: uuid}}, nil
+}
@@ -0,0 +1,199 @@
+/*
+ * 说明：多文档事务单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:46
+ * 更新：
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"gopkg.in/mgo.v2/txn"
+)
+
+func TestHelloTransactions(t *testing.T) {
+	tests := []struct {
+		name  string
+		hello helloReply
+		want  bool
+	}{
+		{"standalone", helloReply{MaxWireVersion: 8}, false},
+		{"replica set 3.6", helloReply{SetName: "rs0", MaxWireVersion: 6}, false},
+		{"replica set 4.0", helloReply{SetName: "rs0", MaxWireVersion: 7}, true},
+		{"mongos 4.0", helloReply{Msg: "isdbgrid", MaxWireVersion: 7}, false},
+		{"mongos 4.2", helloReply{Msg: "isdbgrid", MaxWireVersion: 8}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.hello.transactions(); got != tt.want {
+				t.Errorf("transactions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTxnLabels(t *testing.T) {
+	conflict := &mgo.QueryError{Code: 112, Message: "WriteConflict"}
+	tests := []struct {
+		name    string
+		err     error
+		reply   txnReply
+		network string
+		want    []string
+	}{
+		{"ok", nil, txnReply{}, labelTransient, nil},
+		{"server labels", conflict, txnReply{ErrorLabels: []string{labelTransient}}, labelUnknownCommit, []string{labelTransient}},
+		{"network during ops", io.EOF, txnReply{}, labelTransient, []string{labelTransient}},
+		{"network during commit", io.EOF, txnReply{}, labelUnknownCommit, []string{labelUnknownCommit}},
+		{"not retryable", &mgo.QueryError{Code: 2, Message: "bad value"}, txnReply{}, labelTransient, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := labeled(tt.err, tt.reply, tt.network)
+			if (err == nil) != (tt.err == nil) {
+				t.Fatalf("labeled() = %v", err)
+			}
+			if err == nil {
+				return
+			}
+			for _, l := range []string{labelTransient, labelUnknownCommit} {
+				want := false
+				for _, w := range tt.want {
+					want = want || w == l
+				}
+				if got := hasLabel(err, l); got != want {
+					t.Errorf("hasLabel(%s) = %v, want %v", l, got, want)
+				}
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("labeled() does not wrap %v", tt.err)
+			}
+		})
+	}
+
+	// writeErrors 转换为错误
+	reply := txnReply{}
+	reply.WriteErrors = append(reply.WriteErrors, struct {
+		Code   int    `bson:"code"`
+		Errmsg string `bson:"errmsg"`
+	}{11000, "E11000 duplicate key error"})
+	err := labeled(nil, reply, labelTransient)
+	if !mgo.IsDup(errors.Unwrap(err)) {
+		t.Errorf("labeled(writeErrors) = %v", err)
+	}
+	insert := txOp{kind: txInsert, c: "users", id: 1}
+	if err := insert.check(err, reply); !errors.Is(err, ErrTransactionAborted) {
+		t.Errorf("check(insert dup) = %v, want ErrTransactionAborted", err)
+	}
+	if err := (txOp{kind: txAssert, c: "users", id: 1}).check(nil, txnReply{}); !errors.Is(err, ErrTransactionAborted) {
+		t.Errorf("check(assert) = %v, want ErrTransactionAborted", err)
+	}
+}
+
+func TestTxOps(t *testing.T) {
+	tx := &Tx{ctx: WithActor(context.Background(), "admin")}
+	id, err := tx.Insert("users", bson.M{"account": "mongo_0"})
+	if err != nil || id == nil {
+		t.Fatalf("Insert() = %v, %v", id, err)
+	}
+	if err := tx.Update("counters", "comments", bson.M{"$inc": bson.M{"seq": 1}}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := tx.Update("counters", "comments", bson.M{"$inc": bson.M{"seq": 1}, "a": 1}); !errors.Is(err, ErrInvalidSelector) {
+		t.Errorf("Update(mixed) error = %v, want ErrInvalidSelector", err)
+	}
+	if err := tx.Remove("users", nil); err != errNull {
+		t.Errorf("Remove(nil) error = %v, want errNull", err)
+	}
+	tx.Remove("sessions", "s1")
+	tx.Assert("users", id, bson.M{"age": bson.M{"$gte": 18}})
+	tx.Assert("users", id, nil)
+
+	ops := twoPhaseOps(tx.ops)
+	if len(ops) != 5 {
+		t.Fatalf("twoPhaseOps() = %v", ops)
+	}
+	ins := ops[0].Insert.(bson.M)
+	if ops[0].Id != id || ops[0].Assert != txn.DocMissing || ins["_id"] != nil || ins[FieldCreatedBy] != "admin" {
+		t.Errorf("twoPhaseOps()[0] = %+v", ops[0])
+	}
+	if tx.ops[0].doc["_id"] != id {
+		t.Error("twoPhaseOps() modified the insert document")
+	}
+	update := ops[1].Update.(bson.M)
+	if !reflect.DeepEqual(update["$inc"], bson.M{"seq": 1}) || update["$set"].(bson.M)[FieldModifiedBy] != "admin" {
+		t.Errorf("twoPhaseOps()[1].Update = %v", update)
+	}
+	if !ops[2].Remove || !reflect.DeepEqual(ops[3].Assert, bson.M{"age": bson.M{"$gte": 18}}) || ops[4].Assert != txn.DocExists {
+		t.Errorf("twoPhaseOps() = %+v", ops[2:])
+	}
+
+	cmd := tx.ops[3].command()
+	if cmd[0].Name != "find" || !reflect.DeepEqual(cmd[1].Value, bson.M{"_id": id, "age": bson.M{"$gte": 18}}) {
+		t.Errorf("command(assert) = %v", cmd)
+	}
+	if cmd := tx.ops[2].command(); cmd[0].Name != "delete" || cmd[0].Value != "sessions" {
+		t.Errorf("command(remove) = %v", cmd)
+	}
+}
+
+func TestCommitCommand(t *testing.T) {
+	txnFields := bson.D{{Name: "txnNumber", Value: int64(1)}, {Name: "autocommit", Value: false}}
+	tests := []struct {
+		name string
+		safe *mgo.Safe
+		want bson.D
+	}{
+		{"unacknowledged", nil, bson.D{{Name: "commitTransaction", Value: 1}, {Name: "txnNumber", Value: int64(1)}, {Name: "autocommit", Value: false}}},
+		{"majority", &mgo.Safe{WMode: "majority", WTimeout: 5000}, bson.D{{Name: "commitTransaction", Value: 1},
+			{Name: "txnNumber", Value: int64(1)}, {Name: "autocommit", Value: false},
+			{Name: "writeConcern", Value: bson.D{{Name: "w", Value: "majority"}, {Name: "wtimeout", Value: 5000}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commitCommand(txnFields, tt.safe); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("commitCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if len(txnFields) != 2 {
+		t.Errorf("commitCommand() modified txnFields: %v", txnFields)
+	}
+}
+
+func TestTransactionConfig(t *testing.T) {
+	got := TransactionConfig{MaxAttempts: 5}.withDefaults()
+	want := TransactionConfig{Fallback: TxFallbackTwoPhase, Collection: DefaultTxnCollection, MaxAttempts: 5, Timeout: DefaultTxnTimeout}
+	if got != want {
+		t.Errorf("withDefaults() = %+v, want %+v", got, want)
+	}
+
+	d := (&Dao{}).WithTransactionConfig(TransactionConfig{Fallback: TxFallbackNone})
+	if d.txn.Fallback != TxFallbackNone {
+		t.Errorf("WithTransactionConfig() = %+v", d.txn)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	err := d.WithTransaction(ctx, func(tx *Tx) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || called {
+		t.Errorf("WithTransaction(canceled) = %v, called = %v", err, called)
+	}
+
+	sid, err := newSessionId()
+	if b, ok := sid["id"].(bson.Binary); err != nil || !ok || b.Kind != 0x04 || len(b.Data) != 16 || b.Data[6]>>4 != 4 {
+		t.Errorf("newSessionId() = %v, %v", sid, err)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * 说明：更新文档
+ * 作者：agent
+ * 时间：2026-10-18 08:55
+ * 更新：UpdateDoc 拆分为 Update、UpdateId、UpdateMany, 返回匹配/修改的文档数量
+ */
+
+package dao
+
+import (
+	"context"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// updateOperators 更新内容中允许使用的操作符, 其它 $ 开头的键视为拼写错误
+var updateOperators = map[string]bool{
+	"$set": true, "$unset": true, "$setOnInsert": true, "$inc": true, "$mul": true, "$min": true, "$max": true,
+	"$rename": true, "$currentDate": true, "$push": true, "$pull": true, "$pullAll": true, "$addToSet": true,
+	"$pop": true, "$bit": true,
+}
+
+// Update 更新匹配到的第一个文档, 返回匹配及修改的文档数量
+// name 集合名；selector 选择条件(selector 存储 bson.ObjectId or bson.M 类型); update 更新内容
+// update 为操作符文档(如 {"$push": {...}})或 *UpdateBuilder 时原样使用; 为字段文档(bson.M、map、bson.D)或结构体时按 $set 更新(忽略 _id、create_at)
+// 操作符与字段混用或使用了未知的操作符时返回 ErrInvalidSelector; 未匹配到文档时返回 ErrNotFound
+// 自动写入 modify_at(见 stampUpdate)
+func (d *Dao) Update(name string, selector, update interface{}) (*mgo.ChangeInfo, error) {
+	return d.UpdateCtx(context.Background(), name, selector, update)
+}
+
+// UpdateCtx 同 Update, ctx 结束时中止操作; ctx 中有操作人(见 WithActor)时写入 modified_by
+func (d *Dao) UpdateCtx(ctx context.Context, name string, selector, update interface{}) (*mgo.ChangeInfo, error) {
+	return d.update(ctx, "Update", name, selector, update, false)
+}
+
+// UpdateId 更新 _id 为 id 的文档, id 可以是任意类型; update 规则同 Update
+func (d *Dao) UpdateId(name string, id, update interface{}) (*mgo.ChangeInfo, error) {
+	return d.UpdateIdCtx(context.Background(), name, id, update)
+}
+
+// UpdateIdCtx 同 UpdateId, ctx 结束时中止操作
+func (d *Dao) UpdateIdCtx(ctx context.Context, name string, id, update interface{}) (*mgo.ChangeInfo, error) {
+	if id == nil {
+		return nil, opError("UpdateId", name, errNull)
+	}
+	return d.update(ctx, "UpdateId", name, bson.M{"_id": id}, update, false)
+}
+
+// UpdateMany 更新匹配到的全部文档, update 规则同 Update; 未匹配到文档时不返回错误
+// 更新全部文档时 selector 为 bson.M{}
+func (d *Dao) UpdateMany(name string, selector, update interface{}) (*mgo.ChangeInfo, error) {
+	return d.UpdateManyCtx(context.Background(), name, selector, update)
+}
+
+// UpdateManyCtx 同 UpdateMany, ctx 结束时中止操作
+func (d *Dao) UpdateManyCtx(ctx context.Context, name string, selector, update interface{}) (*mgo.ChangeInfo, error) {
+	return d.update(ctx, "UpdateMany", name, selector, update, true)
+}
+
+// update 生成更新内容并执行 update 命令, multi 为 false 时只更新第一个文档, 未匹配到时返回 ErrNotFound
+func (d *Dao) update(ctx context.Context, op, name string, selector, update interface{}, multi bool) (*mgo.ChangeInfo, error) {
+	sel, err := idSelector(selector)
+	if err == nil && update == nil {
+		err = errNull
+	}
+	var filters []bson.M
+	if b, ok := update.(*UpdateBuilder); ok && b != nil && err == nil {
+		filters = b.ArrayFilters()
+		update, err = b.Build()
+	}
+	if err != nil {
+		return nil, opError(op, name, err)
+	}
+	stamped, err := d.prepareUpdate(ctx, name, update, false)
+	if err != nil {
+		return nil, opError(op, name, err)
+	}
+
+	var info mgo.ChangeInfo
+	err = d.decodeCtx(ctx, &info, func(session *mgo.Session, out interface{}) error {
+		res, err := updateCommand(session.DB(d.Name).C(name), sel, stamped, multi, filters)
+		if err != nil {
+			return err
+		}
+		*out.(*mgo.ChangeInfo) = *res
+		// 不确认写入时没有匹配数量
+		if !multi && res.Matched == 0 && session.Safe() != nil {
+			return mgo.ErrNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, opError(op, name, err)
+	}
+	return &info, nil
+}
+
+// updateCommand 执行 update 命令, 返回匹配(n)及修改(nModified)的文档数量
+// mgo 的 Collection.Update 不返回修改数量, 也不支持 arrayFilters, 因此直接执行命令
+// Database.Run 按读操作选择节点且不附加 writeConcern, 因此在主节点上执行, 并使用 Session 的写关注(见 WithSafe)
+func updateCommand(co *mgo.Collection, selector, update bson.M, multi bool, arrayFilters []bson.M) (*mgo.ChangeInfo, error) {
+	stmt := bson.M{"q": selector, "u": update, "multi": multi}
+	if len(arrayFilters) > 0 {
+		stmt["arrayFilters"] = arrayFilters
+	}
+	session := co.Database.Session.Clone()
+	defer session.Close()
+	session.SetMode(mgo.Strong, false)
+	cmd := bson.D{
+		{Name: "update", Value: co.Name},
+		{Name: "updates", Value: []bson.M{stmt}},
+		{Name: "writeConcern", Value: commandWriteConcern(session.Safe())},
+	}
+	var res struct {
+		N           int `bson:"n"`
+		NModified   int `bson:"nModified"`
+		WriteErrors []struct {
+			Code   int    `bson:"code"`
+			Errmsg string `bson:"errmsg"`
+		} `bson:"writeErrors"`
+		WriteConcernError *struct {
+			Code   int    `bson:"code"`
+			Errmsg string `bson:"errmsg"`
+		} `bson:"writeConcernError"`
+	}
+	if err := co.Database.With(session).Run(cmd, &res); err != nil {
+		return nil, err
+	}
+	if len(res.WriteErrors) > 0 {
+		e := res.WriteErrors[0]
+		return nil, &mgo.QueryError{Code: e.Code, Message: e.Errmsg}
+	}
+	if e := res.WriteConcernError; e != nil {
+		return nil, &mgo.QueryError{Code: e.Code, Message: e.Errmsg}
+	}
+	return &mgo.ChangeInfo{Matched: res.N, Updated: res.NModified}, nil
+}
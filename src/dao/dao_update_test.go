@@ -0,0 +1,45 @@
+/*
+ * 说明：更新文档单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:55
+ * 更新：
+ */
+
+package dao
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestDao_UpdateValidate(t *testing.T) {
+	d := &Dao{Name: "mongo"}
+	id := bson.NewObjectId()
+	tests := []struct {
+		name string
+		call func() (*mgo.ChangeInfo, error)
+		want error
+	}{
+		{"nil selector", func() (*mgo.ChangeInfo, error) { return d.Update("users", nil, bson.M{"age": 18}) }, errNull},
+		{"nil update", func() (*mgo.ChangeInfo, error) { return d.Update("users", id, nil) }, errNull},
+		{"nil id", func() (*mgo.ChangeInfo, error) { return d.UpdateId("users", nil, bson.M{"age": 18}) }, errNull},
+		{"string selector", func() (*mgo.ChangeInfo, error) { return d.UpdateMany("users", "id", bson.M{"age": 18}) }, errUnSupportType},
+		{"mixed", func() (*mgo.ChangeInfo, error) {
+			return d.UpdateId("users", id, bson.M{"$inc": bson.M{"age": 1}, "name": "zhe"})
+		}, ErrInvalidSelector},
+		{"unknown operator", func() (*mgo.ChangeInfo, error) {
+			return d.UpdateMany("users", bson.M{}, bson.M{"$puhs": bson.M{"friends": "You"}})
+		}, ErrInvalidSelector},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := tt.call()
+			if info != nil || !errors.Is(err, tt.want) {
+				t.Errorf("got %v, %v, want error %v", info, err, tt.want)
+			}
+		})
+	}
+}
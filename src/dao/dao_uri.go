@@ -0,0 +1,420 @@
+/*
+ * 说明：MongoDB连接字符串(Connection String URI)解析与格式化
+ * 作者：agent
+ * 时间：2026-10-18 07:59
+ * 更新：支持 mongodb:// 和 mongodb+srv:// 两种格式
+ */
+
+package dao
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+const (
+	schemeMongo    = "mongodb://"
+	schemeMongoSRV = "mongodb+srv://"
+	defaultPort    = "27017"
+	redactedSecret = "xxxxx"
+)
+
+// readPreferenceModes URI中readPreference的取值与mgo.Mode的对应关系
+var readPreferenceModes = map[string]mgo.Mode{
+	"primary":            mgo.Primary,
+	"primaryPreferred":   mgo.PrimaryPreferred,
+	"secondary":          mgo.Secondary,
+	"secondaryPreferred": mgo.SecondaryPreferred,
+	"nearest":            mgo.Nearest,
+}
+
+// ParseURI 解析 mongodb:// 或 mongodb+srv:// 格式的连接字符串
+// 格式：mongodb://[username:password@]host1[:port1][,host2[:port2],...][/database][?options]
+//
+// 支持的options(不区分大小写)：authSource, authMechanism, replicaSet, readPreference,
+// connectTimeoutMS, socketTimeoutMS, maxPoolSize, w, journal, wtimeoutMS, tls(ssl), tlsCAFile, tlsCertificateKeyFile,
+// tlsAllowInvalidCertificates(tlsInsecure); 其余选项返回错误
+// 按规范 mongodb+srv:// 默认启用TLS, 可通过 tls=false 关闭
+func ParseURI(uri string) (*MongoDB, error) {
+	m := &MongoDB{}
+	if err := m.ApplyURI(uri); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ApplyURI 解析连接字符串, 将其中出现的部分覆盖到 m
+func (m *MongoDB) ApplyURI(uri string) error {
+	var rest string
+	var srv bool
+	switch {
+	case strings.HasPrefix(uri, schemeMongo):
+		rest = uri[len(schemeMongo):]
+	case strings.HasPrefix(uri, schemeMongoSRV):
+		rest, srv = uri[len(schemeMongoSRV):], true
+	default:
+		return uriError("scheme must be mongodb:// or mongodb+srv://")
+	}
+
+	var query string
+	if i := strings.Index(rest, "?"); i >= 0 {
+		rest, query = rest[:i], rest[i+1:]
+	}
+
+	var userinfo string
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		userinfo, rest = rest[:i], rest[i+1:]
+	}
+
+	var database string
+	if i := strings.Index(rest, "/"); i >= 0 {
+		rest, database = rest[:i], rest[i+1:]
+	}
+
+	// 解析主机地址
+	if rest == "" {
+		return uriError("missing host")
+	}
+	var hosts addrs
+	for _, host := range strings.Split(rest, ",") {
+		if host == "" {
+			return uriError("empty host in host list")
+		}
+		if srv {
+			hosts = append(hosts, host)
+			continue
+		}
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), defaultPort)
+		}
+		hosts = append(hosts, host)
+	}
+	if srv && (len(hosts) != 1 || strings.Contains(hosts[0], ":")) {
+		return uriError("mongodb+srv:// requires exactly one host name without port")
+	}
+
+	// 解析账号密码
+	var username, password string
+	if userinfo != "" {
+		var err error
+		user, pass, hasPass := strings.Cut(userinfo, ":")
+		if username, err = url.PathUnescape(user); err != nil {
+			return uriError("invalid username: %v", err)
+		}
+		if username == "" {
+			return uriError("empty username")
+		}
+		if hasPass {
+			if password, err = url.PathUnescape(pass); err != nil {
+				return uriError("invalid password: %v", err)
+			}
+		}
+	}
+
+	if database != "" {
+		var err error
+		if database, err = url.PathUnescape(database); err != nil {
+			return uriError("invalid database: %v", err)
+		}
+	}
+
+	// 解析选项, 先全部校验通过再写入 m
+	opts, err := url.ParseQuery(query)
+	if err != nil {
+		return uriError("invalid options: %v", err)
+	}
+	n := *m
+	if srv {
+		n.TLS.Enabled = true
+	}
+	for key, values := range opts {
+		value := values[len(values)-1]
+		switch strings.ToLower(key) {
+		case "authsource":
+			n.AuthSource = value
+		case "authmechanism":
+			switch mechanism := normalizeAuthMechanism(value); mechanism {
+			case AuthSCRAMSHA1, AuthMongoCR, AuthX509:
+				n.AuthMechanism = mechanism
+			default:
+				return uriError("unsupported authMechanism %q", value)
+			}
+		case "tls", "ssl":
+			if n.TLS.Enabled, err = strconv.ParseBool(value); err != nil {
+				return uriError("invalid %s %q", key, value)
+			}
+		case "tlscafile":
+			n.TLS.CAFile = value
+		case "tlscertificatekeyfile":
+			if hasOption(opts, "tlsCertificateFile") || hasOption(opts, "tlsPrivateKeyFile") {
+				return uriError("tlsCertificateKeyFile cannot be used with tlsCertificateFile or tlsPrivateKeyFile")
+			}
+			n.TLS.CertFile, n.TLS.KeyFile = value, ""
+		case "tlscertificatefile":
+			n.TLS.CertFile = value
+		case "tlsprivatekeyfile":
+			n.TLS.KeyFile = value
+		case "tlsallowinvalidcertificates", "tlsinsecure":
+			if n.TLS.InsecureSkipVerify, err = strconv.ParseBool(value); err != nil {
+				return uriError("invalid %s %q", key, value)
+			}
+		case "replicaset":
+			n.RepSetName, n.EnableRepSet = value, value != ""
+		case "readpreference":
+			if _, ok := readPreferenceModes[value]; !ok {
+				return uriError("invalid readPreference %q", value)
+			}
+			n.ReadPreference = value
+		case "connecttimeoutms":
+			if n.ConnectTimeout, err = parseMillis(value); err != nil {
+				return uriError("invalid %s: %v", key, err)
+			}
+		case "sockettimeoutms":
+			if n.SocketTimeout, err = parseMillis(value); err != nil {
+				return uriError("invalid %s: %v", key, err)
+			}
+		case "w":
+			n.WriteConcern.W = value
+		case "journal":
+			if n.WriteConcern.J, err = strconv.ParseBool(value); err != nil {
+				return uriError("invalid %s %q", key, value)
+			}
+		case "wtimeoutms":
+			if n.WriteConcern.WTimeout, err = parseMillis(value); err != nil {
+				return uriError("invalid %s: %v", key, err)
+			}
+		case "maxpoolsize":
+			if n.MaxPoolSize, err = strconv.Atoi(value); err != nil || n.MaxPoolSize < 0 {
+				return uriError("invalid %s %q", key, value)
+			}
+		default:
+			return uriError("unsupported option %q", key)
+		}
+	}
+
+	n.Adds, n.SRV = hosts, srv
+	if database != "" {
+		n.Name = database
+	}
+	if username != "" {
+		n.Username, n.Password, n.EnableAuth = username, password, true
+	}
+	if n.AuthMechanism == AuthX509 {
+		n.EnableAuth = true // x.509认证时URI中可以不带用户名
+	}
+	*m = n
+	return nil
+}
+
+// parseMillis 解析以毫秒为单位的时间
+func parseMillis(value string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, fmt.Errorf("%q is not a non-negative integer", value)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func uriError(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid mongodb uri: "+format, args...)
+}
+
+// hasOption 选项 key 是否出现在 opts 中, 不区分大小写
+func hasOption(opts url.Values, key string) bool {
+	for k := range opts {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// URI 将配置格式化为连接字符串, 与 ParseURI 互逆
+// 客户端证书与私钥在同一文件中时输出 tlsCertificateKeyFile, 否则输出 tlsCertificateFile、tlsPrivateKeyFile;
+// 连接字符串没有对应的选项, 因此不包含 TLS.ServerName 及 Retry、Transaction 等配置
+// 注意：返回值包含明文密码, 打印日志请使用 Redacted
+func (m *MongoDB) URI() string {
+	return m.formatURI(false)
+}
+
+// Redacted 返回隐藏了密码的连接字符串, 用于日志输出
+func (m *MongoDB) Redacted() string {
+	return m.formatURI(true)
+}
+
+// String 实现 fmt.Stringer, 输出隐藏了密码的连接字符串, 避免打印配置时泄漏密码
+// 使用值接收者, 使 MongoDB 值及指针(包括作为其它结构体的字段时)都不会泄漏密码
+func (m MongoDB) String() string {
+	return m.Redacted()
+}
+
+// GoString 实现 fmt.GoStringer, 使 %#v 同样不会泄漏密码
+func (m MongoDB) GoString() string {
+	return fmt.Sprintf("dao.MongoDB(%s)", m.Redacted())
+}
+
+func (m *MongoDB) formatURI(redact bool) string {
+	var b strings.Builder
+	if m.SRV {
+		b.WriteString(schemeMongoSRV)
+	} else {
+		b.WriteString(schemeMongo)
+	}
+
+	if m.EnableAuth && m.Username != "" {
+		b.WriteString(escapeUserinfo(m.Username))
+		if m.Password != "" {
+			b.WriteByte(':')
+			if redact {
+				b.WriteString(redactedSecret)
+			} else {
+				b.WriteString(escapeUserinfo(m.Password))
+			}
+		}
+		b.WriteByte('@')
+	}
+
+	b.WriteString(strings.Join(m.Adds, ","))
+	b.WriteByte('/')
+	b.WriteString(url.PathEscape(m.Name))
+
+	// 选项按固定顺序输出, 保证格式化结果稳定
+	opts := url.Values{}
+	if m.AuthSource != "" {
+		opts.Set("authSource", m.AuthSource)
+	}
+	if m.EnableRepSet && m.RepSetName != "" {
+		opts.Set("replicaSet", m.RepSetName)
+	}
+	if m.ReadPreference != "" {
+		opts.Set("readPreference", m.ReadPreference)
+	}
+	if m.ConnectTimeout > 0 {
+		opts.Set("connectTimeoutMS", strconv.FormatInt(int64(m.ConnectTimeout/time.Millisecond), 10))
+	}
+	if m.SocketTimeout > 0 {
+		opts.Set("socketTimeoutMS", strconv.FormatInt(int64(m.SocketTimeout/time.Millisecond), 10))
+	}
+	if m.MaxPoolSize > 0 {
+		opts.Set("maxPoolSize", strconv.Itoa(m.MaxPoolSize))
+	}
+	if m.WriteConcern.W != "" {
+		opts.Set("w", m.WriteConcern.W)
+	}
+	if m.WriteConcern.J {
+		opts.Set("journal", "true")
+	}
+	if m.WriteConcern.WTimeout > 0 {
+		opts.Set("wtimeoutMS", strconv.FormatInt(int64(m.WriteConcern.WTimeout/time.Millisecond), 10))
+	}
+	if m.EnableAuth && m.AuthMechanism != "" {
+		opts.Set("authMechanism", normalizeAuthMechanism(m.AuthMechanism))
+	}
+	if m.TLS.Enabled != m.SRV { // mongodb+srv:// 默认启用TLS
+		opts.Set("tls", strconv.FormatBool(m.TLS.Enabled))
+	}
+	if m.TLS.Enabled {
+		if m.TLS.CAFile != "" {
+			opts.Set("tlsCAFile", m.TLS.CAFile)
+		}
+		if m.TLS.KeyFile == "" {
+			if m.TLS.CertFile != "" {
+				opts.Set("tlsCertificateKeyFile", m.TLS.CertFile)
+			}
+		} else {
+			opts.Set("tlsCertificateFile", m.TLS.CertFile)
+			opts.Set("tlsPrivateKeyFile", m.TLS.KeyFile)
+		}
+		if m.TLS.InsecureSkipVerify {
+			opts.Set("tlsAllowInvalidCertificates", "true")
+		}
+	}
+	if len(opts) > 0 {
+		b.WriteByte('?')
+		b.WriteString(encodeOptions(opts))
+	}
+	return b.String()
+}
+
+// escapeUserinfo 对账号密码进行百分号编码, 除 RFC 3986 中的非保留字符外全部编码
+// url.PathEscape 不会编码 ':' 和 '@', 不能用于连接字符串中的账号密码
+func escapeUserinfo(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// encodeOptions 与 url.Values.Encode 类似, 但按key排序后保留原有大小写
+func encodeOptions(opts url.Values) string {
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, url.QueryEscape(k)+"="+url.QueryEscape(opts.Get(k)))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// lookupSRV 通过DNS SRV记录解析 mongodb+srv:// 的主机列表, 并读取TXT记录中的选项
+// 按规范TXT记录只允许包含 authSource 和 replicaSet
+func lookupSRV(hosts addrs) (addrs, url.Values, error) {
+	if len(hosts) != 1 {
+		return nil, nil, fmt.Errorf("srv lookup requires exactly one host, got %d", len(hosts))
+	}
+	name := hosts[0]
+
+	_, records, err := net.LookupSRV("mongodb", "tcp", name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("srv lookup %s: %v", name, err)
+	}
+	var resolved addrs
+	for _, r := range records {
+		target := strings.TrimSuffix(r.Target, ".")
+		resolved = append(resolved, net.JoinHostPort(target, strconv.Itoa(int(r.Port))))
+	}
+
+	opts := url.Values{}
+	txts, err := net.LookupTXT(name)
+	if err != nil {
+		// 没有TXT记录不是错误
+		return resolved, opts, nil
+	}
+	if len(txts) > 1 {
+		return nil, nil, fmt.Errorf("srv lookup %s: multiple TXT records", name)
+	}
+	for _, txt := range txts {
+		values, err := url.ParseQuery(txt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("srv lookup %s: invalid TXT record: %v", name, err)
+		}
+		for key := range values {
+			switch strings.ToLower(key) {
+			case "authsource":
+				opts.Set("authSource", values.Get(key))
+			case "replicaset":
+				opts.Set("replicaSet", values.Get(key))
+			default:
+				return nil, nil, fmt.Errorf("srv lookup %s: option %q not allowed in TXT record", name, key)
+			}
+		}
+	}
+	return resolved, opts, nil
+}
@@ -8,13 +8,14 @@
 package dao
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"reflect"
-	"strings"
+	"time"
 
-	"github.com/gedex/inflector"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"mongodb.golang.com/src/model"
@@ -22,23 +23,175 @@ import (
 
 // User数据库访问对象
 type UserDao struct {
-	dao       *Dao     // 数据库访问对象
-	ColName   string   // 集合名称
-	IndexKeys []string // 索引字段
+	dao     *Dao                    // 数据库访问对象
+	users   *Repository[model.User] // 类型化的数据访问对象
+	ColName string                  // 集合名称
 }
 
 // 初始化UserDao
+// 用户集合启用软删除(删除用户时级联软删除其评论)及乐观锁
 func NewUserDao(dao *Dao) *UserDao {
-	name := reflect.TypeOf(model.User{}).Name()
-	name = inflector.Pluralize(name)
-	name = strings.ToLower(name)
+	users := NewRepository[model.User](dao)
+	dao.SetSoftDelete(users.Name(), &SoftDeletePolicy{Cascade: []string{"comments"}})
+	dao.SetVersioned(users.Name(), true)
 	return &UserDao{
-		dao:       dao,
-		ColName:   name,
-		IndexKeys: []string{"account"},
+		dao:     dao,
+		users:   users,
+		ColName: users.Name(),
 	}
 }
 
+// PurgeDeleted 物理删除软删除超过 olderThan 的用户及评论, 返回删除的用户数量
+func (d *UserDao) PurgeDeleted(ctx context.Context, olderThan time.Duration) (int, error) {
+	return d.users.PurgeDeleted(ctx, olderThan)
+}
+
+// EnsureIndexes 创建 model.User 声明的索引并打印与集合中已有索引的差异
+// sync 为 true 时删除多余的索引、重建定义不一致的索引
+func (d *UserDao) EnsureIndexes(ctx context.Context, sync bool) error {
+	ensure := d.users.EnsureIndexes
+	if sync {
+		ensure = d.users.SyncIndexes
+	}
+	diff, err := ensure(ctx)
+	if err != nil {
+		return err
+	}
+	if !diff.Empty() {
+		fmt.Printf("indexes of %s:\n%s\n", d.ColName, diff)
+	}
+	return nil
+}
+
+// UserMigrations users 集合的迁移, 由 main 的 -migrate 参数执行
+var UserMigrations = []Migration{
+	{
+		Version:     1,
+		Name:        "rename_book_to_movies",
+		Description: "UpdateDocDemo 中的 book 字段重命名为 movies",
+		Up: func(ctx context.Context, d *Dao) error {
+			return renameField(ctx, d, CollectionName[model.User](), "book", "movies")
+		},
+		Down: func(ctx context.Context, d *Dao) error {
+			return renameField(ctx, d, CollectionName[model.User](), "movies", "book")
+		},
+	},
+	{
+		Version:     2,
+		Name:        "timestamps_to_dates",
+		Description: "create_at、modify_at、delete_at(含 comments 中的)由 TimeLayout 格式的本地时间字符串转换为 UTC 日期",
+		Up: func(ctx context.Context, d *Dao) error {
+			return convertTimestamps(ctx, d, CollectionName[model.User](), true)
+		},
+		Down: func(ctx context.Context, d *Dao) error {
+			return convertTimestamps(ctx, d, CollectionName[model.User](), false)
+		},
+	},
+}
+
+// timestampFields 时间字段, 同时转换 comments 数组中各元素的同名字段
+var timestampFields = []string{"create_at", "modify_at", "delete_at"}
+
+// convertTimestamps 将集合中的时间字符串转换为日期(toDate 为 false 时反向转换), 只更新包含待转换字段的文档(包括已软删除的文档), 可以重复执行
+func convertTimestamps(ctx context.Context, d *Dao, name string, toDate bool) error {
+	kind := "string"
+	if !toDate {
+		kind = "date"
+	}
+	var or []interface{}
+	for _, f := range timestampFields {
+		or = append(or, bson.M{f: bson.M{"$type": kind}}, bson.M{"comments." + f: bson.M{"$type": kind}})
+	}
+	// 迁移需要处理全部文档, 包括已软删除的文档
+	cur, err := d.WithDeleted(IncludeDeleted).FindCursor(ctx, name, bson.M{"$or": or}, Page{}, CursorOptions{Batch: 500}, "_id")
+	if err != nil {
+		return err
+	}
+	return cur.Each(func(c *Cursor) error {
+		var doc bson.M
+		if err := c.Decode(&doc); err != nil {
+			return err
+		}
+		set, err := convertTimestampFields(doc, toDate)
+		if err != nil {
+			return fmt.Errorf("document %v: %w", doc["_id"], err)
+		}
+		if comments, ok := doc["comments"].([]interface{}); ok {
+			changed := false
+			for i, e := range comments {
+				comment, ok := e.(bson.M)
+				if !ok {
+					continue
+				}
+				sub, err := convertTimestampFields(comment, toDate)
+				if err != nil {
+					return fmt.Errorf("document %v comments[%d]: %w", doc["_id"], i, err)
+				}
+				for k, v := range sub {
+					comment[k] = v
+					changed = true
+				}
+			}
+			if changed {
+				set["comments"] = comments
+			}
+		}
+		if len(set) == 0 {
+			return nil
+		}
+		return d.withSessionCtx(ctx, func(session *mgo.Session) error {
+			return session.DB(d.Name).C(name).UpdateId(doc["_id"], bson.M{"$set": set})
+		})
+	})
+}
+
+// convertTimestampFields 返回 doc 中需要更新的时间字段:
+// toDate 时 TimeLayout 格式的本地时间字符串 => UTC 日期, 空字符串 => null; 否则反向转换
+func convertTimestampFields(doc bson.M, toDate bool) (bson.M, error) {
+	set := bson.M{}
+	for _, f := range timestampFields {
+		v, ok := doc[f]
+		if !ok {
+			continue
+		}
+		switch t := v.(type) {
+		case string:
+			if !toDate {
+				continue
+			}
+			if t == "" {
+				set[f] = nil
+				continue
+			}
+			parsed, err := time.ParseInLocation(TimeLayout, t, time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", f, err)
+			}
+			set[f] = parsed.UTC()
+		case time.Time:
+			if !toDate {
+				set[f] = t.In(time.Local).Format(TimeLayout)
+			}
+		case nil:
+			if !toDate {
+				set[f] = ""
+			}
+		}
+	}
+	return set, nil
+}
+
+// renameField 重命名集合中所有文档的字段, 只更新包含该字段的文档, 可以重复执行
+func renameField(ctx context.Context, d *Dao, name, from, to string) error {
+	return d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		_, err := session.DB(d.Name).C(name).UpdateAll(
+			bson.M{from: bson.M{"$exists": true}},
+			bson.M{"$rename": bson.M{from: to}},
+		)
+		return err
+	})
+}
+
 // CreateDocDemo
 func (d *UserDao) CreateDocDemo() error {
 	var err error
@@ -57,18 +210,28 @@ func (d *UserDao) CreateDocDemo() error {
 				District: "gs",
 				Remark:   "Earth",
 			},
-			CreateAt: Now(),
-			ModifyAt: Now(),
-			IsDelete: false,
-			DeleteAt: "",
 		}
-		if err = d.dao.CreateDoc(d.ColName, user, d.IndexKeys...); err != nil {
+		// create_at、modify_at、is_delete 由 CreateDoc 写入
+		if err = d.dao.CreateDoc(d.ColName, user); err != nil {
 			break
 		}
 	}
 	return err
 }
 
+// ImportUsers 批量导入用户, 无序执行: 账号重复等失败的用户被跳过并打印, 不影响其它用户
+func (d *UserDao) ImportUsers(ctx context.Context, users []model.User) (*BulkReport, error) {
+	bulk := d.users.Bulk().Unordered()
+	for _, user := range users {
+		bulk.Insert(user)
+	}
+	report, err := bulk.Run(ctx)
+	for _, res := range report.Failed() {
+		fmt.Printf("import %s: %v\n", users[res.Index].Account, res.Err)
+	}
+	return report, err
+}
+
 // UpsertDocDemo: 如果文档存在则更新，不存在则创建
 // Operators: $set, $setOnInsert
 func (d *UserDao) UpsertDocDemo() error {
@@ -86,24 +249,24 @@ func (d *UserDao) UpsertDocDemo() error {
 			Remark:   "Earth",
 		},
 		Comments: []model.Comment{},
-		ModifyAt: Now(),
-		IsDelete: false,
-		DeleteAt: "",
 	}
 	selector := bson.M{"account": user.Account}
 
+	// 结构体按 $set 更新(忽略 _id、create_at), 其中的 is_delete、delete_at 不应被覆盖
 	update := bson.M{}
-	if err := StructToMap(user, &update); err != nil {
+	data, err := bson.Marshal(user)
+	if err != nil {
+		return err
+	}
+	if err := bson.Unmarshal(data, &update); err != nil {
 		return err
 	}
-	delete(update, "create_at")
+	delete(update, "is_delete")
+	delete(update, "delete_at")
 
-	// $setOnInsert 设置只在文档创建时需要添加的字段
+	// modify_at 由 UpsertDoc 写入; 插入时 create_at、is_delete 由 UpsertDoc 通过 $setOnInsert 写入
 	change := mgo.Change{
-		Update: bson.M{
-			"$set":         update,
-			"$setOnInsert": bson.M{"create_at": Now(), "is_delete": false, "delete_at": ""},
-		},
+		Update:    update,
 		Upsert:    true,
 		ReturnNew: true,
 	}
@@ -126,17 +289,18 @@ func (d *UserDao) UpdateDocDemo() error {
 		"$set": bson.M{"name": "mongo", "book": "golang", "modify_at": Now()},
 		"$inc": bson.M{"age": 6},
 	}
-	err := d.dao.UpdateDoc(d.ColName, selector, update)
+	changeInfo, err := d.dao.Update(d.ColName, selector, update)
 	if err != nil {
 		return err
 	}
+	fmt.Printf("%+v\n", *changeInfo)
 
 	// 删除|重命名键
 	update = bson.M{
 		"$unset":  bson.M{"price": "", "password": ""},
 		"$rename": bson.M{"book": "movies"},
 	}
-	err = d.dao.UpdateDoc(d.ColName, selector, update)
+	_, err = d.dao.Update(d.ColName, selector, update)
 	if err != nil {
 		return err
 	}
@@ -146,6 +310,7 @@ func (d *UserDao) UpdateDocDemo() error {
 
 // UpdateEmbedDocDemo: 更新内嵌文档(整体更新|部分字段更新)
 // Operators: $set、.
+// modify_at 由 Update 自动写入
 func (d *UserDao) UpdateEmbedDocDemo() error {
 	selector := bson.M{"account": "mongo_a"}
 
@@ -156,15 +321,15 @@ func (d *UserDao) UpdateEmbedDocDemo() error {
 		District: "xihu",
 		Remark:   "Earth",
 	}
-	update := bson.M{"$set": bson.M{"address": address, "modify_at": Now()}}
-	err := d.dao.UpdateDoc(d.ColName, selector, update)
+	update := NewUpdateFor[model.User]().Set("address", address)
+	_, err := d.dao.Update(d.ColName, selector, update)
 	if err != nil {
 		return err
 	}
 
 	// 部分字段
-	update = bson.M{"$set": bson.M{"address.province": "beijing", "modify_at": Now()}}
-	err = d.dao.UpdateDoc(d.ColName, selector, update)
+	update = NewUpdateFor[model.User]().Set("address.province", "beijing")
+	_, err = d.dao.Update(d.ColName, selector, update)
 	if err != nil {
 		return err
 	}
@@ -177,20 +342,17 @@ func (d *UserDao) UpdateArrDemo() error {
 	selector := bson.M{"account": "mongo_a"}
 
 	// 添加一个元素
-	var err error
-	var update = make(bson.M)
-	update = bson.M{"$push": bson.M{"friends": "You"}}
-	err = d.dao.UpdateDoc(d.ColName, selector, update)
+	update := NewUpdateFor[model.User]().Push("friends", "You")
+	_, err := d.dao.Update(d.ColName, selector, update)
 	if err != nil {
 		return err
 	}
 
 	// 添加多个元素
-	update = bson.M{"$push": bson.M{"friends": bson.M{
-		"$each":  []string{"You", "A", "B", "C", "D", "E", "F", "G"}, // 注：这个地方会插入重复数据：You
-		"$slice": -5,                                                 // 限定数组长度;且不超过10;超过则保留最后10个
-	}}}
-	err = d.dao.UpdateDoc(d.ColName, selector, update)
+	last := -5 // 限定数组长度, 超过则保留最后5个
+	update = NewUpdateFor[model.User]().
+		PushEach("friends", []string{"You", "A", "B", "C", "D", "E", "F", "G"}, &PushOptions{Slice: &last}) // 注：这个地方会插入重复数据：You
+	_, err = d.dao.Update(d.ColName, selector, update)
 	if err != nil {
 		return err
 	}
@@ -202,25 +364,22 @@ func (d *UserDao) UpdateArrDemo() error {
 	}
 	BsonMapToJson(results)
 
-	// 删除元素
-	update = bson.M{"$pop": bson.M{"friends": -1}} // 从头删除
-	err = d.dao.UpdateDoc(d.ColName, selector, update)
+	// 删除元素: 同一字段在一次更新中只能出现一次
+	update = NewUpdateFor[model.User]().Pop("friends", PopFirst) // 从头删除
+	_, err = d.dao.Update(d.ColName, selector, update)
 	if err != nil {
 		return err
 	}
 
-	update = bson.M{"$pop": bson.M{"friends": 1}} // 从尾删除
-	err = d.dao.UpdateDoc(d.ColName, selector, update)
+	update = NewUpdateFor[model.User]().Pop("friends", PopLast) // 从尾删除
+	_, err = d.dao.Update(d.ColName, selector, update)
 	if err != nil {
 		return err
 	}
 
-	// 添加多个不重复元素
-	update = bson.M{"$addToSet": bson.M{"friends": bson.M{
-		"$each":  []string{"D", "E", "You", "Zhe", "Me"},
-		"$slice": 5,
-	}}}
-	err = d.dao.UpdateDoc(d.ColName, selector, update)
+	// 添加多个不重复元素($addToSet 不支持 $slice)
+	update = NewUpdateFor[model.User]().AddToSet("friends", "D", "E", "You", "Zhe", "Me")
+	_, err = d.dao.Update(d.ColName, selector, update)
 	if err != nil {
 		return err
 	}
@@ -229,18 +388,18 @@ func (d *UserDao) UpdateArrDemo() error {
 }
 
 // UpdateEmbedArrDocDemo: 更新内嵌数组文档
-// Operators:
+// Operators: $push, $inc
+// 添加评论并累加 counters 集合中的评论计数(需已存在 _id 为 comments 的文档), 二者在同一事务中完成
 func (d *UserDao) UpdateEmbedArrDocDemo() error {
 	selector := bson.M{"account": "mongo_a"}
-	user, err := d.dao.FindOneDoc(d.ColName, selector)
+	user, err := d.users.FindOne(context.Background(), selector)
 	if err != nil {
 		return err
 	}
-	result := user.(bson.M)
 
 	userRef := mgo.DBRef{
 		Collection: d.ColName,
-		Id:         result["_id"].(bson.ObjectId),
+		Id:         user.Id,
 		Database:   d.dao.Name,
 	}
 
@@ -248,16 +407,16 @@ func (d *UserDao) UpdateEmbedArrDocDemo() error {
 		Id:       bson.NewObjectId(),
 		Content:  "Code compile",
 		UserRef:  userRef,
-		CreateAt: Now(),
-		ModifyAt: Now(),
+		CreateAt: model.Now(),
+		ModifyAt: model.Now(),
 		IsDelete: false,
-		DeleteAt: "",
-	}
-	err = d.dao.UpdateDoc(d.ColName, selector, bson.M{"$push": bson.M{"comments": comments}})
-	if err != nil {
-		return err
 	}
-	return nil
+	return d.dao.WithTransaction(context.Background(), func(tx *Tx) error {
+		if err := tx.Update(d.ColName, user.Id, bson.M{"$push": bson.M{"comments": comments}}); err != nil {
+			return err
+		}
+		return tx.Update("counters", "comments", bson.M{"$inc": bson.M{"seq": 1}})
+	})
 }
 
 // 查询文档
@@ -266,38 +425,83 @@ func (d *UserDao) FindDocDemo() error {
 	page.checkValid("0", "5")
 	sortKeys := []string{"-age"}
 
-	var err error
-	var result interface{}
-
 	// 按嵌入文档字段查询
 	condition := bson.M{"account": "mongo_0"}
-	result, err = d.dao.FindDoc(d.ColName, condition, page, sortKeys...)
+	results, err := d.users.Find(context.Background(), condition, page, sortKeys...)
 	if err != nil {
 		return err
 	}
-	fmt.Printf("type: %T, data:%+v\n", result, result)
-
-	results := result.([]bson.M)
+	fmt.Printf("type: %T, data:%+v\n", results, results)
 	fmt.Println("total:", len(results), "data:", results)
 
 	return nil
 }
 
+// 查询文档：键集分页, 按 -age 排序逐页向后翻, 再向前翻回一页
+func (d *UserDao) KeysetDemo() error {
+	var users []model.User
+	ks := Keyset{Limit: 3}
+	page, err := d.dao.FindDocToResultsKeyset(d.ColName, &users, bson.M{}, ks, "-age")
+	if err != nil {
+		return err
+	}
+	for page.Next != "" {
+		fmt.Println("users:", len(users), "next:", page.Next)
+		ks.Token = page.Next
+		if page, err = d.dao.FindDocToResultsKeyset(d.ColName, &users, bson.M{}, ks, "-age"); err != nil {
+			return err
+		}
+	}
+
+	if page.Prev != "" {
+		ks.Token = page.Prev
+		if _, err = d.dao.FindDocToResultsKeyset(d.ColName, &users, bson.M{}, ks, "-age"); err != nil {
+			return err
+		}
+		fmt.Println("prev page:", users)
+	}
+	return nil
+}
+
+// 查询文档：使用 q. 操作符
+func (d *UserDao) SearchDemo() error {
+	search := `{"age": {"$gte": 2}, "q.select": {"name": 1, "age": 1}, "q.sort": "-age", "q.limit": 3}`
+	// 客户端传入的查询参数需先按字段、操作符白名单校验
+	op, err := d.users.Filter().CompileSearch([]byte(search))
+	if err != nil {
+		return err
+	}
+	results, err := d.dao.FindDoc(d.ColName, op, Page{})
+	if err != nil {
+		return err
+	}
+	BsonMapToJson(results)
+
+	// q.count: 返回匹配的文档数量
+	op.Count = true
+	total, err := d.dao.FindDoc(d.ColName, op, Page{})
+	if err != nil {
+		return err
+	}
+	fmt.Println("total:", total)
+
+	return nil
+}
+
 // 查询文档：指定需要的字段
 func (d *UserDao) FindWithSelectDemo() error {
-	session := d.dao.SessionCopy()
-	defer session.Close()
-	co := d.dao.GetCollection(d.ColName, session)
-
-	var q *mgo.Query
 	query := bson.M{"age": 2}
-	q = co.Find(query)
+	h, err := d.dao.Query(context.Background(), d.ColName, query, Page{})
+	if err != nil {
+		return err
+	}
+	defer h.Close()
 
 	var results []interface{}
 
 	// 返回所有字段
 	selector := bson.M{}
-	err := q.Select(selector).All(&results)
+	err = h.Select(selector).All(&results)
 	if err != nil {
 		return err
 	}
@@ -305,7 +509,7 @@ func (d *UserDao) FindWithSelectDemo() error {
 
 	// 只返回指定值为1的字段
 	selector = bson.M{"name": 1, "age": 1}
-	err = q.Select(selector).All(&results)
+	err = h.Select(selector).All(&results)
 	if err != nil {
 		return err
 	}
@@ -313,7 +517,7 @@ func (d *UserDao) FindWithSelectDemo() error {
 
 	// 指定为 0 的字段都不返回;其余都返回
 	selector = bson.M{"name": 0, "age": 0}
-	err = q.Select(selector).All(&results)
+	err = h.Select(selector).All(&results)
 	if err != nil {
 		return err
 	}
@@ -322,17 +526,20 @@ func (d *UserDao) FindWithSelectDemo() error {
 	// {"name": 1, "age": 0} 是互斥操作
 	// output err: Projection cannot have a mix of inclusion and exclusion.
 	selector = bson.M{"name": 1, "age": 0}
-	return q.Select(selector).All(&results)
+	return h.Select(selector).All(&results)
 }
 
 // 查询&修改数组、内嵌数组文档
-// Operators: $all
+// Operators: $all, $elemMatch, $, $[identifier]
 func (d *UserDao) FindEmbedArrDemo() error {
 	page := Page{}
 	page.checkValid("0", "2")
 
 	// 查询数组中包含所有指定元素的文档
-	query := bson.M{"friends": bson.M{"$all": []string{"KD", "YM"}}}
+	query, err := NewFilterFor[model.User]().All("friends", "KD", "YM").Build()
+	if err != nil {
+		return err
+	}
 	results, err := d.dao.FindDoc(d.ColName, query, page)
 	if err != nil {
 		return err
@@ -340,17 +547,29 @@ func (d *UserDao) FindEmbedArrDemo() error {
 	BsonMapToJson(results)
 
 	// 更新内嵌数组文档
-	selector := bson.M{
-		"account":  "mongo_a",
-		"comments": bson.M{"$elemMatch": bson.M{"content": "This is a comment"}},
+	selector, err := NewFilterFor[model.User]().
+		Eq("account", "mongo_a").
+		ElemMatch("comments", NewFilter().Eq("content", "This is a comment")).
+		Build()
+	if err != nil {
+		return err
 	}
-	update := bson.M{"$set": bson.M{ // $ 操作符最后会取代满足 selector 条件的第一个数据元素对应的 index
-		"comments.$.email":     "303xx680@qq.com",
-		"comments.$.stars":     6,
-		"comments.$.modify_at": Now(),
-		"modify_at":            Now(),
-	}}
-	err = d.dao.UpdateDoc(d.ColName, selector, update)
+	// $ 操作符最后会取代满足 selector 条件的第一个数据元素对应的 index
+	// model.Comment 没有 email、stars 字段, 因此不按模型校验
+	update := NewUpdate().
+		Set(Positional("comments", "email"), "303xx680@qq.com").
+		Set(Positional("comments", "stars"), 6).
+		CurrentDate(Positional("comments", "modify_at"))
+	_, err = d.dao.Update(d.ColName, selector, update)
+	if err != nil {
+		return err
+	}
+
+	// 更新满足 arrayFilters 条件的全部内嵌数组文档
+	update = NewUpdateFor[model.User]().
+		CurrentDate(Filtered("comments", "c", "modify_at")).
+		ArrayFilter("c", bson.M{"content": "This is a comment"})
+	_, err = d.dao.Update(d.ColName, bson.M{"account": "mongo_a"}, update)
 	if err != nil {
 		return err
 	}
@@ -400,6 +619,48 @@ func (d *UserDao) PipeSearchDemo() error {
 	return nil
 }
 
+// 导出集合: 使用游标逐批读取, 不会将全部文档载入内存
+func (d *UserDao) ExportDemo(w io.Writer) error {
+	cur, err := d.dao.FindCursor(context.Background(), d.ColName, bson.M{}, Page{}, CursorOptions{Batch: 500}, "_id")
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	return cur.Each(func(c *Cursor) error {
+		var user model.User
+		if err := c.Decode(&user); err != nil {
+			return err
+		}
+		return enc.Encode(user)
+	})
+}
+
+// 聚合查询: 允许使用磁盘临时文件, 只读取前两组
+func (d *UserDao) PipeCursorDemo() error {
+	pipes := []bson.M{
+		{"$group": bson.M{"_id": "$age", "total": bson.M{"$sum": 1}}},
+		{"$sort": bson.M{"total": -1}},
+	}
+	cur, err := d.dao.PipeCursor(context.Background(), d.ColName, pipes, CursorOptions{Batch: 100, AllowDiskUse: true})
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	return cur.Each(func(c *Cursor) error {
+		var group bson.M
+		if err := c.Decode(&group); err != nil {
+			return err
+		}
+		fmt.Println(group)
+		if n++; n == 2 {
+			return ErrStopIteration
+		}
+		return nil
+	})
+}
+
 // 按GridFS规范存取文件
 func (d *UserDao) GridFsDemo() error {
 	id, err := d.dao.CreateGridFs("file.txt", []byte("你住的巷子里，我租了一间公寓"))
@@ -473,6 +734,10 @@ func (d *UserDao) TestMgoError() error {
 	fmt.Printf("errors: %v\n", err)  // nil
 	fmt.Printf("result: %+v\n\n", s) // []
 
+	// 按模型校验字段路径, 拼错字段名时返回错误而不是空结果
+	_, err = NewFilterFor[model.User]().Eq("nam", "").Build()
+	fmt.Printf("errors: %v\n\n", err) // filter nam.$eq: unknown field
+
 	var ss []interface{}
 	err = col.Find(bson.M{}).Limit(2).All(&ss)
 	fmt.Printf("errors: %v\n", err)   // nil
@@ -491,11 +756,15 @@ func (d *UserDao) TestMgoError() error {
 type Response struct {
 	Total int         `json:"total"`
 	Data  interface{} `json:"data"`
+	Page  *PageInfo   `json:"page,omitempty"` // 分页信息, 见 PageResult.Response
 }
 
 // MarshalJSON
 func (r Response) MarshalJSON() ([]byte, error) {
-	kind := reflect.TypeOf(r.Data).Kind()
+	var kind reflect.Kind
+	if r.Data != nil {
+		kind = reflect.TypeOf(r.Data).Kind()
+	}
 
 	if kind == reflect.Map {
 		result := r.Data.(bson.M)
@@ -516,9 +785,11 @@ func (r Response) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&struct {
 		Total int         `json:"total"`
 		Data  interface{} `json:"data"`
+		Page  *PageInfo   `json:"page,omitempty"`
 	}{
 		Total: r.Total,
 		Data:  r.Data,
+		Page:  r.Page,
 	})
 }
 
@@ -550,13 +821,16 @@ func (d *UserDao) TestFindOneResultJsonMarshal() error {
 }
 
 func (d *UserDao) TestFindAllResultJsonMarshal() error {
-	result, err := d.dao.FindDoc(d.ColName, bson.M{}, Page{})
+	page := Page{}
+	page.checkValid("0", "5")
+
+	// Total 为匹配的文档总数, 而不是本页的文档数量
+	result, err := d.dao.FindPage(d.ColName, nil, bson.M{}, page, CountFacet)
 	if err != nil {
 		return err
 	}
-	results := result.([]bson.M)
 
-	resp := Response{Total: len(results), Data: result}
+	resp := result.Response()
 	data, err := resp.MarshalJSON()
 	if err != nil {
 		return err
@@ -35,19 +35,16 @@ func (a *addrs) Set(value string) error {
 	return nil
 }
 
+// 时间、日期字符串的格式: 解析查询条件中的时间, 及迁移之前存储的时间字符串(服务器本地时间)
 const (
 	TimeLayout = "2006-01-02 15:04:05"
 	DateLayout = "2006-01-02"
 )
 
-// 获取当前时间
-func Now() string {
-	now := time.Now()
-	local, err := time.LoadLocation("Local") // 服务器上设置的时区
-	if err != nil {
-		println(err)
-	}
-	return now.In(local).Format(TimeLayout)
+// Now 获取当前时间(UTC), 精度为毫秒(与 BSON 日期一致), 用于更新内容中的 create_at、modify_at 等字段
+// 结构体中的时间字段使用 model.Now()
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
 }
 
 // 获取当前日期
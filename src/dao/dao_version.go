@@ -0,0 +1,191 @@
+/*
+ * 说明：乐观锁
+ * 作者：agent
+ * 时间：2026-10-18 08:53
+ * 更新：按集合启用 version 字段, 每次写入加 1; UpdateIfVersion 只在版本号一致时更新, 否则返回 ErrConflict 及服务器上的版本号
+ */
+
+package dao
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// FieldVersion 乐观锁版本号, 插入时为 1, 每次写入加 1
+const FieldVersion = "version"
+
+// ConflictError 版本号不一致的错误详情, errors.Is(err, ErrConflict) 为 true
+type ConflictError struct {
+	Id       interface{} // 文档 _id
+	Expected int         // 调用方读取时的版本号
+	Current  int         // 服务器上的版本号
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("version conflict on %v: expected %d, current %d", e.Id, e.Expected, e.Current)
+}
+
+// Unwrap 返回 ErrConflict
+func (e *ConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// SetVersioned 为集合 name 启用(或停用)乐观锁; 应在启动时调用
+// 启用后 CreateDoc、Update、UpsertDoc、RemoveDocByMark、Bulk、WithTransaction 及 Repository 的写入方法维护 version 字段,
+// 更新内容中 $set 的 version 被忽略, 以免覆盖服务器上的版本号
+func (d *Dao) SetVersioned(name string, enabled bool) {
+	p := d.collectionPolicies()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !enabled {
+		delete(p.versioned, name)
+		return
+	}
+	if p.versioned == nil {
+		p.versioned = make(map[string]bool)
+	}
+	p.versioned[name] = true
+}
+
+// Versioned 集合 name 是否启用了乐观锁
+func (d *Dao) Versioned(name string) bool {
+	if d == nil || d.policies == nil {
+		return false
+	}
+	d.policies.mu.RLock()
+	defer d.policies.mu.RUnlock()
+	return d.policies.versioned[name]
+}
+
+// prepareInsert 写入审计字段(见 stampInsert), 集合启用了乐观锁时写入 version
+func (d *Dao) prepareInsert(ctx context.Context, name string, doc interface{}) (bson.M, error) {
+	m, err := stampInsert(ctx, doc)
+	if err == nil && d.Versioned(name) {
+		versionInsert(m)
+	}
+	return m, err
+}
+
+// prepareInserts 同 prepareInsert, docs 为切片时逐个处理
+func (d *Dao) prepareInserts(ctx context.Context, name string, docs interface{}) ([]interface{}, error) {
+	out, err := stampInserts(ctx, docs)
+	if err == nil && d.Versioned(name) {
+		for _, doc := range out {
+			versionInsert(doc.(bson.M))
+		}
+	}
+	return out, err
+}
+
+// prepareUpdate 生成更新内容并写入审计字段(见 stampUpdate), 集合启用了乐观锁时版本号加 1
+func (d *Dao) prepareUpdate(ctx context.Context, name string, update interface{}, upsert bool) (bson.M, error) {
+	u, err := stampUpdate(ctx, update, upsert)
+	if err == nil && d.Versioned(name) {
+		err = versionUpdate(u)
+	}
+	return u, err
+}
+
+// versionInsert 未指定版本号(不存在、nil 或任意数值类型的 0, 如 Version int64 字段的零值)时为 1
+func versionInsert(doc bson.M) {
+	if v, ok := doc[FieldVersion]; !ok || v == nil || isZeroNumber(v) {
+		doc[FieldVersion] = 1
+	}
+}
+
+// isZeroNumber v 是否为整数或浮点数类型的 0
+func isZeroNumber(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return rv.IsZero()
+	}
+	return false
+}
+
+// versionUpdate 移除 $set、$setOnInsert 中的 version, 并加入 {$inc: {version: 1}}; 其它操作符已修改 version 时保持不变
+// upsert 插入新文档时 $inc 的结果为 1
+func versionUpdate(update bson.M) error {
+	for _, op := range []string{"$set", "$setOnInsert"} {
+		fields, err := operatorFields(update, op)
+		if err != nil {
+			return err
+		}
+		if _, ok := fields[FieldVersion]; !ok {
+			continue
+		}
+		delete(fields, FieldVersion)
+		if len(fields) > 0 {
+			update[op] = fields
+		} else {
+			delete(update, op)
+		}
+	}
+	if touches(update, FieldVersion) {
+		return nil
+	}
+	inc, err := operatorFields(update, "$inc")
+	if err != nil {
+		return err
+	}
+	inc[FieldVersion] = 1
+	update["$inc"] = inc
+	return nil
+}
+
+// versionSelector 匹配 _id 及版本号; version 为 0 时同时匹配没有 version 字段的旧文档
+func versionSelector(id interface{}, version int) bson.M {
+	if version == 0 {
+		return bson.M{"_id": id, FieldVersion: bson.M{"$in": []interface{}{0, nil}}}
+	}
+	return bson.M{"_id": id, FieldVersion: version}
+}
+
+// conflict 按 _id 匹配但版本号不一致时读取服务器上的版本号, 返回 *ConflictError; 文档不存在时返回 mgo.ErrNotFound
+func conflict(ctx context.Context, co *mgo.Collection, id interface{}, expected int) error {
+	var doc struct {
+		Version int `bson:"version"`
+	}
+	if err := withMaxTime(ctx, co.FindId(id).Select(bson.M{FieldVersion: 1})).One(&doc); err != nil {
+		return err
+	}
+	return &ConflictError{Id: id, Expected: expected, Current: doc.Version}
+}
+
+// UpdateIfVersion 只在文档的版本号为 version 时更新, 并将版本号加 1
+// name 集合名；id 文档 _id; version 调用方读取时的版本号(0 匹配没有版本号的旧文档); update 规则同 Update
+// 版本号不一致时返回 ErrConflict(详见 ConflictError, 包含服务器上的版本号), 文档不存在时返回 ErrNotFound
+func (d *Dao) UpdateIfVersion(name string, id bson.ObjectId, version int, update interface{}) error {
+	return d.UpdateIfVersionCtx(context.Background(), name, id, version, update)
+}
+
+// UpdateIfVersionCtx 同 UpdateIfVersion, ctx 结束时中止操作; ctx 中有操作人(见 WithActor)时写入 modified_by
+func (d *Dao) UpdateIfVersionCtx(ctx context.Context, name string, id bson.ObjectId, version int, update interface{}) error {
+	if id == "" || update == nil {
+		return opError("UpdateIfVersion", name, errNull)
+	}
+	u, err := stampUpdate(ctx, update, false)
+	if err == nil {
+		err = versionUpdate(u)
+	}
+	if err != nil {
+		return opError("UpdateIfVersion", name, err)
+	}
+
+	err = d.withSessionCtx(ctx, func(session *mgo.Session) error {
+		co := session.DB(d.Name).C(name)
+		err := co.Update(versionSelector(id, version), u)
+		if err == mgo.ErrNotFound {
+			return conflict(ctx, co, id, version)
+		}
+		return err
+	})
+	return opError("UpdateIfVersion", name, err)
+}
@@ -0,0 +1,145 @@
+/*
+ * 说明：乐观锁单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:53
+ * 更新：
+ */
+
+package dao
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestVersionUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		update bson.M
+		want   bson.M
+	}{
+		{"set", bson.M{"$set": bson.M{"age": 18}}, bson.M{"$set": bson.M{"age": 18}, "$inc": bson.M{"version": 1}}},
+		{"merge inc", bson.M{"$inc": bson.M{"age": 1}}, bson.M{"$inc": bson.M{"age": 1, "version": 1}}},
+		{"ignore set version", bson.M{"$set": bson.M{"age": 18, "version": 5}}, bson.M{"$set": bson.M{"age": 18}, "$inc": bson.M{"version": 1}}},
+		{"only version", bson.M{"$set": bson.M{"version": 5}}, bson.M{"$inc": bson.M{"version": 1}}},
+		{"explicit inc", bson.M{"$inc": bson.M{"version": 2}}, bson.M{"$inc": bson.M{"version": 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := versionUpdate(tt.update); err != nil || !reflect.DeepEqual(tt.update, tt.want) {
+				t.Errorf("versionUpdate() = %v, %v, want %v", tt.update, err, tt.want)
+			}
+		})
+	}
+
+	inserts := []struct {
+		name string
+		doc  bson.M
+		want interface{}
+	}{
+		{"missing", bson.M{"name": "zhe"}, 1},
+		{"nil", bson.M{"version": nil}, 1},
+		{"int zero", bson.M{"version": 0}, 1},
+		{"int64 zero", bson.M{"version": int64(0)}, 1},
+		{"float64 zero", bson.M{"version": float64(0)}, 1},
+		{"int", bson.M{"version": 3}, 3},
+		{"int64", bson.M{"version": int64(3)}, int64(3)},
+		{"not a number", bson.M{"version": ""}, ""},
+	}
+	for _, tt := range inserts {
+		t.Run(tt.name, func(t *testing.T) {
+			versionInsert(tt.doc)
+			if got := tt.doc[FieldVersion]; got != tt.want {
+				t.Errorf("versionInsert() version = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	// 结构体转换后 int64 的零值同样视为未指定
+	var doc bson.M
+	data, _ := bson.Marshal(struct {
+		Version int64 `bson:"version"`
+	}{})
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if versionInsert(doc); doc[FieldVersion] != 1 {
+		t.Errorf("versionInsert(int64 struct field) version = %#v, want 1", doc[FieldVersion])
+	}
+}
+
+func TestVersionSelector(t *testing.T) {
+	id := bson.NewObjectId()
+	if got := versionSelector(id, 2); !reflect.DeepEqual(got, bson.M{"_id": id, "version": 2}) {
+		t.Errorf("versionSelector(2) = %v", got)
+	}
+	want := bson.M{"_id": id, "version": bson.M{"$in": []interface{}{0, nil}}}
+	if got := versionSelector(id, 0); !reflect.DeepEqual(got, want) {
+		t.Errorf("versionSelector(0) = %v", got)
+	}
+}
+
+func TestSetVersioned(t *testing.T) {
+	d := &Dao{}
+	if d.Versioned("users") {
+		t.Error("Versioned() without policy = true")
+	}
+	d.SetVersioned("users", true)
+	clone := d.WithDeleted(IncludeDeleted)
+	if !clone.Versioned("users") || clone.Versioned("books") {
+		t.Error("SetVersioned() not visible to clone")
+	}
+
+	ctx := context.Background()
+	u, err := d.prepareUpdate(ctx, "users", bson.M{"age": 18}, false)
+	if inc, _ := u["$inc"].(bson.M); err != nil || inc[FieldVersion] != 1 {
+		t.Errorf("prepareUpdate() = %v, %v", u, err)
+	}
+	docs, err := d.prepareInserts(ctx, "users", []bson.M{{"name": "zhe"}})
+	if err != nil || len(docs) != 1 || docs[0].(bson.M)[FieldVersion] != 1 {
+		t.Errorf("prepareInserts() = %v, %v", docs, err)
+	}
+	if m, err := d.prepareInsert(ctx, "books", bson.M{"name": "mgo"}); err != nil || m[FieldVersion] != nil {
+		t.Errorf("prepareInsert(books) = %v, %v", m, err)
+	}
+
+	d.SetVersioned("users", false)
+	if clone.Versioned("users") {
+		t.Error("SetVersioned(false) not visible to clone")
+	}
+}
+
+func TestConflictError(t *testing.T) {
+	id := bson.NewObjectId()
+	err := opError("UpdateIfVersion", "users", &ConflictError{Id: id, Expected: 1, Current: 3})
+	if !errors.Is(err, ErrConflict) {
+		t.Errorf("errors.Is(%v, ErrConflict) = false", err)
+	}
+	var ce *ConflictError
+	if !errors.As(err, &ce) || ce.Current != 3 || ce.Expected != 1 {
+		t.Errorf("errors.As() = %v", ce)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Error("ConflictError is ErrNotFound")
+	}
+}
+
+func TestUpdateIfVersion(t *testing.T) {
+	d := &Dao{}
+	if err := d.UpdateIfVersion("users", "", 1, bson.M{"age": 18}); !errors.Is(err, errNull) {
+		t.Errorf("UpdateIfVersion(empty id) error = %v, want errNull", err)
+	}
+	id := bson.NewObjectId()
+	if err := d.UpdateIfVersion("users", id, 1, bson.M{"$inc": bson.M{"age": 1}, "name": "zhe"}); !errors.Is(err, ErrInvalidSelector) {
+		t.Errorf("UpdateIfVersion(mixed) error = %v, want ErrInvalidSelector", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.UpdateIfVersionCtx(ctx, "users", id, 1, bson.M{"age": 18}); !errors.Is(err, context.Canceled) {
+		t.Errorf("UpdateIfVersionCtx(canceled) error = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,302 @@
+/*
+ * 说明：查询条件构建器
+ * 作者：agent
+ * 时间：2026-10-18 09:00
+ * 更新：Filter 以链式方法生成查询条件, 可按模型校验字段路径, 避免拼错字段名(如 nam)时查询静默返回空结果
+ */
+
+package dao
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Filter 查询条件构建器, Build 的结果可直接作为 FindDoc、FindOneDoc、FindPage、Query 等方法的 query 参数, 用法:
+//
+//	query, err := NewFilterFor[model.User]().
+//		All("friends", "KD", "YM").
+//		ElemMatch("comments", NewFilter().Eq("content", "This is a comment")).
+//		Range("age", 18, nil).
+//		Build()
+//
+// 同一字段出现多次时以 $and 组合; 链式方法出错时记录第一个错误并忽略后续调用, 由 Build 返回
+// ElemMatch、And、Or、Nor、Not 的子条件按外层的模型校验, 因此子条件可以使用 NewFilter 创建
+type Filter struct {
+	policy *FilterPolicy // 模型的字段路径, nil 时不校验
+	doc    bson.M
+	checks []fieldCheck // 使用过的字段路径, 合并到外层时按外层的模型校验
+	err    error
+}
+
+// fieldCheck 字段路径及其类型要求
+type fieldCheck struct {
+	op   string
+	path string
+	want func(reflect.Type) bool
+}
+
+// NewFilter 创建不校验字段路径的查询条件构建器
+func NewFilter() *Filter {
+	return &Filter{doc: bson.M{}}
+}
+
+// NewFilterFor 创建按模型 T 的 bson 标签校验字段路径的查询条件构建器
+// 字段必须存在(包括 filter:"-"、json:"-" 的字段, 服务端代码不受客户端查询的限制); All、ElemMatch 的字段必须为数组
+func NewFilterFor[T any]() *Filter {
+	f := NewFilter()
+	f.policy = newFieldPolicy(reflect.TypeOf((*T)(nil)).Elem(), true)
+	return f
+}
+
+// Eq 字段等于 value; 数组字段包含 value 时也匹配
+func (f *Filter) Eq(path string, value interface{}) *Filter {
+	return f.field("$eq", path, value, nil)
+}
+
+// In 字段等于 values 中的任意一个($in); 只有一个切片参数时使用该切片
+func (f *Filter) In(path string, values ...interface{}) *Filter {
+	return f.field("$in", path, bson.M{"$in": valueList(values)}, nil)
+}
+
+// All 数组字段包含 values 中的全部元素($all); 只有一个切片参数时使用该切片
+func (f *Filter) All(path string, values ...interface{}) *Filter {
+	return f.field("$all", path, bson.M{"$all": valueList(values)}, isSlice)
+}
+
+// ElemMatch 数组字段中至少有一个元素满足 sub 的全部条件($elemMatch), sub 中的字段路径相对于数组元素
+func (f *Filter) ElemMatch(path string, sub *Filter) *Filter {
+	if f.err != nil {
+		return f
+	}
+	doc, err := sub.build("$elemMatch")
+	if err != nil {
+		f.err = err
+		return f
+	}
+	if f.field("$elemMatch", path, bson.M{"$elemMatch": doc}, isSlice); f.err != nil {
+		return f
+	}
+	f.merge(sub, path+".")
+	return f
+}
+
+// Range 字段大于等于 min 且小于 max($gte、$lt), 为 nil 的边界不限制
+func (f *Filter) Range(path string, min, max interface{}) *Filter {
+	cond := bson.M{}
+	if min != nil {
+		cond["$gte"] = min
+	}
+	if max != nil {
+		cond["$lt"] = max
+	}
+	if len(cond) == 0 {
+		return f.fail(joinPath(path, "$gte"), nil, "min and max are both nil")
+	}
+	return f.field("$gte", path, cond, nil)
+}
+
+// Regex 字段匹配正则表达式($regex), options 如 "i" 忽略大小写
+func (f *Filter) Regex(path, pattern, options string) *Filter {
+	return f.field("$regex", path, bson.M{"$regex": bson.RegEx{Pattern: pattern, Options: options}}, nil)
+}
+
+// Exists 字段存在(exists 为 true)或不存在($exists)
+func (f *Filter) Exists(path string, exists bool) *Filter {
+	return f.field("$exists", path, bson.M{"$exists": exists}, nil)
+}
+
+// And 满足全部子条件($and)
+func (f *Filter) And(subs ...*Filter) *Filter {
+	return f.logical("$and", subs)
+}
+
+// Or 满足任意一个子条件($or)
+func (f *Filter) Or(subs ...*Filter) *Filter {
+	return f.logical("$or", subs)
+}
+
+// Nor 不满足任何一个子条件($nor)
+func (f *Filter) Nor(subs ...*Filter) *Filter {
+	return f.logical("$nor", subs)
+}
+
+// Not 不满足 sub
+// sub 只有一个字段时作用于该字段: 操作符条件及正则表达式使用 {$not: ...}, 等于条件使用 $ne; 否则使用 {$nor: [sub]}
+// 注: 与 $not 相同, 字段不存在的文档也满足条件
+func (f *Filter) Not(sub *Filter) *Filter {
+	if f.err != nil {
+		return f
+	}
+	doc, err := sub.build("$not")
+	if err != nil {
+		f.err = err
+		return f
+	}
+	if len(doc) != 1 {
+		return f.logical("$nor", []*Filter{sub})
+	}
+	for path, cond := range doc {
+		if strings.HasPrefix(path, "$") {
+			return f.logical("$nor", []*Filter{sub})
+		}
+		switch v := cond.(type) {
+		case bson.RegEx:
+			cond = bson.M{"$not": v}
+		case bson.M:
+			if isOperatorDoc(v) {
+				cond = bson.M{"$not": v}
+				break
+			}
+			cond = bson.M{"$ne": v}
+		default:
+			cond = bson.M{"$ne": v}
+		}
+		f.merge(sub, "")
+		if f.err == nil {
+			f.set(path, cond)
+		}
+	}
+	return f
+}
+
+// Build 返回查询条件, 构建过程中出错时返回 *FilterError(errors.Is(err, ErrInvalidSelector) 为 true)
+// 未添加任何条件时返回 bson.M{}, 匹配全部文档
+func (f *Filter) Build() (bson.M, error) {
+	if f == nil {
+		return nil, errNull
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return copyM(f.doc), nil
+}
+
+// build 返回作为子条件的查询条件, 子条件不能为空
+func (f *Filter) build(op string) (bson.M, error) {
+	doc, err := f.Build()
+	if err != nil {
+		return nil, err
+	}
+	if len(doc) == 0 {
+		return nil, &FilterError{Path: op, Reason: "empty sub filter"}
+	}
+	return doc, nil
+}
+
+// field 校验字段路径后加入 {path: cond}
+func (f *Filter) field(op, path string, cond interface{}, want func(reflect.Type) bool) *Filter {
+	if f.err != nil {
+		return f
+	}
+	c := fieldCheck{op: op, path: path, want: want}
+	if err := f.check(c); err != nil {
+		f.err = err
+		return f
+	}
+	f.checks = append(f.checks, c)
+	f.set(path, cond)
+	return f
+}
+
+// logical 加入 {op: [sub...]}
+func (f *Filter) logical(op string, subs []*Filter) *Filter {
+	if f.err != nil {
+		return f
+	}
+	if len(subs) == 0 {
+		return f.fail(op, nil, "must have at least one sub filter")
+	}
+	clauses := make([]interface{}, len(subs))
+	for i, sub := range subs {
+		doc, err := sub.build(fmt.Sprintf("%s[%d]", op, i))
+		if err != nil {
+			f.err = err
+			return f
+		}
+		if f.merge(sub, ""); f.err != nil {
+			return f
+		}
+		clauses[i] = doc
+	}
+	f.set(op, clauses)
+	return f
+}
+
+// merge 按 f 的模型校验子条件使用的字段路径, prefix 为 $elemMatch 的数组字段
+func (f *Filter) merge(sub *Filter, prefix string) {
+	for _, c := range sub.checks {
+		c.path = prefix + c.path
+		if err := f.check(c); err != nil {
+			f.err = err
+			return
+		}
+		f.checks = append(f.checks, c)
+	}
+}
+
+// set 加入 {key: cond}, key 已存在时以 $and 组合
+func (f *Filter) set(key string, cond interface{}) {
+	old, ok := f.doc[key]
+	if !ok {
+		f.doc[key] = cond
+		return
+	}
+	if key == "$and" {
+		f.doc[key] = append(old.([]interface{}), cond.([]interface{})...)
+		return
+	}
+	and, _ := f.doc["$and"].([]interface{})
+	f.doc["$and"] = append(and, bson.M{key: cond})
+}
+
+// check 校验字段路径的格式及是否为模型的字段
+func (f *Filter) check(c fieldCheck) error {
+	for _, seg := range strings.Split(c.path, ".") {
+		if seg == "" || strings.HasPrefix(seg, "$") {
+			return &FilterError{Path: joinPath(c.path, c.op), Reason: "invalid field path"}
+		}
+	}
+	if f.policy == nil {
+		return nil
+	}
+	t, ok := f.policy.lookup(c.path)
+	if !ok {
+		return &FilterError{Path: joinPath(c.path, c.op), Reason: "unknown field"}
+	}
+	if c.want != nil && !c.want(t) {
+		return &FilterError{Path: joinPath(c.path, c.op), Reason: fmt.Sprintf("field type %s is not supported", typeName(t))}
+	}
+	return nil
+}
+
+func (f *Filter) fail(path string, value interface{}, reason string) *Filter {
+	if f.err == nil {
+		f.err = &FilterError{Path: path, Value: value, Reason: reason}
+	}
+	return f
+}
+
+// valueList 只有一个切片参数时展开该切片
+func valueList(values []interface{}) interface{} {
+	if len(values) == 1 && values[0] != nil && isSlice(reflect.TypeOf(values[0])) {
+		return values[0]
+	}
+	if values == nil {
+		return []interface{}{}
+	}
+	return values
+}
+
+// isOperatorDoc 是否所有键都是操作符, 如 {"$gt": 1}
+func isOperatorDoc(m bson.M) bool {
+	for k := range m {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(m) > 0
+}
@@ -0,0 +1,92 @@
+/*
+ * 说明：查询条件构建器单元测试
+ * 作者：agent
+ * 时间：2026-10-18 09:00
+ * 更新：
+ */
+
+package dao
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+	"mongodb.golang.com/src/model"
+)
+
+func TestFilter(t *testing.T) {
+	user := NewFilterFor[model.User]
+	tests := []struct {
+		name string
+		f    *Filter
+		want bson.M
+	}{
+		{"empty", user(), bson.M{}},
+		{"eq in", user().Eq("account", "mongo_a").In("age", 18, 20),
+			bson.M{"account": "mongo_a", "age": bson.M{"$in": []interface{}{18, 20}}}},
+		{"in slice", user().In("name", []string{"a", "b"}), bson.M{"name": bson.M{"$in": []string{"a", "b"}}}},
+		{"all", user().All("friends", "KD", "YM"), bson.M{"friends": bson.M{"$all": []interface{}{"KD", "YM"}}}},
+		{"elem match", user().ElemMatch("comments", NewFilter().Eq("content", "x").Exists("user_ref", true)),
+			bson.M{"comments": bson.M{"$elemMatch": bson.M{"content": "x", "user_ref": bson.M{"$exists": true}}}}},
+		{"range", user().Range("age", 18, 30).Range("create_at", nil, 5),
+			bson.M{"age": bson.M{"$gte": 18, "$lt": 30}, "create_at": bson.M{"$lt": 5}}},
+		{"regex", user().Regex("email", "^zhe", "i"),
+			bson.M{"email": bson.M{"$regex": bson.RegEx{Pattern: "^zhe", Options: "i"}}}},
+		{"same field", user().Exists("email", true).Regex("email", "qq", ""),
+			bson.M{"email": bson.M{"$exists": true}, "$and": []interface{}{bson.M{"email": bson.M{"$regex": bson.RegEx{Pattern: "qq"}}}}}},
+		{"or", user().Or(NewFilter().Eq("name", "a"), NewFilter().Eq("address.city", "hangzhou")),
+			bson.M{"$or": []interface{}{bson.M{"name": "a"}, bson.M{"address.city": "hangzhou"}}}},
+		{"and nor", user().And(NewFilter().Eq("age", 1)).And(NewFilter().Eq("age", 2)).Nor(NewFilter().Eq("is_delete", true)),
+			bson.M{"$and": []interface{}{bson.M{"age": 1}, bson.M{"age": 2}}, "$nor": []interface{}{bson.M{"is_delete": true}}}},
+		{"not operator", user().Not(NewFilter().Range("age", 18, nil)), bson.M{"age": bson.M{"$not": bson.M{"$gte": 18}}}},
+		{"not eq", user().Not(NewFilter().Eq("name", "a")), bson.M{"name": bson.M{"$ne": "a"}}},
+		{"not fields", user().Not(NewFilter().Eq("name", "a").Eq("age", 1)),
+			bson.M{"$nor": []interface{}{bson.M{"name": "a", "age": 1}}}},
+		{"untyped", NewFilter().Eq("nam", ""), bson.M{"nam": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.f.Build()
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Build() = %#v, %v, want %#v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	user := NewFilterFor[model.User]
+	tests := []struct {
+		name string
+		f    *Filter
+		path string
+	}{
+		{"typo", user().Eq("nam", ""), "nam.$eq"},
+		{"all not array", user().All("name", "a"), "name.$all"},
+		{"elem match field", user().ElemMatch("comments", NewFilter().Eq("stars", 6)), "comments.stars.$eq"},
+		{"elem match not array", user().ElemMatch("address", NewFilter().Eq("city", "x")), "address.$elemMatch"},
+		{"empty elem match", user().ElemMatch("comments", NewFilter()), "$elemMatch"},
+		{"or field", user().Or(NewFilter().Eq("age", 1), NewFilter().Eq("agee", 2)), "agee.$eq"},
+		{"empty or", user().Or(), "$or"},
+		{"not field", user().Not(NewFilter().Eq("nam", "")), "nam.$eq"},
+		{"range", NewFilter().Range("age", nil, nil), "age.$gte"},
+		{"invalid path", NewFilter().Eq("$where", "1"), "$where.$eq"},
+		{"first error kept", user().Eq("nam", "").Eq("agee", 1), "nam.$eq"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.f.Build()
+			var fe *FilterError
+			if !errors.Is(err, ErrInvalidSelector) || !errors.As(err, &fe) || fe.Path != tt.path {
+				t.Errorf("Build() = %v, %v, want FilterError at %s", got, err, tt.path)
+			}
+		})
+	}
+
+	var f *Filter
+	if _, err := f.Build(); !errors.Is(err, errNull) {
+		t.Errorf("nil Build() error = %v, want errNull", err)
+	}
+}
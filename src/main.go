@@ -8,19 +8,76 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"os"
+	"time"
 
 	"mongodb.golang.com/src/dao"
 )
 
+var (
+	configPath = flag.String("config", "config/db.yaml", "database config file(yaml)")
+	profile    = flag.String("profile", "", "config profile: dev, test, prod (default $MONGO_PROFILE or dev)")
+	syncIndex  = flag.Bool("sync_indexes", false, "drop undeclared indexes and rebuild changed ones to match the model index tags")
+	migrate    = flag.String("migrate", "", "run migrations and exit: status, up or down")
+	migrateTo  = flag.Int("migrate_to", 0, "target version for -migrate up/down (0: latest for up, all for down)")
+	dryRun     = flag.Bool("dry_run", false, "print the migrations -migrate would run without running them")
+	purge      = flag.Duration("purge_deleted", 0, "hard-delete users soft-deleted longer ago than this (e.g. 720h) and exit")
+)
+
 func main() {
-	session := dao.InitMongo()
+	dao.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	cfg, err := dao.LoadConfig(*configPath, *profile, flag.CommandLine)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	dao.DBCfg = cfg
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	session, err := dao.Connect(ctx, cfg)
+	cancel()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 	defer session.Close()
 
 	d := dao.NewDao(session)
+	if *migrate != "" {
+		err = runMigrations(d)
+		session.Close()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	userDao := dao.NewUserDao(d)
+	if *purge > 0 {
+		n, err := userDao.PurgeDeleted(context.Background(), *purge)
+		session.Close()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("purged %d users deleted before %s\n", n, time.Now().Add(-*purge).Format(time.RFC3339))
+		return
+	}
 
-	var err error
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+	err = userDao.EnsureIndexes(ctx, *syncIndex)
+	cancel()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		session.Close()
+		os.Exit(1)
+	}
 
 	err = userDao.TestFindOneResultJsonMarshal()
 	if err != nil {
@@ -37,3 +94,35 @@ func main() {
 		fmt.Printf("Error: %v\n", err.Error())
 	}
 }
+
+// runMigrations 执行 -migrate 指定的迁移命令, 完成后打印执行情况
+func runMigrations(d *dao.Dao) error {
+	m, err := dao.NewMigrator(d, dao.UserMigrations...)
+	if err != nil {
+		return err
+	}
+	m.DryRun = *dryRun
+
+	ctx := context.Background()
+	var done []dao.MigrationStatus
+	switch *migrate {
+	case "status":
+	case "up":
+		done, err = m.Up(ctx, *migrateTo)
+	case "down":
+		done, err = m.Down(ctx, *migrateTo)
+	default:
+		return fmt.Errorf("unknown -migrate command %q, want status, up or down", *migrate)
+	}
+	for _, s := range done {
+		if m.DryRun {
+			fmt.Printf("would %s %d %s\n", *migrate, s.Version, s.Name)
+		} else {
+			fmt.Printf("%s %d %s\n", *migrate, s.Version, s.Name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return m.Report(ctx, os.Stdout)
+}
@@ -0,0 +1,107 @@
+/*
+ * 说明：时间类型
+ * 作者：agent
+ * 时间：2026-10-18 08:32
+ * 更新：时间以 UTC BSON 日期存储, 代替 TimeLayout 格式的本地时间字符串; JSON 的格式及时区可配置
+ */
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// JSON 中时间的格式及时区, 默认为 UTC 的 RFC 3339, 如 2018-01-17T14:55:00Z
+// 可在程序启动时修改, 如 TimeFormat = "2006-01-02 15:04:05"; TimeZone, _ = time.LoadLocation("Asia/Shanghai")
+var (
+	TimeFormat = time.RFC3339
+	TimeZone   = time.UTC
+)
+
+// legacyLayout 迁移之前时间字符串的格式(服务器本地时间), 读取未迁移的文档时使用
+const legacyLayout = "2006-01-02 15:04:05"
+
+// Time 以 UTC BSON 日期存储的时间, 零值存储为 null; JSON 按 TimeFormat、TimeZone 输出, 零值输出为 null
+type Time struct {
+	time.Time
+}
+
+// Now 返回当前时间, 精度为毫秒(与 BSON 日期一致)
+func Now() Time {
+	return Time{time.Now().UTC().Truncate(time.Millisecond)}
+}
+
+// GetBSON 实现 bson.Getter
+func (t Time) GetBSON() (interface{}, error) {
+	if t.IsZero() {
+		return nil, nil
+	}
+	return t.UTC(), nil
+}
+
+// SetBSON 实现 bson.Setter, 兼容迁移之前的时间字符串
+func (t *Time) SetBSON(raw bson.Raw) error {
+	switch raw.Kind {
+	case 0x0A: // null
+		t.Time = time.Time{}
+		return nil
+	case 0x02: // string
+		var s string
+		if err := raw.Unmarshal(&s); err != nil {
+			return err
+		}
+		if s == "" {
+			t.Time = time.Time{}
+			return nil
+		}
+		parsed, err := time.ParseInLocation(legacyLayout, s, time.Local)
+		if err != nil {
+			return fmt.Errorf("model.Time: %w", err)
+		}
+		t.Time = parsed.UTC()
+		return nil
+	}
+	var v time.Time
+	if err := raw.Unmarshal(&v); err != nil {
+		return err
+	}
+	t.Time = v.UTC()
+	return nil
+}
+
+// MarshalJSON 按 TimeFormat、TimeZone 输出
+func (t Time) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.In(TimeZone).Format(TimeFormat))
+}
+
+// UnmarshalJSON 解析 RFC 3339 或 TimeFormat 格式(按 TimeZone)的时间, null 及空字符串为零值
+func (t *Time) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		if parsed, err = time.ParseInLocation(TimeFormat, s, TimeZone); err != nil {
+			return fmt.Errorf("model.Time: %w", err)
+		}
+	}
+	t.Time = parsed.UTC()
+	return nil
+}
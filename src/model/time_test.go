@@ -0,0 +1,97 @@
+/*
+ * 说明：时间类型单元测试
+ * 作者：agent
+ * 时间：2026-10-18 08:32
+ * 更新：
+ */
+
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestTime_BSON(t *testing.T) {
+	type doc struct {
+		At Time `bson:"at"`
+	}
+	at := Time{time.Date(2018, 1, 17, 22, 55, 0, 0, time.FixedZone("CST", 8*3600))}
+
+	data, err := bson.Marshal(doc{At: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw bson.M
+	if err := bson.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["at"].(time.Time); !ok {
+		t.Errorf("stored as %T, want a BSON date", raw["at"])
+	}
+	var got doc
+	if err := bson.Unmarshal(data, &got); err != nil || !got.At.Equal(at.Time) || got.At.Location() != time.UTC {
+		t.Errorf("round trip = %v, %v, want %v in UTC", got.At, err, at)
+	}
+
+	// 零值存储为 null
+	data, _ = bson.Marshal(doc{})
+	if err := bson.Unmarshal(data, &raw); err != nil || raw["at"] != nil {
+		t.Errorf("zero stored as %#v, want null", raw["at"])
+	}
+
+	// 迁移之前的字符串
+	for s, want := range map[string]time.Time{
+		"":                    {},
+		"2018-01-17 22:55:00": time.Date(2018, 1, 17, 22, 55, 0, 0, time.Local),
+	} {
+		data, _ := bson.Marshal(bson.M{"at": s})
+		var got doc
+		if err := bson.Unmarshal(data, &got); err != nil || !got.At.Equal(want) {
+			t.Errorf("legacy %q = %v, %v, want %v", s, got.At, err, want)
+		}
+	}
+	data, _ = bson.Marshal(bson.M{"at": "yesterday"})
+	if err := bson.Unmarshal(data, &got); err == nil {
+		t.Errorf("legacy %q error = nil", "yesterday")
+	}
+}
+
+func TestTime_JSON(t *testing.T) {
+	at := Time{time.Date(2018, 1, 17, 14, 55, 0, 0, time.UTC)}
+	defer func(format string, zone *time.Location) { TimeFormat, TimeZone = format, zone }(TimeFormat, TimeZone)
+
+	tests := []struct {
+		name   string
+		format string
+		zone   *time.Location
+		want   string
+	}{
+		{"default", time.RFC3339, time.UTC, `"2018-01-17T14:55:00Z"`},
+		{"layout and zone", "2006-01-02 15:04:05", time.FixedZone("CST", 8*3600), `"2018-01-17 22:55:00"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			TimeFormat, TimeZone = tt.format, tt.zone
+			data, err := json.Marshal(at)
+			if err != nil || string(data) != tt.want {
+				t.Fatalf("MarshalJSON() = %s, %v, want %s", data, err, tt.want)
+			}
+			var got Time
+			if err := json.Unmarshal(data, &got); err != nil || !got.Equal(at.Time) {
+				t.Errorf("UnmarshalJSON(%s) = %v, %v", data, got, err)
+			}
+		})
+	}
+
+	if data, _ := json.Marshal(Time{}); string(data) != "null" {
+		t.Errorf("MarshalJSON(zero) = %s, want null", data)
+	}
+	var got Time
+	if err := json.Unmarshal([]byte(`"2018-01-17T22:55:00+08:00"`), &got); err != nil || !got.Equal(at.Time) {
+		t.Errorf("UnmarshalJSON(RFC 3339) = %v, %v", got, err)
+	}
+}
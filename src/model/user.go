@@ -14,8 +14,8 @@ import (
 
 type User struct {
 	Id       bson.ObjectId `json:"id,omitempty" bson:"_id,omitempty"` // omitempty值为空时忽略该字段解析
-	Account  string        `json:"account"`                           // 建索引
-	Password string        `json:"password"`                          //
+	Account  string        `json:"account" index:"unique"`            // 唯一索引
+	Password string        `json:"password" filter:"-"`               // 不允许作为查询条件
 	Name     string        `json:"name"`                              //
 	Age      int           `json:"age"`                               //
 	Email    string        `json:"email"`                             //
@@ -23,10 +23,11 @@ type User struct {
 	Comments []Comment     `json:"comments"`                          // 内嵌数组文档
 	Address  Address       `json:"address"`                           // 内嵌文档
 	// 数据库私有字段
-	CreateAt string `json:"create_at" bson:"create_at"`
-	ModifyAt string `json:"modify_at" bson:"modify_at"`
-	IsDelete bool   `json:"-" bson:"is_delete"`
-	DeleteAt string `json:"-" bson:"delete_at"`
+	CreateAt Time `json:"create_at" bson:"create_at" index:"desc"` // 默认按 -create_at 排序
+	ModifyAt Time `json:"modify_at" bson:"modify_at"`
+	IsDelete bool `json:"-" bson:"is_delete"`
+	DeleteAt Time `json:"-" bson:"delete_at"`
+	Version  int  `json:"version" bson:"version"` // 乐观锁版本号, 见 dao.UpdateIfVersion
 }
 
 type Address struct {
@@ -38,11 +39,11 @@ type Address struct {
 
 type Comment struct {
 	Id      bson.ObjectId `json:"id,omitempty" bson:"_id,omitempty"`
-	Content string        `json:"content"`
+	Content string        `json:"content" index:"text"`
 	UserRef mgo.DBRef     `json:"user_ref" bson:"user_ref,omitempty"`
 	// 数据库私有字段
-	CreateAt string `json:"create_at" bson:"create_at"`
-	ModifyAt string `json:"modify_at" bson:"modify_at"`
-	IsDelete bool   `json:"-" bson:"is_delete"`
-	DeleteAt string `json:"-" bson:"delete_at"`
+	CreateAt Time `json:"create_at" bson:"create_at"`
+	ModifyAt Time `json:"modify_at" bson:"modify_at"`
+	IsDelete bool `json:"-" bson:"is_delete"`
+	DeleteAt Time `json:"-" bson:"delete_at"`
 }